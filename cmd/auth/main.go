@@ -2,20 +2,34 @@ package main
 
 import (
 	"context"
+	"net"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
 	"github.com/RESERPIX/hubigr/internal/captcha"
+	"github.com/RESERPIX/hubigr/internal/cleanup"
 	"github.com/RESERPIX/hubigr/internal/config"
+	"github.com/RESERPIX/hubigr/internal/diagnostics"
+	"github.com/RESERPIX/hubigr/internal/digest"
 	"github.com/RESERPIX/hubigr/internal/email"
 	"github.com/RESERPIX/hubigr/internal/errors"
+	"github.com/RESERPIX/hubigr/internal/health"
 	"github.com/RESERPIX/hubigr/internal/http"
 	"github.com/RESERPIX/hubigr/internal/logger"
+	"github.com/RESERPIX/hubigr/internal/metrics"
+	"github.com/RESERPIX/hubigr/internal/migrate"
+	"github.com/RESERPIX/hubigr/internal/monitoring"
+	"github.com/RESERPIX/hubigr/internal/outbox"
 	"github.com/RESERPIX/hubigr/internal/ratelimit"
+	"github.com/RESERPIX/hubigr/internal/realtime"
+	"github.com/RESERPIX/hubigr/internal/scheduler"
+	"github.com/RESERPIX/hubigr/internal/storage"
 	"github.com/RESERPIX/hubigr/internal/store"
+	"github.com/RESERPIX/hubigr/internal/tracing"
 	"github.com/RESERPIX/hubigr/internal/upload"
+	"github.com/RESERPIX/hubigr/migrations"
 	"github.com/gofiber/fiber/v2"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
@@ -31,8 +45,22 @@ func main() {
 	
 	// Инициализация логгера
 	logger.Init(cfg.LogLevel)
+
+	// auth migrate up|down|status - управление схемой БД без запуска сервиса
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(runMigrate(cfg, os.Args[2:]))
+	}
+
 	logger.Info("Starting Hubigr Auth Service", "version", "1.0.0")
 
+	// Трейсинг: без OTEL_EXPORTER_OTLP_ENDPOINT спаны никуда не отправляются
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.OTLPEndpoint, cfg.ServiceName, cfg.TraceSampleRatio)
+	if err != nil {
+		logger.Error("Failed to initialize tracing", "error", err)
+		os.Exit(1)
+	}
+	logger.Info("Tracing initialized", "otlp_endpoint", cfg.OTLPEndpoint, "sample_ratio", cfg.TraceSampleRatio)
+
 	// Конфигурация connection pool
 	poolConfig, err := pgxpool.ParseConfig(cfg.DatabaseURL)
 	if err != nil {
@@ -47,6 +75,7 @@ func main() {
 	poolConfig.MaxConnIdleTime = time.Minute * 5   // Быстрое закрытие idle
 	poolConfig.HealthCheckPeriod = time.Minute     // Частые проверки
 	poolConfig.MaxConnLifetimeJitter = time.Minute * 5 // Jitter для равномерного обновления
+	poolConfig.ConnConfig.Tracer = tracing.PgxTracer{}
 	
 	// Подключение к базе данных
 	db, err := pgxpool.NewWithConfig(context.Background(), poolConfig)
@@ -63,9 +92,27 @@ func main() {
 	}
 	logger.Info("Database connected successfully")
 
+	// Встроенные миграции; при MIGRATE_ON_START применяются до запуска сервиса,
+	// иначе их применяют командой "auth migrate up"
+	migrationList, err := migrate.Load(migrations.FS)
+	if err != nil {
+		logger.Error("Failed to load migrations", "error", err)
+		os.Exit(1)
+	}
+	migrator := migrate.NewMigrator(db, migrationList)
+	if cfg.MigrateOnStart {
+		if _, err := migrator.Up(context.Background()); err != nil {
+			logger.Error("Failed to apply migrations", "error", err)
+			os.Exit(1)
+		}
+	}
+
 	// Инициализация репозиториев
 	userRepo := store.NewUserRepo(db)
 	refreshRepo := store.NewRefreshTokenRepo(db)
+	notificationRepo := store.NewNotificationRepo(db)
+	outboxRepo := store.NewEmailOutboxRepo(db)
+	deliveryRepo := store.NewEmailDeliveryRepo(db)
 
 	// Инициализация Redis rate limiter
 	limiter, err := ratelimit.NewRedisLimiter(cfg.RedisURL)
@@ -73,28 +120,149 @@ func main() {
 		logger.Error("Failed to connect to Redis", "error", err)
 		os.Exit(1)
 	}
-	logger.Info("Redis connected successfully")
+	logger.Info("Redis connected successfully", "rate_limits", cfg.RateLimits.String())
+	limiter.GetClient().AddHook(tracing.RedisHook{})
+
+	// Списки разрешенных/запрещенных IP для rate limiting
+	aclRepo := store.NewRateLimitACLRepo(db)
+	rateLimitACL := ratelimit.NewACL(aclRepo, 30*time.Second)
+	if err := rateLimitACL.Reload(context.Background()); err != nil {
+		logger.Error("Failed to load rate limit ACL", "error", err)
+	}
+	go rateLimitACL.Start(context.Background())
+
+	// Метрики пулов соединений PostgreSQL и Redis для /metrics
+	poolMonitor := monitoring.NewPoolMonitor(db, limiter.GetClient(), time.Duration(cfg.PoolMonitorInterval)*time.Second)
+	if err := metrics.Register(poolMonitor); err != nil {
+		logger.Error("Failed to register pool metrics", "error", err)
+	}
+	go poolMonitor.Start(context.Background())
+
+	// Метрики и pprof на внутреннем адресе, не через публичный API
+	var diagnosticsServer *diagnostics.Server
+	if cfg.DiagnosticsAddr != "off" {
+		diagnosticsServer, err = diagnostics.NewServer(cfg.DiagnosticsAddr, cfg.DiagnosticsToken, cfg.DiagnosticsAllowedIPs)
+		if err != nil {
+			logger.Error("Invalid diagnostics listener config", "error", err)
+			os.Exit(1)
+		}
+		go diagnosticsServer.Start()
+		logger.Info("Diagnostics listener started", "addr", cfg.DiagnosticsAddr, "protected", diagnosticsServer.Protected())
+	}
+
+	// Realtime доставка уведомлений между инстансами через Redis pub/sub
+	hub := realtime.NewHub(limiter.GetClient())
+	if err := hub.Start(context.Background()); err != nil {
+		logger.Error("Failed to subscribe to notifications channel", "error", err)
+		os.Exit(1)
+	}
+
+	// Шаблоны писем (встроенные, с переопределением файлами из EMAIL_TEMPLATES_DIR)
+	emailRenderer, err := email.NewRenderer(cfg.EmailTemplatesDir)
+	if err != nil {
+		logger.Error("Failed to load email templates", "error", err)
+		os.Exit(1)
+	}
+
+	// Инициализация транспорта писем
+	var emailTransport email.Transport
+	switch cfg.EmailTransport {
+	case "smtp":
+		emailTransport, err = email.NewSMTPTransport(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUser, cfg.SMTPPass, cfg.SMTPTLS, cfg.EmailWorkers)
+	case "http":
+		emailTransport, err = email.NewHTTPTransport(cfg.EmailAPIEndpoint, cfg.EmailAPIRegion, cfg.EmailAPIAccessKey, cfg.EmailAPISecretKey)
+	case "maildir":
+		emailTransport, err = email.NewMaildirTransport(cfg.EmailMaildir)
+	default:
+		// Разработка: mock transport
+		emailTransport = email.NewMockTransport()
+	}
+	if err != nil {
+		logger.Error("Failed to initialize email transport", "transport", cfg.EmailTransport, "error", err)
+		os.Exit(1)
+	}
+	logger.Info("Email transport initialized", "transport", cfg.EmailTransport)
+	emailSender := email.NewSender(emailTransport, emailRenderer, deliveryRepo, cfg.SMTPFrom, cfg.BaseURL)
+
+	// Алерты: правила по метрикам и pools, уведомления в настроенные каналы
+	var alertNotifiers []monitoring.Notifier
+	if cfg.AlertWebhookURL != "" {
+		alertNotifiers = append(alertNotifiers, monitoring.NewWebhookNotifier(cfg.AlertWebhookURL))
+	}
+	if cfg.AlertSlackWebhookURL != "" {
+		alertNotifiers = append(alertNotifiers, monitoring.NewSlackNotifier(cfg.AlertSlackWebhookURL))
+	}
+	if len(cfg.AlertEmailTo) > 0 {
+		alertNotifiers = append(alertNotifiers, monitoring.NewEmailNotifier(emailSender, cfg.AlertEmailTo))
+	}
+	alertManager := monitoring.NewAlertManager(alertNotifiers, time.Duration(cfg.AlertCheckInterval)*time.Second, time.Duration(cfg.AlertCooldown)*time.Minute)
+	alertManager.AddRules(monitoring.DefaultRules(cfg.AlertFailedLogins)...)
+	alertManager.AddRules(poolMonitor.Rules()...)
+	go alertManager.Start(context.Background())
+	logger.Info("Alerting started", "notifiers", len(alertNotifiers), "check_interval_seconds", cfg.AlertCheckInterval)
+
+	// Фоновая отправка писем из outbox с повторами
+	emailWorker := outbox.NewWorker(outboxRepo, emailSender, cfg.EmailWorkers, time.Duration(cfg.EmailPollInterval)*time.Second)
+	go emailWorker.Start(context.Background())
+
+	// Планировщик email-дайджестов уведомлений
+	digestScheduler := digest.NewScheduler(notificationRepo, cfg.BaseURL, cfg.JWTSecret, time.Duration(cfg.DigestCheckInterval)*time.Minute)
+	go digestScheduler.Start(context.Background())
+
+	// Хранилище загруженных файлов: локальный каталог или S3, общее для реплик
+	var files storage.Storage
+	switch cfg.StorageBackend {
+	case "s3":
+		files, err = storage.NewS3Storage(cfg.S3Endpoint, cfg.S3PublicEndpoint, cfg.S3Region, cfg.S3Bucket, cfg.S3AccessKey, cfg.S3SecretKey, time.Duration(cfg.S3PresignTTL)*time.Second)
+	default:
+		files, err = storage.NewLocalStorage(cfg.StorageDir)
+	}
+	if err != nil {
+		logger.Error("Failed to initialize file storage", "backend", cfg.StorageBackend, "error", err)
+		os.Exit(1)
+	}
+	logger.Info("File storage initialized", "backend", cfg.StorageBackend)
 
-	// Инициализация email sender
-	var emailSender http.EmailSender
-	if cfg.SMTPHost != "" && cfg.SMTPUser != "" {
-		// Продакшен: реальный SMTP
-		emailSender = email.NewSMTPSender(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUser, cfg.SMTPPass, cfg.SMTPFrom, cfg.BaseURL)
-	} else {
-		// Разработка: mock sender
-		emailSender = email.NewMockSender()
-		logger.Info("Using mock email sender for development")
+	// Очистка истекших токенов, записей списка IP и брошенных аватаров;
+	// задачи выполняет один инстанс (лидер по advisory lock)
+	avatarReconciler := upload.NewReconciler(files, userRepo.AvatarRefs, time.Duration(cfg.AvatarOrphanGraceHours)*time.Hour)
+	jobScheduler := scheduler.NewScheduler(db, alertManager, cleanup.Jobs(
+		store.NewCleanupRepo(db), avatarReconciler,
+		time.Duration(cfg.CleanupInterval)*time.Minute,
+		time.Duration(cfg.RefreshTokenRetention)*24*time.Hour,
+	)...)
+	go jobScheduler.Start(context.Background())
+
+	// Проверки готовности для /readyz и /api/v1/health
+	readinessChecks := []health.Check{
+		{Name: "database", Timeout: 2 * time.Second, Run: db.Ping},
+		{Name: "redis", Timeout: time.Second, Run: limiter.Ping},
+		{Name: "migrations", Timeout: 2 * time.Second, Run: migrator.Check},
+	}
+	if cfg.EmailTransport == "smtp" {
+		// Письма уходят из outbox с повторами, поэтому недоступный SMTP не делает инстанс неготовым
+		readinessChecks = append(readinessChecks, health.Check{
+			Name: "smtp", Timeout: 3 * time.Second, Optional: true,
+			Run: health.TCPCheck(net.JoinHostPort(cfg.SMTPHost, cfg.SMTPPort)),
+		})
 	}
+	if cfg.StorageBackend == "s3" {
+		// Без хранилища не работают только загрузка и раздача аватаров
+		readinessChecks = append(readinessChecks, health.Check{
+			Name: "storage", Timeout: 3 * time.Second, Optional: true, Run: files.Ping,
+		})
+	}
+	readiness := health.NewChecker(time.Duration(cfg.ReadinessCacheTTL)*time.Second, readinessChecks...)
 
 	// Инициализация avatar uploader
-	avatarUploader := upload.NewAvatarUploader(cfg.BaseURL)
+	avatarUploader := upload.NewAvatarUploader(files, cfg.BaseURL, cfg.AvatarWebP)
 	
 	// Инициализация Turnstile
 	turnstile := captcha.NewTurnstileService(cfg.TurnstileSecret)
 	
 	
 	// Инициализация handlers
-	handlers := http.NewHandlers(userRepo, refreshRepo, limiter, emailSender, avatarUploader, cfg.JWTSecret, turnstile, cfg.AccessTokenTTL, cfg.RefreshTokenTTL)
+	handlers := http.NewHandlers(userRepo, refreshRepo, notificationRepo, hub, limiter, cfg.RateLimits, rateLimitACL, aclRepo, outboxRepo, deliveryRepo, alertManager, readiness, avatarUploader, cfg.JWTSecret, turnstile, emailRenderer, cfg.BaseURL, cfg.AccessTokenTTL, cfg.RefreshTokenTTL)
 
 	// Создание Fiber приложения
 	app := fiber.New(fiber.Config{
@@ -102,35 +270,74 @@ func main() {
 	})
 
 	// Настройка маршрутов
-	http.SetupRoutes(app, handlers, cfg.JWTSecret, cfg.CORSOrigins)
+	logger.Info("Client IP resolution", "trusted_proxies", cfg.TrustedProxies.String(), "header", cfg.TrustedProxies.Header())
+	http.SetupRoutes(app, handlers, files, cfg.TrustedProxies, cfg.JWTSecret, cfg.CORSOrigins, cfg.InternalAPIToken, cfg.EmailWebhookSecret)
 
 	// Graceful shutdown
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 
+	shutdownDone := make(chan struct{})
 	go func() {
+		defer close(shutdownDone)
 		<-c
 		logger.Info("Gracefully shutting down...")
+		// /readyz отвечает 503, а запросы еще обслуживаются: балансировщик
+		// успевает вывести инстанс из ротации до закрытия сокета
+		readiness.Drain()
+		time.Sleep(time.Duration(cfg.ShutdownDrainDelay) * time.Second)
+
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		defer cancel()
-		
-		
-		// Закрываем Redis соединение
+
+		// Завершаем SSE стримы, иначе shutdown будет ждать открытые соединения
+		if err := hub.Close(); err != nil {
+			logger.Error("Failed to close realtime hub", "error", err)
+		}
+
+		// Перестаем принимать запросы и дожидаемся текущих, пока БД и Redis доступны
+		if err := app.ShutdownWithContext(ctx); err != nil {
+			logger.Error("HTTP server shutdown timeout", "error", err)
+		}
+
+		digestScheduler.Stop()
+		jobScheduler.Stop()
+		rateLimitACL.Stop()
+		alertManager.Stop()
+		poolMonitor.Stop()
+		// Дожидаемся писем, которые уже отправляются; остальные останутся в outbox
+		emailWorker.Stop()
+		if err := emailSender.Close(); err != nil {
+			logger.Error("Failed to close email transport", "error", err)
+		}
+
+		if diagnosticsServer != nil {
+			if err := diagnosticsServer.Stop(ctx); err != nil {
+				logger.Error("Failed to stop diagnostics listener", "error", err)
+			}
+		}
+
+		// Отправляем оставшиеся спаны
+		if err := shutdownTracing(ctx); err != nil {
+			logger.Error("Failed to flush traces", "error", err)
+		}
+
+		// Redis и БД закрываем последними: ими пользуются запросы и фоновые задачи
 		if err := limiter.Close(); err != nil {
 			logger.Error("Failed to close Redis connection", "error", err)
 		}
-		
+
 		// Закрываем базу данных с принудительным таймаутом
 		shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer shutdownCancel()
-		
+
 		// Запускаем закрытие БД в горутине для контроля таймаута
 		done := make(chan struct{})
 		go func() {
 			defer close(done)
 			db.Close()
 		}()
-		
+
 		// Ждем завершения или таймаута
 		select {
 		case <-done:
@@ -139,14 +346,14 @@ func main() {
 			logger.Warn("Database shutdown timeout - forcing close")
 			// БД уже закрывается в горутине, просто логируем
 		}
-		
-		// Закрываем HTTP сервер
-		_ = app.ShutdownWithContext(ctx)
 	}()
 
 	// Запуск сервера
 	logger.Info("Server starting", "port", cfg.Port)
 	if err := app.Listen(":" + cfg.Port); err != nil {
-		logger.Info("Server stopped", "error", err)
+		logger.Error("Server stopped", "error", err)
+		os.Exit(1)
 	}
+	// Listen возвращается сразу после остановки сервера, дожидаемся закрытия зависимостей
+	<-shutdownDone
 }
\ No newline at end of file
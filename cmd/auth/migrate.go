@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/RESERPIX/hubigr/internal/config"
+	"github.com/RESERPIX/hubigr/internal/migrate"
+	"github.com/RESERPIX/hubigr/migrations"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const migrateUsage = `Usage: auth migrate <command>
+
+Commands:
+  up          apply all pending migrations
+  down [N]    roll back the last N migrations (default 1)
+  status      list migrations and whether they are applied`
+
+// runMigrate выполняет подкоманду migrate и возвращает код выхода
+func runMigrate(cfg *config.Config, args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	list, err := migrate.Load(migrations.FS)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "migrate:", err)
+		return 1
+	}
+	poolConfig, err := pgxpool.ParseConfig(cfg.DatabaseURL)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "migrate:", err)
+		return 1
+	}
+	poolConfig.MaxConns = 2
+	db, err := pgxpool.NewWithConfig(context.Background(), poolConfig)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "migrate:", err)
+		return 1
+	}
+	defer db.Close()
+	migrator := migrate.NewMigrator(db, list)
+
+	// Миграция может ждать lock другого инстанса, но не бесконечно
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "migrate up:", err)
+			return 1
+		}
+		fmt.Printf("Applied %d migration(s)\n", len(applied))
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				fmt.Fprintln(os.Stderr, "migrate down: N must be a positive number")
+				return 2
+			}
+		}
+		rolledBack, err := migrator.Down(ctx, steps)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "migrate down:", err)
+			return 1
+		}
+		fmt.Printf("Rolled back %d migration(s)\n", len(rolledBack))
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "migrate status:", err)
+			return 1
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tSTATUS\tAPPLIED AT")
+		for _, s := range statuses {
+			status, appliedAt := "pending", ""
+			if s.Applied {
+				status = "applied"
+				appliedAt = s.AppliedAt.Format(time.RFC3339)
+			}
+			if s.Modified {
+				status = "modified"
+			}
+			if s.Unknown {
+				status = "unknown"
+			}
+			fmt.Fprintf(w, "%03d\t%s\t%s\t%s\n", s.Version, s.Name, status, appliedAt)
+		}
+		w.Flush()
+	default:
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+	return 0
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/RESERPIX/hubigr/internal/storage"
+	"github.com/RESERPIX/hubigr/internal/upload"
+)
+
+// avatarsReconcile сверяет хранилище аватаров с БД. Хранилище задается теми же
+// переменными окружения, что и у сервиса (STORAGE_BACKEND, STORAGE_DIR, S3_*).
+func (a *app) avatarsReconcile(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("avatars reconcile", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "report only, do not remove files")
+	grace := fs.Duration("grace", 24*time.Hour, "keep unreferenced files younger than this")
+	if _, err := parse(fs, args, 0); err != nil {
+		return err
+	}
+
+	files, err := openStorage()
+	if err != nil {
+		return err
+	}
+	report, err := upload.NewReconciler(files, a.users.AvatarRefs, *grace).Reconcile(ctx, *dryRun)
+	if report == nil {
+		return err
+	}
+	if printErr := a.print(report, func() {
+		fmt.Printf("Files: %d, referenced: %d, unreferenced within grace: %d\n", report.Files, report.Referenced, report.Recent)
+		if len(report.Orphaned) > 0 {
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "ORPHANED\tSIZE\tMODIFIED")
+			for _, f := range report.Orphaned {
+				fmt.Fprintf(w, "%s\t%d\t%s\n", f.Name, f.Size, f.ModTime.Format(time.RFC3339))
+			}
+			w.Flush()
+		}
+		if report.DryRun {
+			fmt.Printf("Dry run: %d files would be removed\n", len(report.Orphaned))
+		} else {
+			fmt.Printf("Removed: %d\n", report.Removed)
+		}
+		if len(report.Dangling) > 0 {
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "USER\tREASON\tURL")
+			for _, d := range report.Dangling {
+				fmt.Fprintf(w, "%d\t%s\t%s\n", d.UserID, d.Reason, d.URL)
+			}
+			w.Flush()
+		}
+	}); printErr != nil {
+		return printErr
+	}
+	return err
+}
+
+// openStorage - хранилище файлов из переменных окружения сервиса
+func openStorage() (storage.Storage, error) {
+	switch backend := os.Getenv("STORAGE_BACKEND"); backend {
+	case "s3":
+		// Подписанные ссылки сверке не нужны
+		return storage.NewS3Storage(os.Getenv("S3_ENDPOINT"), "", envOr("S3_REGION", "us-east-1"), os.Getenv("S3_BUCKET"),
+			os.Getenv("S3_ACCESS_KEY"), os.Getenv("S3_SECRET_KEY"), 0)
+	case "", "local":
+		return storage.NewLocalStorage(envOr("STORAGE_DIR", "./uploads"))
+	default:
+		return nil, fmt.Errorf("STORAGE_BACKEND must be local or s3, got %q", backend)
+	}
+}
+
+func envOr(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
@@ -0,0 +1,191 @@
+// hubigrctl - администрирование пользователей и сессий напрямую через БД:
+// первый админ, роли, баны, сброс пароля, отзыв сессий, сверка аватаров.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/RESERPIX/hubigr/internal/domain"
+	"github.com/RESERPIX/hubigr/internal/store"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const usage = `Usage: hubigrctl [-json] [-database-url URL] <command> [flags] [args]
+
+User is a numeric ID or an email.
+
+Commands:
+  user create -email E -nick N [-handle H] [-role R] [-locale L] [-verified] (-password-stdin | -password P)
+  user get <user>
+  user list [-limit N] [-offset N]
+  user set-role <user> <role>
+  user ban <user>                also revokes all sessions
+  user unban <user>
+  user reset-password <user>     queue a password reset email (sent by the running service)
+  session list [-all] <user>
+  session revoke [-id N] <user>  revoke one session or all sessions of the user
+  avatars reconcile [-dry-run] [-grace 24h]
+                                 remove unreferenced avatar files, report dangling references
+
+DATABASE_URL is used when -database-url is not set. avatars reconcile uses the
+service storage settings: STORAGE_BACKEND, STORAGE_DIR, S3_*.`
+
+// errUsage - неверные аргументы, код выхода 2
+var errUsage = errors.New("usage")
+
+// app - общее состояние команд
+type app struct {
+	users    *store.UserRepo
+	sessions *store.RefreshTokenRepo
+	delivery *store.EmailDeliveryRepo
+	json     bool
+}
+
+func main() {
+	os.Exit(runCLI(os.Args[1:]))
+}
+
+// runCLI выполняет команду и возвращает код выхода
+func runCLI(args []string) int {
+	global := flag.NewFlagSet("hubigrctl", flag.ContinueOnError)
+	global.Usage = func() { fmt.Fprintln(os.Stderr, usage) }
+	jsonOutput := global.Bool("json", false, "print JSON")
+	databaseURL := global.String("database-url", os.Getenv("DATABASE_URL"), "PostgreSQL URL")
+	if err := global.Parse(args); err != nil {
+		return 2
+	}
+	args = global.Args()
+	if len(args) < 2 {
+		global.Usage()
+		return 2
+	}
+	if *databaseURL == "" {
+		fmt.Fprintln(os.Stderr, "hubigrctl: DATABASE_URL is not set")
+		return 2
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	db, err := connect(ctx, *databaseURL)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "hubigrctl: connect to database:", err)
+		return 1
+	}
+	defer db.Close()
+
+	a := &app{
+		users:    store.NewUserRepo(db),
+		sessions: store.NewRefreshTokenRepo(db),
+		delivery: store.NewEmailDeliveryRepo(db),
+		json:     *jsonOutput,
+	}
+
+	err = a.run(ctx, args[0], args[1], args[2:])
+	if errors.Is(err, errUsage) {
+		global.Usage()
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "hubigrctl:", err)
+		return 1
+	}
+	return 0
+}
+
+func connect(ctx context.Context, databaseURL string) (*pgxpool.Pool, error) {
+	poolConfig, err := pgxpool.ParseConfig(databaseURL)
+	if err != nil {
+		return nil, err
+	}
+	poolConfig.MaxConns = 2
+	db, err := pgxpool.NewWithConfig(ctx, poolConfig)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Ping(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+func (a *app) run(ctx context.Context, group, command string, args []string) error {
+	switch group + " " + command {
+	case "user create":
+		return a.userCreate(ctx, args)
+	case "user get":
+		return a.userGet(ctx, args)
+	case "user list":
+		return a.userList(ctx, args)
+	case "user set-role":
+		return a.userSetRole(ctx, args)
+	case "user ban":
+		return a.userBan(ctx, args, true)
+	case "user unban":
+		return a.userBan(ctx, args, false)
+	case "user reset-password":
+		return a.userResetPassword(ctx, args)
+	case "session list":
+		return a.sessionList(ctx, args)
+	case "session revoke":
+		return a.sessionRevoke(ctx, args)
+	case "avatars reconcile":
+		return a.avatarsReconcile(ctx, args)
+	}
+	return errUsage
+}
+
+// resolveUser находит пользователя по ID или email
+func (a *app) resolveUser(ctx context.Context, ref string) (*domain.User, error) {
+	var (
+		user *domain.User
+		err  error
+	)
+	if strings.Contains(ref, "@") {
+		user, err = a.users.GetByEmail(ctx, ref)
+	} else {
+		id, parseErr := strconv.ParseInt(ref, 10, 64)
+		if parseErr != nil {
+			return nil, fmt.Errorf("user must be an ID or an email: %q", ref)
+		}
+		user, err = a.users.GetByID(ctx, id)
+	}
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("user %s not found", ref)
+	}
+	return user, err
+}
+
+// parse разбирает флаги подкоманды и проверяет число позиционных аргументов
+func parse(fs *flag.FlagSet, args []string, positional int) ([]string, error) {
+	fs.SetOutput(os.Stderr)
+	fs.Usage = func() {}
+	if err := fs.Parse(args); err != nil {
+		return nil, errUsage
+	}
+	if fs.NArg() != positional {
+		return nil, errUsage
+	}
+	return fs.Args(), nil
+}
+
+// print выводит v как JSON или вызывает text для текстового вывода
+func (a *app) print(v any, text func()) error {
+	if !a.json {
+		text()
+		return nil
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
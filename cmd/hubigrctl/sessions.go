@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+func (a *app) sessionList(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("session list", flag.ContinueOnError)
+	all := fs.Bool("all", false, "include revoked and expired sessions")
+	pos, err := parse(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	user, err := a.resolveUser(ctx, pos[0])
+	if err != nil {
+		return err
+	}
+	sessions, err := a.sessions.ListUserTokens(ctx, user.ID, *all)
+	if err != nil {
+		return err
+	}
+
+	return a.print(sessions, func() {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tCREATED\tEXPIRES\tREVOKED\tIP\tDEVICE")
+		for _, s := range sessions {
+			revoked, ip, device := "-", "-", "-"
+			if s.RevokedAt != nil {
+				revoked = s.RevokedAt.Format(time.RFC3339)
+			}
+			if s.IPAddress != nil {
+				ip = *s.IPAddress
+			}
+			if s.DeviceInfo != nil && *s.DeviceInfo != "" {
+				device = *s.DeviceInfo
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\n",
+				s.ID, s.CreatedAt.Format(time.RFC3339), s.ExpiresAt.Format(time.RFC3339), revoked, ip, device)
+		}
+		w.Flush()
+	})
+}
+
+// sessionRevoke отзывает refresh токены. Выданные access токены действуют до
+// истечения ACCESS_TOKEN_TTL.
+func (a *app) sessionRevoke(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("session revoke", flag.ContinueOnError)
+	id := fs.Int64("id", 0, "session ID from session list (default all sessions)")
+	pos, err := parse(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	user, err := a.resolveUser(ctx, pos[0])
+	if err != nil {
+		return err
+	}
+
+	if *id == 0 {
+		if err := a.sessions.RevokeUserTokens(ctx, user.ID); err != nil {
+			return err
+		}
+		return a.print(map[string]any{"user_id": user.ID, "revoked": "all"}, func() {
+			fmt.Printf("All sessions of user %d revoked\n", user.ID)
+		})
+	}
+
+	revoked, err := a.sessions.RevokeToken(ctx, user.ID, *id)
+	if err != nil {
+		return err
+	}
+	if !revoked {
+		return fmt.Errorf("session %d of user %d not found or already revoked", *id, user.ID)
+	}
+	return a.print(map[string]any{"user_id": user.ID, "revoked": *id}, func() {
+		fmt.Printf("Session %d of user %d revoked\n", *id, user.ID)
+	})
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/RESERPIX/hubigr/internal/domain"
+	"github.com/RESERPIX/hubigr/internal/security"
+	"github.com/RESERPIX/hubigr/internal/store"
+	"github.com/RESERPIX/hubigr/internal/validation"
+)
+
+func (a *app) userCreate(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("user create", flag.ContinueOnError)
+	email := fs.String("email", "", "email")
+	nick := fs.String("nick", "", "display name")
+	handle := fs.String("handle", "", "handle (default user<id>)")
+	role := fs.String("role", string(domain.RoleParticipant), "role")
+	locale := fs.String("locale", domain.DefaultLocale, "email and UI language")
+	verified := fs.Bool("verified", false, "mark email as verified, no verification email")
+	password := fs.String("password", "", "password (visible in ps and shell history, prefer -password-stdin)")
+	passwordStdin := fs.Bool("password-stdin", false, "read password from the first line of stdin")
+	if _, err := parse(fs, args, 0); err != nil {
+		return err
+	}
+	if *passwordStdin {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return fmt.Errorf("read password from stdin: %w", err)
+		}
+		*password = strings.TrimRight(line, "\r\n")
+	}
+	if !domain.IsValidRole(*role) {
+		return fmt.Errorf("unknown role %q", *role)
+	}
+
+	req := domain.SignUpRequest{
+		Email:           *email,
+		Password:        *password,
+		ConfirmPassword: *password,
+		Nick:            *nick,
+		Handle:          *handle,
+		Locale:          *locale,
+		// Пользователя создает оператор, а не он сам: согласие с условиями не требуется
+		AgreeTerms: true,
+	}
+	// Те же правила, что и при регистрации через API
+	if errs := validation.ValidateSignUp(req); len(errs) > 0 {
+		return fmt.Errorf("invalid user: %s", strings.Join(errs, "; "))
+	}
+	if *handle != "" {
+		available, err := a.users.IsHandleAvailable(ctx, *handle, 0)
+		if err != nil {
+			return err
+		}
+		if !available {
+			return fmt.Errorf("handle %q is already taken", *handle)
+		}
+	}
+
+	hash, err := security.HashPassword(*password)
+	if err != nil {
+		return err
+	}
+	// Как при регистрации: без -verified письмо со ссылкой уходит из outbox
+	var token string
+	if !*verified {
+		if token, err = security.GenerateToken(); err != nil {
+			return err
+		}
+	}
+	userID, err := a.users.ProvisionUser(ctx, req, hash, domain.Role(*role), *verified, token)
+	if err != nil {
+		if errors.Is(err, store.ErrEmailTaken) {
+			return fmt.Errorf("user with email %s already exists", req.Email)
+		}
+		if errors.Is(err, store.ErrHandleTaken) {
+			return fmt.Errorf("handle %q is already taken", req.Handle)
+		}
+		return err
+	}
+
+	return a.printUser(ctx, userID)
+}
+
+func (a *app) userGet(ctx context.Context, args []string) error {
+	pos, err := parse(flag.NewFlagSet("user get", flag.ContinueOnError), args, 1)
+	if err != nil {
+		return err
+	}
+	user, err := a.resolveUser(ctx, pos[0])
+	if err != nil {
+		return err
+	}
+	return a.printUser(ctx, user.ID)
+}
+
+func (a *app) userList(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("user list", flag.ContinueOnError)
+	limit := fs.Int("limit", 50, "page size")
+	offset := fs.Int("offset", 0, "offset")
+	if _, err := parse(fs, args, 0); err != nil {
+		return err
+	}
+	if *limit < 1 || *offset < 0 {
+		return errUsage
+	}
+
+	users, total, err := a.users.GetUsers(ctx, *limit, *offset)
+	if err != nil {
+		return err
+	}
+	return a.print(map[string]any{"users": users, "total": total}, func() {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tEMAIL\tHANDLE\tROLE\tVERIFIED\tBANNED\tCREATED")
+		for _, u := range users {
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%t\t%t\t%s\n",
+				u.ID, u.Email, u.Handle, u.Role, u.EmailVerified, u.IsBanned, u.CreatedAt.Format(time.DateOnly))
+		}
+		w.Flush()
+		fmt.Printf("%d of %d users\n", len(users), total)
+	})
+}
+
+func (a *app) userSetRole(ctx context.Context, args []string) error {
+	pos, err := parse(flag.NewFlagSet("user set-role", flag.ContinueOnError), args, 2)
+	if err != nil {
+		return err
+	}
+	if !domain.IsValidRole(pos[1]) {
+		return fmt.Errorf("unknown role %q", pos[1])
+	}
+	user, err := a.resolveUser(ctx, pos[0])
+	if err != nil {
+		return err
+	}
+	if err := a.users.UpdateUserRole(ctx, user.ID, pos[1]); err != nil {
+		return err
+	}
+	return a.printUser(ctx, user.ID)
+}
+
+// userBan - как PUT /api/v1/admin/users/:id/ban: бан отзывает все сессии
+func (a *app) userBan(ctx context.Context, args []string, banned bool) error {
+	pos, err := parse(flag.NewFlagSet("user ban", flag.ContinueOnError), args, 1)
+	if err != nil {
+		return err
+	}
+	user, err := a.resolveUser(ctx, pos[0])
+	if err != nil {
+		return err
+	}
+	if err := a.users.UpdateUserBanStatus(ctx, user.ID, banned); err != nil {
+		return err
+	}
+	if banned {
+		if err := a.sessions.RevokeUserTokens(ctx, user.ID); err != nil {
+			return err
+		}
+	}
+	return a.printUser(ctx, user.ID)
+}
+
+func (a *app) userResetPassword(ctx context.Context, args []string) error {
+	pos, err := parse(flag.NewFlagSet("user reset-password", flag.ContinueOnError), args, 1)
+	if err != nil {
+		return err
+	}
+	user, err := a.resolveUser(ctx, pos[0])
+	if err != nil {
+		return err
+	}
+	token, err := security.GenerateToken()
+	if err != nil {
+		return err
+	}
+	// Письмо ставится в outbox и уходит из работающего сервиса; ссылка действует час
+	if err := a.users.CreateResetToken(ctx, user.ID, user.Email, token); err != nil {
+		return err
+	}
+	return a.print(map[string]any{"user_id": user.ID, "email": user.Email, "queued": true}, func() {
+		fmt.Printf("Password reset email queued for %s\n", user.Email)
+	})
+}
+
+// printUser выводит пользователя, статус доставки писем и число действующих сессий
+func (a *app) printUser(ctx context.Context, userID int64) error {
+	user, err := a.users.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	delivery, err := a.delivery.GetDeliveryInfo(ctx, userID)
+	if err != nil {
+		return err
+	}
+	sessions, err := a.sessions.ListUserTokens(ctx, userID, false)
+	if err != nil {
+		return err
+	}
+
+	details := struct {
+		*domain.User
+		EmailDelivery  *domain.EmailDeliveryInfo `json:"email_delivery"`
+		ActiveSessions int                       `json:"active_sessions"`
+	}{user, delivery, len(sessions)}
+	return a.print(details, func() {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(w, "ID:\t%d\n", user.ID)
+		fmt.Fprintf(w, "Email:\t%s\n", user.Email)
+		fmt.Fprintf(w, "Nick:\t%s\n", user.Nick)
+		fmt.Fprintf(w, "Handle:\t%s\n", user.Handle)
+		fmt.Fprintf(w, "Role:\t%s\n", user.Role)
+		fmt.Fprintf(w, "Email verified:\t%t\n", user.EmailVerified)
+		fmt.Fprintf(w, "Email delivery:\t%s\n", delivery.Status)
+		fmt.Fprintf(w, "Banned:\t%t\n", user.IsBanned)
+		fmt.Fprintf(w, "Locale:\t%s\n", user.Locale)
+		fmt.Fprintf(w, "Created:\t%s\n", user.CreatedAt.Format(time.RFC3339))
+		fmt.Fprintf(w, "Active sessions:\t%d\n", len(sessions))
+		w.Flush()
+	})
+}
@@ -0,0 +1,69 @@
+package cleanup
+
+import (
+	"context"
+	"time"
+
+	"github.com/RESERPIX/hubigr/internal/logger"
+	"github.com/RESERPIX/hubigr/internal/scheduler"
+	"github.com/RESERPIX/hubigr/internal/store"
+	"github.com/RESERPIX/hubigr/internal/upload"
+)
+
+// Jobs - задачи очистки: истекшие токены, истекшие записи списка IP и
+// аватары, на которые никто не ссылается
+func Jobs(repo *store.CleanupRepo, avatars *upload.Reconciler, interval, refreshRetention time.Duration) []scheduler.Job {
+	return []scheduler.Job{
+		{
+			Name:     "expired_tokens",
+			Interval: interval,
+			Timeout:  5 * time.Minute,
+			Run: func(ctx context.Context) (scheduler.Removed, error) {
+				removed := scheduler.Removed{}
+				steps := []struct {
+					target string
+					run    func(context.Context) (int64, error)
+				}{
+					{"email_verify_tokens", repo.DeleteExpiredVerifyTokens},
+					{"password_reset_tokens", repo.DeleteExpiredResetTokens},
+					{"refresh_tokens", func(ctx context.Context) (int64, error) {
+						return repo.DeleteStaleRefreshTokens(ctx, refreshRetention)
+					}},
+				}
+				for _, step := range steps {
+					count, err := step.run(ctx)
+					removed[step.target] = count
+					if err != nil {
+						return removed, err
+					}
+				}
+				return removed, nil
+			},
+		},
+		{
+			Name:     "expired_ip_bans",
+			Interval: interval,
+			Timeout:  time.Minute,
+			Run: func(ctx context.Context) (scheduler.Removed, error) {
+				count, err := repo.DeleteExpiredACLEntries(ctx)
+				return scheduler.Removed{"rate_limit_acl": count}, err
+			},
+		},
+		{
+			Name:     "orphaned_avatars",
+			Interval: interval,
+			Timeout:  5 * time.Minute,
+			Run: func(ctx context.Context) (scheduler.Removed, error) {
+				report, err := avatars.Reconcile(ctx, false)
+				if report == nil {
+					return nil, err
+				}
+				if len(report.Dangling) > 0 {
+					// Ссылки на несуществующие файлы не исправляем автоматически
+					logger.Warn("Dangling avatar references", "count", len(report.Dangling))
+				}
+				return scheduler.Removed{"avatar_files": report.Removed}, err
+			},
+		},
+	}
+}
@@ -2,8 +2,13 @@ package config
 
 import (
 	"fmt"
+	"net"
 	"os"
+	"strconv"
+	"strings"
 
+	"github.com/RESERPIX/hubigr/internal/ratelimit"
+	"github.com/RESERPIX/hubigr/internal/utils"
 	"github.com/joho/godotenv"
 )
 
@@ -17,13 +22,67 @@ type Config struct {
 	SMTPUser          string
 	SMTPPass          string
 	SMTPFrom          string
+	SMTPTLS           string // starttls, implicit или none
+	// Транспорт писем: smtp, http (API, совместимое с SES), maildir или mock
+	EmailTransport    string
+	EmailAPIEndpoint  string
+	EmailAPIRegion    string
+	EmailAPIAccessKey string
+	EmailAPISecretKey string
+	EmailMaildir      string
+	EmailWebhookSecret string // Секрет webhook уведомлений о bounce/complaint
+	// Лимиты запросов по маршрутам (переопределяют значения по умолчанию)
+	RateLimits        ratelimit.Policies
 	BaseURL           string
+	AvatarWebP        bool // Сохранять аватары в WebP (lossless) вместо JPEG/PNG
+	// Хранилище загруженных файлов
+	StorageBackend    string // local или s3
+	StorageDir        string // Каталог для local
+	S3Endpoint        string
+	S3PublicEndpoint  string // Адрес хранилища для клиентов в подписанных ссылках; пустой - S3Endpoint
+	S3Region          string
+	S3Bucket          string
+	S3AccessKey       string
+	S3SecretKey       string
+	S3PresignTTL      int // Время жизни подписанных ссылок на скачивание в секундах
 	LogLevel          string
 	TurnstileSecret   string
 	CORSOrigins       string
+	InternalAPIToken  string // Токен для внутреннего API других сервисов
+	// Прокси, которым доверяем адрес клиента из заголовка (KrakenD, балансировщик)
+	TrustedProxies    *utils.TrustedProxies
 	// TTL Policies - Политики времени жизни токенов
 	AccessTokenTTL    int // Access token TTL в минутах (5-15 мин)
 	RefreshTokenTTL   int // Refresh token TTL в днях (7-30 дней)
+	// Email-дайджесты
+	DigestCheckInterval int // Интервал проверки дайджестов в минутах
+	// Фоновая отправка писем
+	EmailWorkers      int // Количество воркеров отправки
+	EmailPollInterval int // Интервал опроса outbox в секундах
+	EmailTemplatesDir string // Каталог с шаблонами писем, переопределяющими встроенные
+	// Трейсинг OpenTelemetry
+	OTLPEndpoint      string  // Адрес OTLP/HTTP коллектора; пустой - экспорт выключен
+	ServiceName       string  // service.name в трейсах
+	TraceSampleRatio  float64 // Доля записываемых трейсов без решения от KrakenD (0-1)
+	// Мониторинг и алерты
+	PoolMonitorInterval  int      // Интервал записи статистики pools в лог в секундах
+	ReadinessCacheTTL    int      // Сколько секунд /readyz отдает последний результат проверок
+	ShutdownDrainDelay   int      // Сколько секунд после SIGTERM /readyz отдает 503 до остановки HTTP сервера
+	AlertCheckInterval   int      // Интервал проверки правил алертов в секундах
+	AlertCooldown        int      // Минимальный интервал между повторами одного алерта в минутах
+	AlertFailedLogins    int      // Порог неудачных входов за 5 минут
+	AlertWebhookURL      string   // Webhook, получающий алерты в JSON
+	AlertSlackWebhookURL string   // Slack-совместимый incoming webhook
+	AlertEmailTo         []string // Адреса дежурных для писем об алертах
+	// Внутренний listener с метриками и pprof
+	DiagnosticsAddr       string // Адрес listener, по умолчанию только loopback; off - выключен
+	DiagnosticsToken      string // Bearer токен для доступа; пустой - без токена
+	DiagnosticsAllowedIPs string // IP и подсети через запятую; пустой - любые адреса
+	// Миграции и фоновые задачи
+	MigrateOnStart         bool // Применять миграции при запуске
+	CleanupInterval        int  // Интервал задач очистки в минутах
+	RefreshTokenRetention  int  // Сколько дней хранить отозванные refresh токены
+	AvatarOrphanGraceHours int  // Через сколько часов удалять файл аватара без ссылки из БД
 }
 
 func Load() (*Config, error) {
@@ -42,13 +101,54 @@ func Load() (*Config, error) {
 		SMTPUser:    getEnv("SMTP_USER", ""),
 		SMTPPass:    getEnv("SMTP_PASS", ""),
 		SMTPFrom:    getEnv("SMTP_FROM", "noreply@hubigr.com"),
+		SMTPTLS:     getEnv("SMTP_TLS", ""),
+		EmailTransport:    getEnv("EMAIL_TRANSPORT", ""),
+		EmailAPIEndpoint:  getEnv("EMAIL_API_ENDPOINT", ""),
+		EmailAPIRegion:    getEnv("EMAIL_API_REGION", "us-east-1"),
+		EmailAPIAccessKey: getEnv("EMAIL_API_ACCESS_KEY", ""),
+		EmailAPISecretKey: getEnv("EMAIL_API_SECRET_KEY", ""),
+		EmailMaildir:      getEnv("EMAIL_MAILDIR", "./tmp/maildir"),
+		EmailWebhookSecret: getEnv("EMAIL_WEBHOOK_SECRET", ""),
 		BaseURL:         getEnv("BASE_URL", "http://localhost:3000"),
+		AvatarWebP:      getEnvBool("AVATAR_WEBP", false),
+		StorageBackend:   getEnv("STORAGE_BACKEND", "local"),
+		StorageDir:       getEnv("STORAGE_DIR", "./uploads"),
+		S3Endpoint:       getEnv("S3_ENDPOINT", ""),
+		S3PublicEndpoint: getEnv("S3_PUBLIC_ENDPOINT", ""),
+		S3Region:         getEnv("S3_REGION", "us-east-1"),
+		S3Bucket:         getEnv("S3_BUCKET", ""),
+		S3AccessKey:      getEnv("S3_ACCESS_KEY", ""),
+		S3SecretKey:      getEnv("S3_SECRET_KEY", ""),
+		S3PresignTTL:     getEnvInt("S3_PRESIGN_TTL", 900),
 		LogLevel:        getEnv("LOG_LEVEL", "info"),
 		TurnstileSecret: getEnv("TURNSTILE_SECRET", ""),
 		CORSOrigins:     getEnv("CORS_ORIGINS", "http://localhost:3000"),
+		InternalAPIToken: getEnv("INTERNAL_API_TOKEN", ""),
 		// TTL Policies
 		AccessTokenTTL:  getEnvInt("ACCESS_TOKEN_TTL", 15),  // 15 минут по умолчанию
 		RefreshTokenTTL: getEnvInt("REFRESH_TOKEN_TTL", 7),  // 7 дней по умолчанию
+		DigestCheckInterval: getEnvInt("DIGEST_CHECK_INTERVAL", 10), // 10 минут по умолчанию
+		EmailWorkers:        getEnvInt("EMAIL_WORKERS", 2),
+		EmailPollInterval:   getEnvInt("EMAIL_POLL_INTERVAL", 2), // 2 секунды по умолчанию
+		EmailTemplatesDir:   getEnv("EMAIL_TEMPLATES_DIR", ""),
+		OTLPEndpoint:        getEnv("OTEL_EXPORTER_OTLP_ENDPOINT", ""),
+		ServiceName:         getEnv("OTEL_SERVICE_NAME", "hubigr-auth"),
+		TraceSampleRatio:    getEnvFloat("OTEL_TRACES_SAMPLER_ARG", 1),
+		PoolMonitorInterval:  getEnvInt("POOL_MONITOR_INTERVAL", 60),
+		ReadinessCacheTTL:    getEnvInt("READINESS_CACHE_TTL", 2),
+		ShutdownDrainDelay:   getEnvInt("SHUTDOWN_DRAIN_DELAY", 5),
+		MigrateOnStart:       getEnvBool("MIGRATE_ON_START", false),
+		CleanupInterval:        getEnvInt("CLEANUP_INTERVAL", 60),
+		RefreshTokenRetention:  getEnvInt("REFRESH_TOKEN_RETENTION", 7),
+		AvatarOrphanGraceHours: getEnvInt("AVATAR_ORPHAN_GRACE", 24),
+		DiagnosticsAddr:       getEnv("DIAGNOSTICS_ADDR", "127.0.0.1:9091"),
+		DiagnosticsToken:      getEnv("DIAGNOSTICS_TOKEN", ""),
+		DiagnosticsAllowedIPs: getEnv("DIAGNOSTICS_ALLOWED_IPS", ""),
+		AlertCheckInterval:   getEnvInt("ALERT_CHECK_INTERVAL", 30),
+		AlertCooldown:        getEnvInt("ALERT_COOLDOWN", 30),
+		AlertFailedLogins:    getEnvInt("ALERT_FAILED_LOGINS", 50),
+		AlertWebhookURL:      getEnv("ALERT_WEBHOOK_URL", ""),
+		AlertSlackWebhookURL: getEnv("ALERT_SLACK_WEBHOOK_URL", ""),
 	}
 	
 	// Проверка критически важных настроек только в продакшене
@@ -72,6 +172,147 @@ func Load() (*Config, error) {
 		return nil, fmt.Errorf("REFRESH_TOKEN_TTL must be between 7-30 days")
 	}
 	
+	if cfg.EmailWorkers < 1 || cfg.EmailWorkers > 32 {
+		return nil, fmt.Errorf("EMAIL_WORKERS must be between 1-32")
+	}
+	if cfg.EmailPollInterval < 1 {
+		return nil, fmt.Errorf("EMAIL_POLL_INTERVAL must be at least 1 second")
+	}
+	if cfg.DigestCheckInterval < 1 {
+		return nil, fmt.Errorf("DIGEST_CHECK_INTERVAL must be at least 1 minute")
+	}
+	if cfg.TraceSampleRatio < 0 || cfg.TraceSampleRatio > 1 {
+		return nil, fmt.Errorf("OTEL_TRACES_SAMPLER_ARG must be between 0-1")
+	}
+	if cfg.PoolMonitorInterval < 1 {
+		return nil, fmt.Errorf("POOL_MONITOR_INTERVAL must be at least 1 second")
+	}
+	if cfg.ReadinessCacheTTL < 0 {
+		return nil, fmt.Errorf("READINESS_CACHE_TTL must not be negative")
+	}
+	if cfg.ShutdownDrainDelay < 0 || cfg.ShutdownDrainDelay > 60 {
+		return nil, fmt.Errorf("SHUTDOWN_DRAIN_DELAY must be between 0-60 seconds")
+	}
+	if cfg.DiagnosticsAddr != "off" {
+		host, _, err := net.SplitHostPort(cfg.DiagnosticsAddr)
+		if err != nil {
+			return nil, fmt.Errorf("DIAGNOSTICS_ADDR must be host:port or off")
+		}
+		if cfg.DiagnosticsAddr == ":"+cfg.Port {
+			return nil, fmt.Errorf("DIAGNOSTICS_ADDR must differ from PORT")
+		}
+		// pprof отдает дампы памяти: снаружи loopback в продакшене только с защитой
+		loopback := host == "localhost"
+		if ip := net.ParseIP(host); ip != nil {
+			loopback = ip.IsLoopback()
+		}
+		if getEnv("ENV", "development") == "production" && !loopback &&
+			cfg.DiagnosticsToken == "" && cfg.DiagnosticsAllowedIPs == "" {
+			return nil, fmt.Errorf("DIAGNOSTICS_TOKEN or DIAGNOSTICS_ALLOWED_IPS must be set in production when DIAGNOSTICS_ADDR is not loopback")
+		}
+	}
+	if cfg.CleanupInterval < 1 {
+		return nil, fmt.Errorf("CLEANUP_INTERVAL must be at least 1 minute")
+	}
+	if cfg.RefreshTokenRetention < 0 {
+		return nil, fmt.Errorf("REFRESH_TOKEN_RETENTION must not be negative")
+	}
+	if cfg.AvatarOrphanGraceHours < 1 {
+		return nil, fmt.Errorf("AVATAR_ORPHAN_GRACE must be at least 1 hour")
+	}
+	if cfg.AlertCheckInterval < 1 {
+		return nil, fmt.Errorf("ALERT_CHECK_INTERVAL must be at least 1 second")
+	}
+	if cfg.AlertCooldown < 1 {
+		return nil, fmt.Errorf("ALERT_COOLDOWN must be at least 1 minute")
+	}
+	if cfg.AlertFailedLogins < 1 {
+		return nil, fmt.Errorf("ALERT_FAILED_LOGINS must be at least 1")
+	}
+	for key, url := range map[string]string{"ALERT_WEBHOOK_URL": cfg.AlertWebhookURL, "ALERT_SLACK_WEBHOOK_URL": cfg.AlertSlackWebhookURL} {
+		if url != "" && !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+			return nil, fmt.Errorf("%s must be an http:// or https:// URL", key)
+		}
+	}
+	for _, addr := range strings.Split(getEnv("ALERT_EMAIL_TO", ""), ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			cfg.AlertEmailTo = append(cfg.AlertEmailTo, addr)
+		}
+	}
+	if cfg.OTLPEndpoint != "" && !strings.HasPrefix(cfg.OTLPEndpoint, "http://") && !strings.HasPrefix(cfg.OTLPEndpoint, "https://") {
+		return nil, fmt.Errorf("OTEL_EXPORTER_OTLP_ENDPOINT must be an http:// or https:// URL")
+	}
+
+	// Без явного выбора: SMTP, если он настроен, иначе mock как раньше
+	if cfg.EmailTransport == "" {
+		cfg.EmailTransport = "mock"
+		if cfg.SMTPHost != "" {
+			cfg.EmailTransport = "smtp"
+		}
+	}
+	// Порт 465 - TLS с самого подключения, остальные - STARTTLS
+	if cfg.SMTPTLS == "" {
+		cfg.SMTPTLS = "starttls"
+		if cfg.SMTPPort == "465" {
+			cfg.SMTPTLS = "implicit"
+		}
+	}
+	switch cfg.EmailTransport {
+	case "smtp":
+		if cfg.SMTPHost == "" {
+			return nil, fmt.Errorf("SMTP_HOST is required for EMAIL_TRANSPORT=smtp")
+		}
+		if cfg.SMTPTLS != "starttls" && cfg.SMTPTLS != "implicit" && cfg.SMTPTLS != "none" {
+			return nil, fmt.Errorf("SMTP_TLS must be starttls, implicit or none")
+		}
+	case "http":
+		if cfg.EmailAPIEndpoint == "" {
+			return nil, fmt.Errorf("EMAIL_API_ENDPOINT is required for EMAIL_TRANSPORT=http")
+		}
+		if (cfg.EmailAPIAccessKey == "") != (cfg.EmailAPISecretKey == "") {
+			return nil, fmt.Errorf("EMAIL_API_ACCESS_KEY and EMAIL_API_SECRET_KEY must be set together")
+		}
+	case "maildir", "mock":
+	default:
+		return nil, fmt.Errorf("EMAIL_TRANSPORT must be smtp, http, maildir or mock")
+	}
+	switch cfg.StorageBackend {
+	case "local":
+		if cfg.StorageDir == "" {
+			return nil, fmt.Errorf("STORAGE_DIR is required for STORAGE_BACKEND=local")
+		}
+	case "s3":
+		if cfg.S3Endpoint == "" || cfg.S3Bucket == "" {
+			return nil, fmt.Errorf("S3_ENDPOINT and S3_BUCKET are required for STORAGE_BACKEND=s3")
+		}
+		if cfg.S3AccessKey == "" || cfg.S3SecretKey == "" {
+			return nil, fmt.Errorf("S3_ACCESS_KEY and S3_SECRET_KEY are required for STORAGE_BACKEND=s3")
+		}
+		// Редирект на ссылку кешируется на минуту; SigV4 допускает не больше 7 дней
+		if cfg.S3PresignTTL < 120 || cfg.S3PresignTTL > 7*24*3600 {
+			return nil, fmt.Errorf("S3_PRESIGN_TTL must be between 120 and 604800 seconds")
+		}
+	default:
+		return nil, fmt.Errorf("STORAGE_BACKEND must be local or s3")
+	}
+	rateLimits, err := ratelimit.ParsePolicies(getEnv("RATE_LIMITS", ""), ratelimit.Algorithm(getEnv("RATE_LIMIT_ALGORITHM", string(ratelimit.DefaultAlgorithm))))
+	if err != nil {
+		return nil, fmt.Errorf("RATE_LIMITS: %w", err)
+	}
+	if err := rateLimits.SetFailureModes(getEnv("RATE_LIMIT_ON_FAILURE", "")); err != nil {
+		return nil, fmt.Errorf("RATE_LIMIT_ON_FAILURE: %w", err)
+	}
+	cfg.RateLimits = rateLimits
+	trustedProxies, err := utils.ParseTrustedProxies(getEnv("TRUSTED_PROXIES", ""), getEnv("CLIENT_IP_HEADER", utils.ClientIPHeaderXForwardedFor))
+	if err != nil {
+		return nil, fmt.Errorf("TRUSTED_PROXIES/CLIENT_IP_HEADER: %w", err)
+	}
+	cfg.TrustedProxies = trustedProxies
+
+	if getEnv("ENV", "development") == "production" && (cfg.EmailTransport == "mock" || cfg.EmailTransport == "maildir") {
+		return nil, fmt.Errorf("EMAIL_TRANSPORT=%s is not allowed in production", cfg.EmailTransport)
+	}
+	
 	return cfg, nil
 }
 
@@ -89,4 +330,22 @@ func getEnvInt(key string, defaultValue int) int {
 		}
 	}
 	return defaultValue
-}
\ No newline at end of file
+}
+
+func getEnvBool(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if boolVal, err := strconv.ParseBool(value); err == nil {
+			return boolVal
+		}
+	}
+	return defaultValue
+}
+
+func getEnvFloat(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if floatVal, err := strconv.ParseFloat(value, 64); err == nil {
+			return floatVal
+		}
+	}
+	return defaultValue
+}
@@ -0,0 +1,129 @@
+package diagnostics
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/RESERPIX/hubigr/internal/logger"
+	"github.com/RESERPIX/hubigr/internal/metrics"
+)
+
+// Server - внутренний HTTP listener с метриками и pprof. Работает на отдельном
+// адресе, который не публикуется наружу и не проксируется KrakenD.
+type Server struct {
+	server  *http.Server
+	token   string
+	allowed []netip.Prefix
+}
+
+// NewServer создает listener на addr. Если задан token, запросы должны нести
+// "Authorization: Bearer <token>"; если задан allowlist (IP и подсети через
+// запятую), принимаются только запросы с этих адресов.
+func NewServer(addr, token, allowlist string) (*Server, error) {
+	s := &Server{token: token}
+	for _, entry := range strings.Split(allowlist, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		prefix, err := parsePrefix(entry)
+		if err != nil {
+			return nil, err
+		}
+		s.allowed = append(s.allowed, prefix)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	mux.Handle("/metrics/json", metrics.SnapshotHandler())
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	s.server = &http.Server{
+		Addr:              addr,
+		Handler:           s.protect(mux),
+		ReadHeaderTimeout: 5 * time.Second,
+		// Без WriteTimeout: /debug/pprof/profile и trace пишут ответ десятки секунд
+	}
+	return s, nil
+}
+
+// Protected - включена ли проверка токена или адреса
+func (s *Server) Protected() bool {
+	return s.token != "" || len(s.allowed) > 0
+}
+
+// Start принимает соединения до Stop
+func (s *Server) Start() {
+	if err := s.server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		logger.Error("Diagnostics listener stopped", "addr", s.server.Addr, "error", err)
+	}
+}
+
+// Stop дожидается текущих запросов в пределах ctx
+func (s *Server) Stop(ctx context.Context) error {
+	return s.server.Shutdown(ctx)
+}
+
+func (s *Server) protect(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(s.allowed) > 0 && !s.allowedAddr(r.RemoteAddr) {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		if s.token != "" {
+			token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) allowedAddr(remote string) bool {
+	host, _, err := net.SplitHostPort(remote)
+	if err != nil {
+		host = remote
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, p := range s.allowed {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+func parsePrefix(entry string) (netip.Prefix, error) {
+	if strings.Contains(entry, "/") {
+		p, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("invalid CIDR %q", entry)
+		}
+		return p.Masked(), nil
+	}
+	addr, err := netip.ParseAddr(entry)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("invalid IP %q", entry)
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
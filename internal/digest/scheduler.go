@@ -0,0 +1,99 @@
+package digest
+
+import (
+	"context"
+	"net/url"
+	"time"
+
+	"github.com/RESERPIX/hubigr/internal/domain"
+	"github.com/RESERPIX/hubigr/internal/email"
+	"github.com/RESERPIX/hubigr/internal/logger"
+	"github.com/RESERPIX/hubigr/internal/security"
+	"github.com/RESERPIX/hubigr/internal/store"
+)
+
+// maxDigestsPerRun - ограничение дайджестов за один проход
+const maxDigestsPerRun = 200
+
+// Scheduler периодически собирает накопленные события пользователей в email-дайджесты
+// и ставит их в outbox; отправкой занимается outbox.Worker
+type Scheduler struct {
+	repo     *store.NotificationRepo
+	baseURL  string
+	secret   string
+	interval time.Duration
+	stopCh   chan struct{}
+}
+
+// NewScheduler создает планировщик дайджестов
+func NewScheduler(repo *store.NotificationRepo, baseURL, secret string, interval time.Duration) *Scheduler {
+	return &Scheduler{
+		repo:     repo,
+		baseURL:  baseURL,
+		secret:   secret,
+		interval: interval,
+		stopCh:   make(chan struct{}),
+	}
+}
+
+// Start запускает периодическую отправку дайджестов
+func (s *Scheduler) Start(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.RunOnce(ctx)
+		case <-s.stopCh:
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Stop останавливает планировщик
+func (s *Scheduler) Stop() {
+	close(s.stopCh)
+}
+
+// RunOnce собирает дайджесты всем пользователям, у которых подошел срок
+func (s *Scheduler) RunOnce(ctx context.Context) {
+	queued := 0
+	for queued < maxDigestsPerRun {
+		processed, err := s.repo.ProcessDueDigest(ctx, s.build)
+		if err != nil {
+			logger.Error("Failed to process email digest", "error", err)
+			return
+		}
+		if !processed {
+			break
+		}
+		queued++
+	}
+	if queued > 0 {
+		logger.Info("Email digests queued", "count", queued)
+	}
+}
+
+func (s *Scheduler) build(rcpt store.DigestRecipient, items []domain.Notification, total int) any {
+	return email.Digest{
+		Frequency:      rcpt.Frequency,
+		Locale:         rcpt.Locale,
+		Items:          items,
+		Total:          total,
+		UnsubscribeURL: s.unsubscribeURL(rcpt.UserID, domain.UnsubscribeAll),
+		UnsubscribeTypeURLs: map[domain.NotificationType]string{
+			domain.NotificationNewGame:  s.unsubscribeURL(rcpt.UserID, string(domain.NotificationNewGame)),
+			domain.NotificationNewBuild: s.unsubscribeURL(rcpt.UserID, string(domain.NotificationNewBuild)),
+			domain.NotificationNewPost:  s.unsubscribeURL(rcpt.UserID, string(domain.NotificationNewPost)),
+		},
+	}
+}
+
+// unsubscribeURL - подписанная ссылка отписки, работает без входа в аккаунт
+func (s *Scheduler) unsubscribeURL(userID int64, kind string) string {
+	token := security.SignUnsubscribeToken(userID, kind, s.secret)
+	return s.baseURL + "/api/v1/notifications/unsubscribe?token=" + url.QueryEscape(token)
+}
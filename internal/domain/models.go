@@ -1,6 +1,11 @@
 package domain
 
-import "time"
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+)
 
 // User - DM-3.1 из ТЗ
 type User struct {
@@ -9,13 +14,16 @@ type User struct {
 	Hash            string                 `json:"-"`
 	Role            Role                   `json:"role"`
 	Nick            string                 `json:"nick"`
+	Handle          string                 `json:"handle"`
 	Avatar          *string                `json:"avatar,omitempty"`
+	Avatars         map[string]string      `json:"avatars,omitempty"`
 	Bio             *string                `json:"bio,omitempty"`
 	Links           []Link                 `json:"links,omitempty"`
 	IsBanned        bool                   `json:"is_banned"`
 	EmailVerified   bool                   `json:"email_verified"`
 	CreatedAt       time.Time              `json:"created_at"`
 	PrivacySettings PrivacySettings        `json:"privacy_settings"`
+	Locale          string                 `json:"locale"`
 }
 
 type Role string
@@ -28,6 +36,81 @@ const (
 	RoleOrganizer   Role = "organizer"
 )
 
+// IsValidRole проверяет, что роль существует
+func IsValidRole(role string) bool {
+	switch Role(role) {
+	case RoleParticipant, RoleJury, RoleModerator, RoleAdmin, RoleOrganizer:
+		return true
+	}
+	return false
+}
+
+// Поддерживаемые языки писем и интерфейса
+const (
+	LocaleRU      = "ru"
+	LocaleEN      = "en"
+	DefaultLocale = LocaleRU
+)
+
+// IsSupportedLocale проверяет, есть ли переводы для языка
+func IsSupportedLocale(locale string) bool {
+	return locale == LocaleRU || locale == LocaleEN
+}
+
+// NormalizeLocale возвращает язык по умолчанию для пустых и неподдерживаемых значений
+func NormalizeLocale(locale string) string {
+	if IsSupportedLocale(locale) {
+		return locale
+	}
+	return DefaultLocale
+}
+
+// HandleChangeCooldownDays - минимальный интервал между сменами хэндла
+const HandleChangeCooldownDays = 30
+
+// AvatarRef - ссылка пользователя на файл аватара
+type AvatarRef struct {
+	UserID int64  `json:"user_id"`
+	URL    string `json:"url"`
+}
+
+// AvatarSizes - стороны квадратных вариантов аватара в пикселях по возрастанию.
+// В users.avatar хранится URL самого большого.
+var AvatarSizes = []int{64, 128, 256}
+
+// AvatarVariants - URL всех размеров аватара по основному URL
+// (<база>_256.<ext>), ключ - сторона в пикселях. Для аватаров, загруженных
+// до появления размеров, и чужих ссылок возвращает nil.
+func AvatarVariants(avatar *string) map[string]string {
+	if avatar == nil || !strings.Contains(*avatar, "/uploads/avatars/") {
+		return nil
+	}
+	largest := "_" + strconv.Itoa(AvatarSizes[len(AvatarSizes)-1])
+	dot := strings.LastIndex(*avatar, ".")
+	if dot < 0 || !strings.HasSuffix((*avatar)[:dot], largest) {
+		return nil
+	}
+	base, ext := (*avatar)[:dot-len(largest)], (*avatar)[dot:]
+
+	variants := make(map[string]string, len(AvatarSizes))
+	for _, size := range AvatarSizes {
+		variants[strconv.Itoa(size)] = base + "_" + strconv.Itoa(size) + ext
+	}
+	return variants
+}
+
+// PublicProfile - публичный профиль, доступный по хэндлу
+type PublicProfile struct {
+	ID        int64     `json:"id"`
+	Handle    string    `json:"handle"`
+	Nick      string    `json:"nick"`
+	Avatar    *string           `json:"avatar,omitempty"`
+	Avatars   map[string]string `json:"avatars,omitempty"`
+	Bio       *string           `json:"bio,omitempty"`
+	Links     []Link            `json:"links,omitempty"`
+	CreatedAt time.Time         `json:"created_at"`
+}
+
 type Link struct {
 	Label string `json:"label"`
 	URL   string `json:"url"`
@@ -40,16 +123,51 @@ type PrivacySettings struct {
 
 // NotificationSettings - DM-3.15 из ТЗ
 type NotificationSettings struct {
-	UserID   int64    `json:"user_id"`
-	NewGame  bool     `json:"new_game"`
-	NewBuild bool     `json:"new_build"`
-	NewPost  bool     `json:"new_post"`
-	Channels Channels `json:"channels"`
+	UserID      int64           `json:"user_id"`
+	NewGame     bool            `json:"new_game"`
+	NewBuild    bool            `json:"new_build"`
+	NewPost     bool            `json:"new_post"`
+	Channels    Channels        `json:"channels"`
+	EmailDigest DigestFrequency `json:"email_digest"`
+}
+
+// DigestFrequency - периодичность email-дайджеста
+type DigestFrequency string
+
+const (
+	DigestDaily  DigestFrequency = "daily"
+	DigestWeekly DigestFrequency = "weekly"
+)
+
+// Interval возвращает минимальный интервал между дайджестами
+func (f DigestFrequency) Interval() time.Duration {
+	if f == DigestWeekly {
+		return 7 * 24 * time.Hour
+	}
+	return 24 * time.Hour
+}
+
+// IsValid проверяет периодичность дайджеста
+func (f DigestFrequency) IsValid() bool {
+	return f == DigestDaily || f == DigestWeekly
 }
 
 type Channels struct {
 	InApp bool  `json:"in_app"`
 	Email *bool `json:"email,omitempty"`
+	// EmailOptOut - типы событий, которые не попадают в email-дайджест,
+	// оставаясь во входящих (отписка по ссылке из письма)
+	EmailOptOut []NotificationType `json:"email_opt_out,omitempty"`
+}
+
+// EmailOptedOut проверяет, отписан ли пользователь от писем о событиях типа t
+func (c Channels) EmailOptedOut(t NotificationType) bool {
+	for _, optOut := range c.EmailOptOut {
+		if optOut == t {
+			return true
+		}
+	}
+	return false
 }
 
 // DefaultChannels возвращает дефолтные настройки каналов
@@ -67,7 +185,184 @@ func DefaultNotificationSettings(userID int64) NotificationSettings {
 		NewBuild: true,
 		NewPost:  true,
 		Channels: DefaultChannels(),
+		EmailDigest: DigestDaily,
+	}
+}
+
+// NotificationType - тип события, на которое можно подписаться в NotificationSettings
+type NotificationType string
+
+const (
+	NotificationNewGame  NotificationType = "new_game"
+	NotificationNewBuild NotificationType = "new_build"
+	NotificationNewPost  NotificationType = "new_post"
+)
+
+// IsValid проверяет, что тип уведомления известен
+func (t NotificationType) IsValid() bool {
+	switch t {
+	case NotificationNewGame, NotificationNewBuild, NotificationNewPost:
+		return true
+	}
+	return false
+}
+
+// Notification - элемент входящих уведомлений пользователя
+type Notification struct {
+	ID        int64            `json:"id"`
+	UserID    int64            `json:"user_id"`
+	Type      NotificationType `json:"type"`
+	Title     string           `json:"title"`
+	Body      *string          `json:"body,omitempty"`
+	Link      *string          `json:"link,omitempty"`
+	Payload   json.RawMessage  `json:"payload,omitempty"`
+	CreatedAt time.Time        `json:"created_at"`
+	ReadAt    *time.Time       `json:"read_at,omitempty"`
+	// InApp - показывается ли во входящих (иначе событие хранится только для дайджеста)
+	InApp bool `json:"-"`
+}
+
+// EmailKind - тип письма в outbox
+type EmailKind string
+
+const (
+	EmailKindVerification  EmailKind = "verification"
+	EmailKindPasswordReset EmailKind = "password_reset"
+	EmailKindDigest        EmailKind = "digest"
+)
+
+// EmailStatus - состояние письма в outbox
+type EmailStatus string
+
+const (
+	EmailStatusPending EmailStatus = "pending"
+	EmailStatusSending EmailStatus = "sending"
+	EmailStatusSent    EmailStatus = "sent"
+	// EmailStatusDead - попытки исчерпаны, письмо ждет ручного повтора
+	EmailStatusDead EmailStatus = "dead"
+	// EmailStatusSuppressed - адрес в списке подавления, письмо не отправлялось
+	EmailStatusSuppressed EmailStatus = "suppressed"
+	// EmailStatusCancelled - токен письма заменен новым или истек, письмо не отправлялось
+	EmailStatusCancelled EmailStatus = "cancelled"
+)
+
+// IsValid проверяет статус письма
+func (s EmailStatus) IsValid() bool {
+	switch s {
+	case EmailStatusPending, EmailStatusSending, EmailStatusSent, EmailStatusDead, EmailStatusSuppressed, EmailStatusCancelled:
+		return true
 	}
+	return false
+}
+
+// OutboxEmail - письмо в очереди отправки
+type OutboxEmail struct {
+	ID            int64       `json:"id"`
+	Kind          EmailKind   `json:"kind"`
+	Recipient     string      `json:"recipient"`
+	Status        EmailStatus `json:"status"`
+	Attempts      int         `json:"attempts"`
+	MaxAttempts   int         `json:"max_attempts"`
+	NextAttemptAt time.Time   `json:"next_attempt_at"`
+	LastError     *string     `json:"last_error,omitempty"`
+	CreatedAt     time.Time   `json:"created_at"`
+	SentAt        *time.Time  `json:"sent_at,omitempty"`
+	// Payload содержит токены - наружу не отдаем
+	Payload json.RawMessage `json:"-"`
+}
+
+// DeliveryEventType - тип уведомления от почтового провайдера
+type DeliveryEventType string
+
+const (
+	DeliveryEventBounce    DeliveryEventType = "bounce"
+	DeliveryEventComplaint DeliveryEventType = "complaint"
+)
+
+// BounceType - hard: адрес не существует, soft: временная ошибка (ящик переполнен и т.п.)
+type BounceType string
+
+const (
+	BounceHard BounceType = "hard"
+	BounceSoft BounceType = "soft"
+)
+
+// SoftBounceLimit - после стольких soft bounce за SoftBounceWindowDays адрес подавляется
+const (
+	SoftBounceLimit      = 3
+	SoftBounceWindowDays = 7
+)
+
+// DeliveryEvent - bounce или жалоба на письмо
+type DeliveryEvent struct {
+	ID         int64             `json:"id"`
+	Type       DeliveryEventType `json:"type"`
+	Email      string            `json:"email"`
+	BounceType *BounceType       `json:"bounce_type,omitempty"`
+	Detail     string            `json:"detail,omitempty"`
+	Source     string            `json:"source"`
+	CreatedAt  time.Time         `json:"created_at"`
+}
+
+// EmailDeliveryStatus - статус доставки писем пользователю
+type EmailDeliveryStatus string
+
+const (
+	EmailDeliveryOK         EmailDeliveryStatus = "ok"
+	EmailDeliverySoftBounce EmailDeliveryStatus = "soft_bounce"
+	EmailDeliveryBounced    EmailDeliveryStatus = "bounced"
+	EmailDeliveryComplained EmailDeliveryStatus = "complained"
+)
+
+// EmailSuppression - адрес, на который письма не отправляются
+type EmailSuppression struct {
+	Reason    DeliveryEventType `json:"reason"`
+	Detail    *string           `json:"detail,omitempty"`
+	CreatedAt time.Time         `json:"created_at"`
+}
+
+// EmailDeliveryInfo - состояние доставки для админки
+type EmailDeliveryInfo struct {
+	Status       EmailDeliveryStatus `json:"status"`
+	StatusAt     *time.Time          `json:"status_at,omitempty"`
+	Suppression  *EmailSuppression   `json:"suppression,omitempty"`
+	RecentEvents []DeliveryEvent     `json:"recent_events"`
+}
+
+// RateLimitACLAction - действие записи списка IP для rate limiting
+type RateLimitACLAction string
+
+const (
+	RateLimitAllow RateLimitACLAction = "allow" // лимиты не применяются
+	RateLimitDeny  RateLimitACLAction = "deny"  // запросы отклоняются
+)
+
+// RateLimitACLEntry - IP или подсеть в списке разрешенных/запрещенных
+type RateLimitACLEntry struct {
+	ID        int64              `json:"id"`
+	CIDR      string             `json:"cidr"`
+	Action    RateLimitACLAction `json:"action"`
+	Comment   *string            `json:"comment,omitempty"`
+	CreatedBy *int64             `json:"created_by,omitempty"`
+	CreatedAt time.Time          `json:"created_at"`
+	ExpiresAt *time.Time         `json:"expires_at,omitempty"`
+}
+
+// RateLimitCounter - состояние счетчика одного правила для админки
+type RateLimitCounter struct {
+	Policy        string `json:"policy"`
+	KeyBy         string `json:"key_by"`
+	Algorithm     string `json:"algorithm"`
+	Limit         int    `json:"limit"`
+	WindowSeconds int    `json:"window_seconds"`
+	Remaining     int    `json:"remaining"`
+	TTLSeconds    int    `json:"ttl_seconds"`
+}
+
+// TokenEmailPayload - payload писем подтверждения email и сброса пароля
+type TokenEmailPayload struct {
+	Token  string `json:"token"`
+	Locale string `json:"locale,omitempty"`
 }
 
 // API Request/Response types
@@ -76,6 +371,8 @@ type SignUpRequest struct {
 	Password        string `json:"password"`
 	ConfirmPassword string `json:"confirm_password"`
 	Nick            string `json:"nick"`
+	Handle          string `json:"handle,omitempty"`
+	Locale          string `json:"locale,omitempty"`
 	AgreeTerms      bool   `json:"agree_terms"`
 	CaptchaToken    string `json:"captcha_token"`
 }
@@ -98,6 +395,35 @@ type UpdateProfileRequest struct {
 	Bio             *string         `json:"bio"`
 	Links           []Link          `json:"links"`
 	PrivacySettings PrivacySettings `json:"privacy_settings"`
+	Locale          *string         `json:"locale,omitempty"`
+}
+
+type UpdateHandleRequest struct {
+	Handle string `json:"handle"`
+}
+
+// PublishNotificationRequest - событие от других сервисов для набора пользователей
+type PublishNotificationRequest struct {
+	UserIDs []int64          `json:"user_ids"`
+	Type    NotificationType `json:"type"`
+	Title   string           `json:"title"`
+	Body    *string          `json:"body,omitempty"`
+	Link    *string          `json:"link,omitempty"`
+	Payload json.RawMessage  `json:"payload,omitempty"`
+}
+
+// UnsubscribeAll - отписка от всех email-дайджестов (в отличие от отписки от типа события)
+const UnsubscribeAll = "email"
+
+type MarkReadRequest struct {
+	IDs []int64 `json:"ids"`
+}
+
+type RateLimitACLRequest struct {
+	CIDR      string             `json:"cidr"`
+	Action    RateLimitACLAction `json:"action"`
+	Comment   string             `json:"comment"`
+	ExpiresAt *time.Time         `json:"expires_at"`
 }
 
 type ErrorResponse struct {
@@ -0,0 +1,147 @@
+package email
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// sesSendEmailPath - метод SendEmail в API SES v2
+const sesSendEmailPath = "/v2/email/outbound-emails"
+
+// HTTPTransport отправляет письма через HTTP API, совместимое с Amazon SES v2
+// (SendEmail с Raw содержимым). Endpoint настраивается, поэтому вместо SES
+// можно подставить совместимый сервис или локальную заглушку. Без ключей
+// запросы уходят без подписи.
+type HTTPTransport struct {
+	endpoint  string
+	region    string
+	accessKey string
+	secretKey string
+	client    *http.Client
+}
+
+func NewHTTPTransport(endpoint, region, accessKey, secretKey string) (*HTTPTransport, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid email API endpoint %q", endpoint)
+	}
+	return &HTTPTransport{
+		endpoint:  strings.TrimRight(endpoint, "/"),
+		region:    region,
+		accessKey: accessKey,
+		secretKey: secretKey,
+		client:    &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+type sesSendEmailRequest struct {
+	FromEmailAddress string `json:"FromEmailAddress"`
+	Destination      struct {
+		ToAddresses []string `json:"ToAddresses"`
+	} `json:"Destination"`
+	Content struct {
+		Raw struct {
+			Data string `json:"Data"`
+		} `json:"Raw"`
+	} `json:"Content"`
+}
+
+func (t *HTTPTransport) Send(msg *Message) error {
+	raw, err := msg.Bytes()
+	if err != nil {
+		return err
+	}
+
+	var payload sesSendEmailRequest
+	payload.FromEmailAddress = msg.From
+	payload.Destination.ToAddresses = []string{msg.To}
+	payload.Content.Raw.Data = base64.StdEncoding.EncodeToString(raw)
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, t.endpoint+sesSendEmailPath, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if t.accessKey != "" {
+		t.sign(req, body, time.Now().UTC())
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("email API returned %d: %s", resp.StatusCode, strings.TrimSpace(string(detail)))
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+func (t *HTTPTransport) Close() error {
+	t.client.CloseIdleConnections()
+	return nil
+}
+
+// sign подписывает запрос AWS Signature Version 4 для сервиса "ses"
+func (t *HTTPTransport) sign(req *http.Request, body []byte, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256Hex(body)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	signedHeaders := "content-type;host;x-amz-content-sha256;x-amz-date"
+	canonicalHeaders := "content-type:" + req.Header.Get("Content-Type") + "\n" +
+		"host:" + req.URL.Host + "\n" +
+		"x-amz-content-sha256:" + payloadHash + "\n" +
+		"x-amz-date:" + amzDate + "\n"
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + t.region + "/ses/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+t.secretKey), date)
+	key = hmacSHA256(key, t.region)
+	key = hmacSHA256(key, "ses")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+t.accessKey+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
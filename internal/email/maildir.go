@@ -0,0 +1,57 @@
+package email
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// MaildirTransport складывает письма в каталог формата Maildir (tmp/new/cur) -
+// для разработки: письма можно открыть почтовым клиентом или просто как .eml файлы
+type MaildirTransport struct {
+	dir      string
+	hostname string
+}
+
+func NewMaildirTransport(dir string) (*MaildirTransport, error) {
+	for _, sub := range []string{"tmp", "new", "cur"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0o750); err != nil {
+			return nil, err
+		}
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "localhost"
+	}
+	return &MaildirTransport{dir: dir, hostname: hostname}, nil
+}
+
+func (t *MaildirTransport) Send(msg *Message) error {
+	raw, err := msg.Bytes()
+	if err != nil {
+		return err
+	}
+
+	// Уникальное имя по соглашению Maildir: время.уникальная_часть.хост
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	name := fmt.Sprintf("%d.%d_%s.%s", time.Now().Unix(), os.Getpid(), hex.EncodeToString(b), t.hostname)
+
+	// Сначала пишем в tmp, затем атомарно переносим в new, чтобы читатель не увидел недописанный файл
+	tmpPath := filepath.Join(t.dir, "tmp", name)
+	if err := os.WriteFile(tmpPath, raw, 0o640); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, filepath.Join(t.dir, "new", name)); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
+
+func (t *MaildirTransport) Close() error {
+	return nil
+}
@@ -0,0 +1,98 @@
+package email
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Message - письмо, готовое к сборке в MIME
+type Message struct {
+	From    string
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+	// Headers - дополнительные заголовки (List-Unsubscribe и т.п.)
+	Headers map[string]string
+}
+
+// Bytes собирает письмо multipart/alternative (text/plain + text/html)
+// с заголовками Date, Message-ID и MIME-Version
+func (m *Message) Bytes() ([]byte, error) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	if err := writeQuotedPart(mw, "text/plain; charset=UTF-8", m.Text); err != nil {
+		return nil, err
+	}
+	if err := writeQuotedPart(mw, "text/html; charset=UTF-8", m.HTML); err != nil {
+		return nil, err
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+
+	var msg bytes.Buffer
+	writeHeader(&msg, "From", m.From)
+	writeHeader(&msg, "To", m.To)
+	writeHeader(&msg, "Subject", mime.QEncoding.Encode("UTF-8", m.Subject))
+	writeHeader(&msg, "Date", time.Now().Format(time.RFC1123Z))
+	writeHeader(&msg, "Message-ID", newMessageID(m.From))
+	writeHeader(&msg, "MIME-Version", "1.0")
+
+	// Порядок заголовков стабильный, чтобы письма было проще сравнивать
+	keys := make([]string, 0, len(m.Headers))
+	for k := range m.Headers {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		writeHeader(&msg, k, m.Headers[k])
+	}
+
+	writeHeader(&msg, "Content-Type", `multipart/alternative; boundary="`+mw.Boundary()+`"`)
+	msg.WriteString("\r\n")
+	msg.Write(body.Bytes())
+	return msg.Bytes(), nil
+}
+
+func writeHeader(buf *bytes.Buffer, key, value string) {
+	buf.WriteString(key + ": " + sanitizeHeaderValue(value) + "\r\n")
+}
+
+func writeQuotedPart(mw *multipart.Writer, contentType, content string) error {
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Type", contentType)
+	header.Set("Content-Transfer-Encoding", "quoted-printable")
+	part, err := mw.CreatePart(header)
+	if err != nil {
+		return err
+	}
+	qp := quotedprintable.NewWriter(part)
+	if _, err := qp.Write([]byte(content)); err != nil {
+		return err
+	}
+	return qp.Close()
+}
+
+// newMessageID генерирует уникальный Message-ID в домене отправителя
+func newMessageID(from string) string {
+	domain := "localhost"
+	if addr, err := mail.ParseAddress(from); err == nil {
+		if i := strings.LastIndex(addr.Address, "@"); i >= 0 {
+			domain = addr.Address[i+1:]
+		}
+	}
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return fmt.Sprintf("<%d.%s@%s>", time.Now().UnixNano(), hex.EncodeToString(b), domain)
+}
@@ -0,0 +1,230 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/RESERPIX/hubigr/internal/domain"
+	"github.com/RESERPIX/hubigr/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var emailRegex = regexp.MustCompile(`^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}$`)
+
+// ErrSuppressed - адрес в списке подавления (bounce или жалоба), письмо не отправлено
+var ErrSuppressed = errors.New("email address is suppressed")
+
+// suppressionCheckTimeout - ограничение на проверку списка подавления перед отправкой
+const suppressionCheckTimeout = 5 * time.Second
+
+// SuppressionList - адреса, на которые нельзя отправлять письма
+type SuppressionList interface {
+	IsSuppressed(ctx context.Context, email string) (bool, error)
+}
+
+// Sender рендерит письма из шаблонов и передает их транспорту,
+// пропуская адреса из списка подавления
+type Sender struct {
+	transport    Transport
+	renderer     *Renderer
+	suppressions SuppressionList
+	from         string
+	baseURL      string
+}
+
+// NewSender создает отправителя; suppressions может быть nil
+func NewSender(transport Transport, renderer *Renderer, suppressions SuppressionList, from, baseURL string) *Sender {
+	return &Sender{
+		transport:    transport,
+		renderer:     renderer,
+		suppressions: suppressions,
+		from:         from,
+		baseURL:      baseURL,
+	}
+}
+
+// SendVerificationEmail отправляет письмо подтверждения согласно UC-1.1.1
+func (s *Sender) SendVerificationEmail(ctx context.Context, to, token, locale string) error {
+	if err := validateEmailInput(to, token); err != nil {
+		return err
+	}
+
+	verifyURL := fmt.Sprintf("%s/verify?token=%s", s.baseURL, token)
+	rendered, err := s.renderer.Render(TemplateVerification, locale, tokenView{Locale: domain.NormalizeLocale(locale), URL: verifyURL})
+	if err != nil {
+		return err
+	}
+	return s.send(ctx, to, rendered, nil, true)
+}
+
+// SendPasswordResetEmail отправляет письмо сброса пароля согласно UC-1.1.3
+func (s *Sender) SendPasswordResetEmail(ctx context.Context, to, token, locale string) error {
+	if err := validateEmailInput(to, token); err != nil {
+		return err
+	}
+
+	resetURL := fmt.Sprintf("%s/reset-password?token=%s", s.baseURL, token)
+	rendered, err := s.renderer.Render(TemplatePasswordReset, locale, tokenView{Locale: domain.NormalizeLocale(locale), URL: resetURL})
+	if err != nil {
+		return err
+	}
+	return s.send(ctx, to, rendered, nil, true)
+}
+
+// Digest - содержимое email-дайджеста уведомлений
+type Digest struct {
+	Frequency domain.DigestFrequency
+	Locale    string
+	Items     []domain.Notification
+	// Total - сколько всего событий накопилось (в письмо попадают не больше store.DigestBatchSize)
+	Total int
+	// UnsubscribeURL - отписка от всех дайджестов одним кликом
+	UnsubscribeURL string
+	// UnsubscribeTypeURLs - отписка от отдельных типов событий
+	UnsubscribeTypeURLs map[domain.NotificationType]string
+}
+
+// SendDigestEmail отправляет дайджест накопленных уведомлений
+func (s *Sender) SendDigestEmail(ctx context.Context, to string, digest Digest) error {
+	if err := validateEmailInput(to, digest.UnsubscribeURL); err != nil {
+		return err
+	}
+
+	rendered, err := s.renderer.Render(TemplateDigest, digest.Locale, newDigestView(digest, s.baseURL))
+	if err != nil {
+		return err
+	}
+
+	// RFC 8058: почтовые клиенты показывают кнопку отписки и делают POST без участия пользователя
+	headers := map[string]string{
+		"List-Unsubscribe":      "<" + digest.UnsubscribeURL + ">",
+		"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+	}
+	return s.send(ctx, to, rendered, headers, true)
+}
+
+// AlertEmail - алерт мониторинга для письма дежурным
+type AlertEmail struct {
+	Name    string
+	Status  string // firing или resolved
+	Level   string
+	Service string
+	Message string
+	Time    time.Time
+}
+
+// SendAlertEmail отправляет письмо об алерте. Список подавления не проверяется:
+// он в БД, а алерт может быть как раз о ее недоступности.
+func (s *Sender) SendAlertEmail(ctx context.Context, to string, alert AlertEmail) error {
+	if err := validateEmailInput(to, alert.Name); err != nil {
+		return err
+	}
+
+	rendered, err := s.renderer.Render(TemplateAlert, domain.DefaultLocale, newAlertView(alert, domain.DefaultLocale))
+	if err != nil {
+		return err
+	}
+	return s.send(ctx, to, rendered, nil, false)
+}
+
+func (s *Sender) send(ctx context.Context, to string, rendered *Rendered, headers map[string]string, checkSuppressions bool) (err error) {
+	// Адрес получателя в спан не пишем
+	ctx, span := tracing.Start(ctx, "email.send", trace.WithSpanKind(trace.SpanKindClient))
+	defer func() {
+		if errors.Is(err, ErrSuppressed) {
+			span.SetAttributes(attribute.Bool("email.suppressed", true))
+			tracing.End(span, nil)
+			return
+		}
+		tracing.End(span, err)
+	}()
+
+	if checkSuppressions && s.suppressions != nil {
+		checkCtx, cancel := context.WithTimeout(ctx, suppressionCheckTimeout)
+		suppressed, err := s.suppressions.IsSuppressed(checkCtx, to)
+		cancel()
+		if err != nil {
+			return fmt.Errorf("check suppression list: %w", err)
+		}
+		if suppressed {
+			return ErrSuppressed
+		}
+	}
+	return s.transport.Send(&Message{
+		From:    s.from,
+		To:      to,
+		Subject: rendered.Subject,
+		Text:    rendered.Text,
+		HTML:    rendered.HTML,
+		Headers: headers,
+	})
+}
+
+// Close закрывает соединения транспорта
+func (s *Sender) Close() error {
+	return s.transport.Close()
+}
+
+// sanitizeHeaderValue убирает переводы строк, чтобы значение не могло добавить свои заголовки
+func sanitizeHeaderValue(value string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(value)
+}
+
+// maskEmailForMock маскирует email для mock sender
+func maskEmailForMock(email string) string {
+	if len(email) < 3 {
+		return "***"
+	}
+	parts := strings.Split(email, "@")
+	if len(parts) != 2 {
+		return "***@***"
+	}
+	local := parts[0]
+	domain := parts[1]
+	
+	if len(local) <= 2 {
+		return "***@" + domain
+	}
+	return local[:2] + "***@" + domain
+}
+
+// validateEmailInput проверяет входные данные email
+func validateEmailInput(to, token string) error {
+	if to == "" {
+		return fmt.Errorf("email address cannot be empty")
+	}
+	
+	if token == "" {
+		return fmt.Errorf("token cannot be empty")
+	}
+	
+	// Проверка на CRLF инъекцию в email
+	if strings.ContainsAny(to, "\r\n") {
+		return fmt.Errorf("invalid characters in email address")
+	}
+	
+	// Проверка на CRLF инъекцию в token
+	if strings.ContainsAny(token, "\r\n") {
+		return fmt.Errorf("invalid characters in token")
+	}
+	
+	// Простая проверка формата email
+	if !emailRegex.MatchString(to) {
+		return fmt.Errorf("invalid email format")
+	}
+	
+	return nil
+}
+
+// EmailSender интерфейс для отправки email
+type EmailSender interface {
+	SendVerificationEmail(ctx context.Context, to, token, locale string) error
+	SendPasswordResetEmail(ctx context.Context, to, token, locale string) error
+	SendDigestEmail(ctx context.Context, to string, digest Digest) error
+	SendAlertEmail(ctx context.Context, to string, alert AlertEmail) error
+}
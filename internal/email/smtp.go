@@ -1,181 +1,236 @@
 package email
 
 import (
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"net"
+	"net/mail"
 	"net/smtp"
-	"regexp"
-	"strings"
+	"net/textproto"
+	"time"
 )
 
-var emailRegex = regexp.MustCompile(`^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}$`)
+// Режимы шифрования SMTP
+const (
+	SMTPTLSStartTLS = "starttls" // порт 587: обычное соединение + STARTTLS (обязателен)
+	SMTPTLSImplicit = "implicit" // порт 465: TLS сразу при подключении
+	SMTPTLSNone     = "none"     // только для локальных ловушек писем (MailHog и т.п.)
+)
+
+const (
+	smtpDialTimeout = 10 * time.Second
+	smtpSendTimeout = 30 * time.Second
+	// smtpIdleTimeout - соединения, простоявшие дольше, закрываются: серверы
+	// обычно рвут их сами, и повторное использование только даст лишнюю ошибку
+	smtpIdleTimeout = 30 * time.Second
+)
 
-type SMTPSender struct {
+// SMTPTransport отправляет письма по SMTP и переиспользует соединения между письмами.
+// Свободные соединения лежат в пуле ограниченного размера; занятые не делятся.
+type SMTPTransport struct {
 	host     string
 	port     string
 	username string
 	password string
-	from     string
-	baseURL  string
+	tlsMode  string
+	idle     chan *smtpConn
+}
+
+// staleConnError - переиспользованное соединение оказалось закрытым до того, как
+// сервер принял MAIL FROM. Письмо сервер не видел, повтор на новом соединении безопасен.
+type staleConnError struct {
+	err error
+}
+
+func (e *staleConnError) Error() string { return e.err.Error() }
+func (e *staleConnError) Unwrap() error { return e.err }
+
+type smtpConn struct {
+	client   *smtp.Client
+	conn     net.Conn
+	lastUsed time.Time
 }
 
-func NewSMTPSender(host, port, username, password, from, baseURL string) *SMTPSender {
-	return &SMTPSender{
+func NewSMTPTransport(host, port, username, password, tlsMode string, maxIdle int) (*SMTPTransport, error) {
+	switch tlsMode {
+	case SMTPTLSStartTLS, SMTPTLSImplicit, SMTPTLSNone:
+	default:
+		return nil, fmt.Errorf("unknown SMTP TLS mode %q", tlsMode)
+	}
+	if maxIdle < 1 {
+		maxIdle = 1
+	}
+	return &SMTPTransport{
 		host:     host,
 		port:     port,
 		username: username,
 		password: password,
-		from:     from,
-		baseURL:  baseURL,
-	}
+		tlsMode:  tlsMode,
+		idle:     make(chan *smtpConn, maxIdle),
+	}, nil
 }
 
-// SendVerificationEmail отправляет письмо подтверждения согласно UC-1.1.1
-func (s *SMTPSender) SendVerificationEmail(to, token string) error {
-	if err := validateEmailInput(to, token); err != nil {
+func (t *SMTPTransport) Send(msg *Message) error {
+	from, err := mail.ParseAddress(msg.From)
+	if err != nil {
+		return fmt.Errorf("invalid from address: %w", err)
+	}
+	raw, err := msg.Bytes()
+	if err != nil {
 		return err
 	}
-	
-	verifyURL := fmt.Sprintf("%s/verify?token=%s", s.baseURL, token)
-
-	subject := "Подтверждение аккаунта - Hubigr"
-	body := fmt.Sprintf(`
-Добро пожаловать в Hubigr!
-
-Для завершения регистрации подтвердите ваш email, перейдя по ссылке:
-%s
-
-Ссылка действительна в течение 1 часа.
 
-Если вы не регистрировались на Hubigr, проигнорируйте это письмо.
-
---
-Команда Hubigr
-`, verifyURL)
-
-	return s.sendEmail(to, subject, body)
-}
-
-// SendPasswordResetEmail отправляет письмо сброса пароля согласно UC-1.1.3
-func (s *SMTPSender) SendPasswordResetEmail(to, token string) error {
-	if err := validateEmailInput(to, token); err != nil {
+	c, reused, err := t.get()
+	if err != nil {
 		return err
 	}
-	
-	resetURL := fmt.Sprintf("%s/reset-password?token=%s", s.baseURL, token)
-
-	subject := "Сброс пароля - Hubigr"
-	body := fmt.Sprintf(`
-Запрос на сброс пароля
-
-Для создания нового пароля перейдите по ссылке:
-%s
-
-Ссылка действительна в течение 1 часа.
-
-Если вы не запрашивали сброс пароля, проигнорируйте это письмо.
-
---
-Команда Hubigr
-`, resetURL)
-
-	return s.sendEmail(to, subject, body)
-}
-
-func (s *SMTPSender) sendEmail(to, subject, body string) error {
-	// Формирование сообщения
-	msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\n\r\n%s",
-		s.from, to, subject, body)
-
-	// Аутентификация
-	auth := smtp.PlainAuth("", s.username, s.password, s.host)
-
-	// Отправка
-	addr := s.host + ":" + s.port
-	return smtp.SendMail(addr, auth, s.from, []string{to}, []byte(msg))
-}
-
-// MockSender для тестирования
-type MockSender struct {
-	SentEmails []SentEmail
+	err = t.deliver(c, from.Address, msg.To, raw)
+	var stale *staleConnError
+	if reused && errors.As(err, &stale) {
+		// Сервер закрыл старое соединение - одна попытка на новом. Отказ в
+		// RCPT и ошибки после DATA не повторяем: письмо отклонено или уже могло уйти
+		c.close()
+		if c, err = t.dial(); err != nil {
+			return err
+		}
+		err = t.deliver(c, from.Address, msg.To, raw)
+	}
+	if err != nil {
+		c.close()
+		return err
+	}
+	t.put(c)
+	return nil
 }
 
-type SentEmail struct {
-	To    string
-	Token string
+func (t *SMTPTransport) deliver(c *smtpConn, from, to string, raw []byte) error {
+	if err := c.conn.SetDeadline(time.Now().Add(smtpSendTimeout)); err != nil {
+		return &staleConnError{err}
+	}
+	if err := c.client.Mail(from); err != nil {
+		// Постоянный отказ сервера (5xx) возвращаем как есть, остальное - обрыв
+		// соединения или временный отказ вроде 421 на простоявшем соединении
+		var protoErr *textproto.Error
+		if errors.As(err, &protoErr) && protoErr.Code >= 500 {
+			return err
+		}
+		return &staleConnError{err}
+	}
+	if err := c.client.Rcpt(to); err != nil {
+		// Сбрасываем транзакцию, чтобы соединение можно было использовать дальше
+		_ = c.client.Reset()
+		return err
+	}
+	w, err := c.client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(raw); err != nil {
+		return err
+	}
+	return w.Close()
 }
 
-func NewMockSender() *MockSender {
-	return &MockSender{SentEmails: make([]SentEmail, 0)}
+// get берет свободное соединение из пула или открывает новое
+func (t *SMTPTransport) get() (*smtpConn, bool, error) {
+	for {
+		select {
+		case c := <-t.idle:
+			if time.Since(c.lastUsed) > smtpIdleTimeout {
+				c.close()
+				continue
+			}
+			return c, true, nil
+		default:
+			c, err := t.dial()
+			return c, false, err
+		}
+	}
 }
 
-func (m *MockSender) SendVerificationEmail(to, token string) error {
-	m.SentEmails = append(m.SentEmails, SentEmail{To: to, Token: token})
-	fmt.Printf("MOCK EMAIL: Verification sent to %s with token %s\n", maskEmailForMock(to), maskToken(token))
-	return nil
+// put возвращает соединение в пул; лишние закрываются
+func (t *SMTPTransport) put(c *smtpConn) {
+	c.lastUsed = time.Now()
+	select {
+	case t.idle <- c:
+	default:
+		c.quit()
+	}
 }
 
-func (m *MockSender) SendPasswordResetEmail(to, token string) error {
-	m.SentEmails = append(m.SentEmails, SentEmail{To: to, Token: token})
-	fmt.Printf("MOCK EMAIL: Password reset sent to %s with token %s\n", maskEmailForMock(to), maskToken(token))
-	return nil
-}
+func (t *SMTPTransport) dial() (*smtpConn, error) {
+	addr := net.JoinHostPort(t.host, t.port)
+	dialer := &net.Dialer{Timeout: smtpDialTimeout}
+	tlsConfig := &tls.Config{ServerName: t.host, MinVersion: tls.VersionTLS12}
+
+	var conn net.Conn
+	var err error
+	if t.tlsMode == SMTPTLSImplicit {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.SetDeadline(time.Now().Add(smtpSendTimeout)); err != nil {
+		conn.Close()
+		return nil, err
+	}
 
-// maskEmailForMock маскирует email для mock sender
-func maskEmailForMock(email string) string {
-	if len(email) < 3 {
-		return "***"
+	client, err := smtp.NewClient(conn, t.host)
+	if err != nil {
+		conn.Close()
+		return nil, err
 	}
-	parts := strings.Split(email, "@")
-	if len(parts) != 2 {
-		return "***@***"
+	c := &smtpConn{client: client, conn: conn}
+
+	if t.tlsMode == SMTPTLSStartTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			c.close()
+			return nil, fmt.Errorf("SMTP server %s does not support STARTTLS", addr)
+		}
+		if err := client.StartTLS(tlsConfig); err != nil {
+			c.close()
+			return nil, err
+		}
 	}
-	local := parts[0]
-	domain := parts[1]
-	
-	if len(local) <= 2 {
-		return "***@" + domain
+
+	// Логин задан - без AUTH не отправляем: письма ушли бы неаутентифицированными
+	if t.username != "" {
+		if ok, _ := client.Extension("AUTH"); !ok {
+			c.close()
+			return nil, fmt.Errorf("SMTP server %s does not support AUTH, but SMTP_USER is set", addr)
+		}
+		if err := client.Auth(smtp.PlainAuth("", t.username, t.password, t.host)); err != nil {
+			c.close()
+			return nil, err
+		}
 	}
-	return local[:2] + "***@" + domain
+	return c, nil
 }
 
-// maskToken маскирует токен для безопасности
-func maskToken(token string) string {
-	if len(token) < 8 {
-		return "***"
+// Close закрывает свободные соединения пула
+func (t *SMTPTransport) Close() error {
+	for {
+		select {
+		case c := <-t.idle:
+			c.quit()
+		default:
+			return nil
+		}
 	}
-	return token[:4] + "***" + token[len(token)-4:]
 }
 
-// validateEmailInput проверяет входные данные email
-func validateEmailInput(to, token string) error {
-	if to == "" {
-		return fmt.Errorf("email address cannot be empty")
-	}
-	
-	if token == "" {
-		return fmt.Errorf("token cannot be empty")
-	}
-	
-	// Проверка на CRLF инъекцию в email
-	if strings.ContainsAny(to, "\r\n") {
-		return fmt.Errorf("invalid characters in email address")
+// quit корректно завершает SMTP сессию
+func (c *smtpConn) quit() {
+	_ = c.conn.SetDeadline(time.Now().Add(smtpDialTimeout))
+	if err := c.client.Quit(); err != nil {
+		c.close()
 	}
-	
-	// Проверка на CRLF инъекцию в token
-	if strings.ContainsAny(token, "\r\n") {
-		return fmt.Errorf("invalid characters in token")
-	}
-	
-	// Простая проверка формата email
-	if !emailRegex.MatchString(to) {
-		return fmt.Errorf("invalid email format")
-	}
-	
-	return nil
 }
 
-// EmailSender интерфейс для отправки email
-type EmailSender interface {
-	SendVerificationEmail(to, token string) error
-	SendPasswordResetEmail(to, token string) error
+func (c *smtpConn) close() {
+	_ = c.client.Close()
 }
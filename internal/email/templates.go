@@ -0,0 +1,265 @@
+package email
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"os"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/RESERPIX/hubigr/internal/domain"
+)
+
+//go:embed templates
+var embeddedTemplates embed.FS
+
+// Имена шаблонов писем; для каждого языка есть <name>.txt.tmpl с блоком "subject"
+// и <name>.html.tmpl с блоком "content", который встраивается в layout.html.tmpl
+const (
+	TemplateVerification  = "verification"
+	TemplatePasswordReset = "password_reset"
+	TemplateDigest        = "digest"
+	TemplateAlert         = "alert"
+)
+
+// ErrUnknownTemplate - шаблона с таким именем нет
+var ErrUnknownTemplate = errors.New("unknown email template")
+
+var templateNames = []string{TemplateVerification, TemplatePasswordReset, TemplateDigest, TemplateAlert}
+
+// Locales - языки, для которых есть шаблоны писем
+var Locales = []string{domain.LocaleRU, domain.LocaleEN}
+
+// Rendered - готовое содержимое письма
+type Rendered struct {
+	Subject string
+	Text    string
+	HTML    string
+}
+
+type localizedTemplate struct {
+	text *texttemplate.Template
+	html *htmltemplate.Template
+}
+
+// Renderer рендерит письма из шаблонов на языке получателя. Файлы из каталога
+// переопределения (EMAIL_TEMPLATES_DIR) с той же структурой, что и встроенные
+// templates/, заменяют встроенные по одному: можно поменять только нужные.
+type Renderer struct {
+	templates map[string]localizedTemplate // ключ "<locale>/<name>"
+}
+
+// NewRenderer разбирает все шаблоны при старте, чтобы ошибки в файлах
+// переопределения обнаруживались сразу, а не при отправке письма
+func NewRenderer(overrideDir string) (*Renderer, error) {
+	base, err := fs.Sub(embeddedTemplates, "templates")
+	if err != nil {
+		return nil, err
+	}
+	var files fs.FS = base
+	if overrideDir != "" {
+		if info, err := os.Stat(overrideDir); err != nil || !info.IsDir() {
+			return nil, fmt.Errorf("email templates dir %q is not a directory", overrideDir)
+		}
+		files = overlayFS{override: os.DirFS(overrideDir), base: base}
+	}
+
+	r := &Renderer{templates: make(map[string]localizedTemplate)}
+	for _, locale := range Locales {
+		for _, name := range templateNames {
+			txtFile := locale + "/" + name + ".txt.tmpl"
+			htmlFile := locale + "/" + name + ".html.tmpl"
+
+			text, err := texttemplate.New(name+".txt.tmpl").ParseFS(files, txtFile)
+			if err != nil {
+				return nil, fmt.Errorf("parse %s: %w", txtFile, err)
+			}
+			if text.Lookup("subject") == nil {
+				return nil, fmt.Errorf("parse %s: missing subject block", txtFile)
+			}
+			// Тема из текстового шаблона нужна и в <title> HTML-версии
+			html, err := htmltemplate.New("layout.html.tmpl").ParseFS(files, "layout.html.tmpl", htmlFile, txtFile)
+			if err != nil {
+				return nil, fmt.Errorf("parse %s: %w", htmlFile, err)
+			}
+			r.templates[locale+"/"+name] = localizedTemplate{text: text, html: html}
+		}
+	}
+	return r, nil
+}
+
+// Templates возвращает имена доступных шаблонов
+func (r *Renderer) Templates() []string {
+	return append([]string(nil), templateNames...)
+}
+
+// Render рендерит тему, текстовую и HTML-версию письма. Для неизвестного
+// языка используется язык по умолчанию.
+func (r *Renderer) Render(name, locale string, data any) (*Rendered, error) {
+	t, ok := r.templates[domain.NormalizeLocale(locale)+"/"+name]
+	if !ok {
+		return nil, ErrUnknownTemplate
+	}
+
+	var subject, text, html bytes.Buffer
+	if err := t.text.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return nil, fmt.Errorf("render %s subject: %w", name, err)
+	}
+	if err := t.text.Execute(&text, data); err != nil {
+		return nil, fmt.Errorf("render %s text: %w", name, err)
+	}
+	if err := t.html.Execute(&html, data); err != nil {
+		return nil, fmt.Errorf("render %s html: %w", name, err)
+	}
+
+	return &Rendered{
+		Subject: sanitizeHeaderValue(strings.TrimSpace(subject.String())),
+		Text:    strings.TrimLeft(text.String(), "\n"),
+		HTML:    html.String(),
+	}, nil
+}
+
+// Preview рендерит шаблон с тестовыми данными для просмотра в админке
+func (r *Renderer) Preview(name, locale, baseURL string) (*Rendered, error) {
+	locale = domain.NormalizeLocale(locale)
+	switch name {
+	case TemplateVerification:
+		return r.Render(name, locale, tokenView{Locale: locale, URL: baseURL + "/verify?token=sample-token"})
+	case TemplatePasswordReset:
+		return r.Render(name, locale, tokenView{Locale: locale, URL: baseURL + "/reset-password?token=sample-token"})
+	case TemplateDigest:
+		link := "/games/sample-game"
+		digest := Digest{
+			Frequency: domain.DigestDaily,
+			Locale:    locale,
+			Items: []domain.Notification{
+				{Type: domain.NotificationNewGame, Title: "Sample Game", Link: &link},
+				{Type: domain.NotificationNewPost, Title: "Sample post"},
+			},
+			Total:          5,
+			UnsubscribeURL: baseURL + "/api/v1/notifications/unsubscribe?token=sample",
+			UnsubscribeTypeURLs: map[domain.NotificationType]string{
+				domain.NotificationNewGame: baseURL + "/api/v1/notifications/unsubscribe?token=sample-new-game",
+			},
+		}
+		return r.Render(name, locale, newDigestView(digest, baseURL))
+	case TemplateAlert:
+		return r.Render(name, locale, newAlertView(AlertEmail{
+			Name:    "high_error_rate",
+			Status:  "firing",
+			Level:   "critical",
+			Service: "http",
+			Message: "5xx responses in the last 5m: 12.5% of 240 requests",
+			Time:    time.Now(),
+		}, locale))
+	}
+	return nil, ErrUnknownTemplate
+}
+
+// tokenView - данные писем со ссылкой подтверждения или сброса пароля
+type tokenView struct {
+	Locale string
+	URL    string
+}
+
+// alertView - данные письма об алерте мониторинга
+type alertView struct {
+	Locale   string
+	Name     string
+	Level    string
+	Service  string
+	Message  string
+	Time     string
+	Resolved bool
+}
+
+func newAlertView(alert AlertEmail, locale string) alertView {
+	return alertView{
+		Locale:   domain.NormalizeLocale(locale),
+		Name:     sanitizeHeaderValue(alert.Name),
+		Level:    strings.ToUpper(sanitizeHeaderValue(alert.Level)),
+		Service:  sanitizeHeaderValue(alert.Service),
+		Message:  alert.Message,
+		Time:     alert.Time.UTC().Format(time.RFC3339),
+		Resolved: alert.Status == "resolved",
+	}
+}
+
+// digestView - данные письма-дайджеста
+type digestView struct {
+	Locale           string
+	Frequency        domain.DigestFrequency
+	Items            []digestItem
+	Rest             int
+	UnsubscribeURL   string
+	UnsubscribeTypes []unsubscribeLink
+}
+
+type digestItem struct {
+	Title string
+	Link  string
+}
+
+type unsubscribeLink struct {
+	Label string
+	URL   string
+}
+
+var digestTypeLabels = map[string]map[domain.NotificationType]string{
+	domain.LocaleRU: {
+		domain.NotificationNewGame:  "новые игры",
+		domain.NotificationNewBuild: "новые билды",
+		domain.NotificationNewPost:  "новые посты",
+	},
+	domain.LocaleEN: {
+		domain.NotificationNewGame:  "new games",
+		domain.NotificationNewBuild: "new builds",
+		domain.NotificationNewPost:  "new posts",
+	},
+}
+
+func newDigestView(digest Digest, baseURL string) digestView {
+	locale := domain.NormalizeLocale(digest.Locale)
+	view := digestView{
+		Locale:         locale,
+		Frequency:      digest.Frequency,
+		UnsubscribeURL: digest.UnsubscribeURL,
+	}
+	for _, item := range digest.Items {
+		di := digestItem{Title: sanitizeHeaderValue(item.Title)}
+		if item.Link != nil && *item.Link != "" {
+			di.Link = *item.Link
+			if strings.HasPrefix(di.Link, "/") {
+				di.Link = baseURL + di.Link
+			}
+		}
+		view.Items = append(view.Items, di)
+	}
+	if rest := digest.Total - len(digest.Items); rest > 0 {
+		view.Rest = rest
+	}
+	for _, t := range []domain.NotificationType{domain.NotificationNewGame, domain.NotificationNewBuild, domain.NotificationNewPost} {
+		if u, ok := digest.UnsubscribeTypeURLs[t]; ok {
+			view.UnsubscribeTypes = append(view.UnsubscribeTypes, unsubscribeLink{Label: digestTypeLabels[locale][t], URL: u})
+		}
+	}
+	return view
+}
+
+// overlayFS отдает файл из override, если он там есть, иначе из base
+type overlayFS struct {
+	override fs.FS
+	base     fs.FS
+}
+
+func (o overlayFS) Open(name string) (fs.File, error) {
+	if f, err := o.override.Open(name); err == nil {
+		return f, nil
+	}
+	return o.base.Open(name)
+}
@@ -0,0 +1,50 @@
+package email
+
+import (
+	"sync"
+
+	"github.com/RESERPIX/hubigr/internal/logger"
+)
+
+// Transport доставляет собранное письмо: SMTP, HTTP API провайдера, maildir или mock
+type Transport interface {
+	Send(msg *Message) error
+	Close() error
+}
+
+// mockHistoryLimit - сколько последних писем хранит MockTransport
+const mockHistoryLimit = 100
+
+// MockTransport для разработки: пишет в лог только получателя и тему
+// и хранит ограниченное число последних писем
+type MockTransport struct {
+	mu   sync.Mutex // outbox воркеры вызывают отправку параллельно
+	sent []Message
+}
+
+func NewMockTransport() *MockTransport {
+	return &MockTransport{}
+}
+
+func (m *MockTransport) Send(msg *Message) error {
+	m.mu.Lock()
+	if len(m.sent) >= mockHistoryLimit {
+		m.sent = append(m.sent[:0], m.sent[1:]...)
+	}
+	m.sent = append(m.sent, *msg)
+	m.mu.Unlock()
+
+	logger.Info("Mock email sent", "to", maskEmailForMock(msg.To), "subject", msg.Subject)
+	return nil
+}
+
+// Sent возвращает копию последних отправленных писем
+func (m *MockTransport) Sent() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Message(nil), m.sent...)
+}
+
+func (m *MockTransport) Close() error {
+	return nil
+}
@@ -0,0 +1,221 @@
+package email
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/RESERPIX/hubigr/internal/domain"
+)
+
+// ErrUnknownWebhookFormat - тело webhook не похоже ни на один поддерживаемый формат
+var ErrUnknownWebhookFormat = errors.New("unknown delivery webhook format")
+
+// maxDetailLength - сколько текста диагностики храним
+const maxDetailLength = 500
+
+// WebhookResult - разобранное уведомление о доставке
+type WebhookResult struct {
+	Events []domain.DeliveryEvent
+	// SubscribeURL - ссылка подтверждения подписки SNS; не открываем ее сами,
+	// чтобы webhook нельзя было использовать для запросов на произвольные адреса
+	SubscribeURL string
+}
+
+// ParseDeliveryWebhook разбирает уведомление о bounce/complaint в одном из форматов:
+//   - общий JSON: {"type": "bounce", "email": "...", "bounce_type": "hard", "detail": "..."}
+//     или массив таких объектов;
+//   - Amazon SES (как есть или в конверте SNS);
+//   - Postmark (RecordType Bounce / SpamComplaint).
+func ParseDeliveryWebhook(body []byte) (*WebhookResult, error) {
+	body = bytes.TrimSpace(body)
+	if len(body) > 0 && body[0] == '[' {
+		var items []genericEvent
+		if err := json.Unmarshal(body, &items); err != nil {
+			return nil, err
+		}
+		return parseGeneric(items)
+	}
+
+	var probe struct {
+		// SNS
+		Type         string `json:"Type"`
+		Message      string `json:"Message"`
+		SubscribeURL string `json:"SubscribeURL"`
+		// SES
+		NotificationType string `json:"notificationType"`
+		EventType        string `json:"eventType"`
+		// Postmark
+		RecordType string `json:"RecordType"`
+		// Общий формат
+		GenericType string `json:"type"`
+	}
+	if err := json.Unmarshal(body, &probe); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case probe.Type == "SubscriptionConfirmation":
+		return &WebhookResult{SubscribeURL: probe.SubscribeURL}, nil
+	case probe.Type == "Notification" && probe.Message != "":
+		return parseSES([]byte(probe.Message))
+	case probe.NotificationType != "" || probe.EventType != "":
+		return parseSES(body)
+	case probe.RecordType != "":
+		return parsePostmark(body)
+	case probe.GenericType != "":
+		var item genericEvent
+		if err := json.Unmarshal(body, &item); err != nil {
+			return nil, err
+		}
+		return parseGeneric([]genericEvent{item})
+	}
+	return nil, ErrUnknownWebhookFormat
+}
+
+type genericEvent struct {
+	Type       string `json:"type"`
+	Email      string `json:"email"`
+	BounceType string `json:"bounce_type"`
+	Detail     string `json:"detail"`
+}
+
+func parseGeneric(items []genericEvent) (*WebhookResult, error) {
+	result := &WebhookResult{}
+	for _, item := range items {
+		var bounceType domain.BounceType
+		switch domain.DeliveryEventType(item.Type) {
+		case domain.DeliveryEventBounce:
+			// Без уточнения считаем bounce постоянным
+			bounceType = domain.BounceHard
+			if item.BounceType == string(domain.BounceSoft) {
+				bounceType = domain.BounceSoft
+			}
+		case domain.DeliveryEventComplaint:
+		default:
+			return nil, ErrUnknownWebhookFormat
+		}
+		result.add(domain.DeliveryEventType(item.Type), item.Email, bounceType, item.Detail, "generic")
+	}
+	return result, nil
+}
+
+type sesRecipient struct {
+	EmailAddress   string `json:"emailAddress"`
+	DiagnosticCode string `json:"diagnosticCode"`
+}
+
+type sesNotification struct {
+	NotificationType string `json:"notificationType"`
+	EventType        string `json:"eventType"`
+	Bounce           struct {
+		BounceType        string         `json:"bounceType"`
+		BounceSubType     string         `json:"bounceSubType"`
+		BouncedRecipients []sesRecipient `json:"bouncedRecipients"`
+	} `json:"bounce"`
+	Complaint struct {
+		ComplaintFeedbackType string         `json:"complaintFeedbackType"`
+		ComplainedRecipients  []sesRecipient `json:"complainedRecipients"`
+	} `json:"complaint"`
+}
+
+func parseSES(body []byte) (*WebhookResult, error) {
+	var n sesNotification
+	if err := json.Unmarshal(body, &n); err != nil {
+		return nil, err
+	}
+	kind := n.NotificationType
+	if kind == "" {
+		kind = n.EventType
+	}
+
+	result := &WebhookResult{}
+	switch kind {
+	case "Bounce":
+		// Permanent - адрес не существует; Transient и Undetermined могут пройти позже
+		bounceType := domain.BounceSoft
+		if n.Bounce.BounceType == "Permanent" {
+			bounceType = domain.BounceHard
+		}
+		for _, r := range n.Bounce.BouncedRecipients {
+			detail := r.DiagnosticCode
+			if detail == "" {
+				detail = n.Bounce.BounceType + "/" + n.Bounce.BounceSubType
+			}
+			result.add(domain.DeliveryEventBounce, r.EmailAddress, bounceType, detail, "ses")
+		}
+	case "Complaint":
+		for _, r := range n.Complaint.ComplainedRecipients {
+			result.add(domain.DeliveryEventComplaint, r.EmailAddress, "", n.Complaint.ComplaintFeedbackType, "ses")
+		}
+	case "Delivery", "Send", "Open", "Click":
+		// Остальные события SES не влияют на подавление
+	default:
+		return nil, ErrUnknownWebhookFormat
+	}
+	return result, nil
+}
+
+type postmarkEvent struct {
+	RecordType  string `json:"RecordType"`
+	Type        string `json:"Type"`
+	Email       string `json:"Email"`
+	Description string `json:"Description"`
+	Details     string `json:"Details"`
+}
+
+// postmarkHardBounces - типы bounce Postmark, после которых адрес не восстановится
+var postmarkHardBounces = map[string]bool{
+	"HardBounce":      true,
+	"BadEmailAddress": true,
+}
+
+func parsePostmark(body []byte) (*WebhookResult, error) {
+	var e postmarkEvent
+	if err := json.Unmarshal(body, &e); err != nil {
+		return nil, err
+	}
+
+	detail := e.Description
+	if e.Details != "" {
+		detail = e.Details
+	}
+
+	result := &WebhookResult{}
+	switch e.RecordType {
+	case "Bounce":
+		if e.Type == "SpamComplaint" {
+			result.add(domain.DeliveryEventComplaint, e.Email, "", detail, "postmark")
+			break
+		}
+		bounceType := domain.BounceSoft
+		if postmarkHardBounces[e.Type] {
+			bounceType = domain.BounceHard
+		}
+		result.add(domain.DeliveryEventBounce, e.Email, bounceType, detail, "postmark")
+	case "SpamComplaint":
+		result.add(domain.DeliveryEventComplaint, e.Email, "", detail, "postmark")
+	case "Delivery", "Open", "Click", "SubscriptionChange":
+	default:
+		return nil, ErrUnknownWebhookFormat
+	}
+	return result, nil
+}
+
+// add добавляет событие, пропуская записи без корректного адреса
+func (r *WebhookResult) add(kind domain.DeliveryEventType, email string, bounceType domain.BounceType, detail, source string) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if !emailRegex.MatchString(email) {
+		return
+	}
+	detail = sanitizeHeaderValue(detail)
+	if len(detail) > maxDetailLength {
+		detail = strings.ToValidUTF8(detail[:maxDetailLength], "")
+	}
+	ev := domain.DeliveryEvent{Type: kind, Email: email, Detail: detail, Source: source}
+	if bounceType != "" {
+		ev.BounceType = &bounceType
+	}
+	r.Events = append(r.Events, ev)
+}
@@ -3,6 +3,7 @@ package errors
 import (
 	"github.com/RESERPIX/hubigr/internal/domain"
 	"github.com/RESERPIX/hubigr/internal/logger"
+	"github.com/RESERPIX/hubigr/internal/utils"
 	"github.com/gofiber/fiber/v2"
 )
 
@@ -22,11 +23,11 @@ func ErrorHandler(c *fiber.Ctx, err error) error {
 	if err != nil {
 		errorMsg = err.Error()
 	}
-	logger.Error("Request error",
+	logger.ErrorContext(c.UserContext(), "Request error",
 		"error", errorMsg,
 		"method", c.Method(),
 		"path", c.Path(),
-		"ip", c.IP(),
+		"ip", utils.ClientIP(c),
 		"status", code,
 	)
 
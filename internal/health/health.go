@@ -0,0 +1,144 @@
+package health
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+)
+
+// Статусы проверок
+const (
+	StatusUp   = "up"
+	StatusDown = "down"
+)
+
+// Check - проверка одной зависимости. Сбой необязательной проверки попадает
+// в отчет, но не делает сервис неготовым.
+type Check struct {
+	Name     string
+	Timeout  time.Duration
+	Optional bool
+	Run      func(ctx context.Context) error
+}
+
+// Result - результат одной проверки
+type Result struct {
+	Name       string  `json:"name"`
+	Status     string  `json:"status"`
+	Optional   bool    `json:"optional,omitempty"`
+	Error      string  `json:"error,omitempty"`
+	DurationMs float64 `json:"duration_ms"`
+}
+
+// Report - результат всех проверок
+type Report struct {
+	Ready     bool      `json:"ready"`
+	Checks    []Result  `json:"checks"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// Checker выполняет проверки готовности параллельно, каждую со своим таймаутом.
+// Результат кешируется на cacheTTL: пробы Kubernetes, compose и балансировщика
+// не должны нагружать БД и Redis.
+type Checker struct {
+	checks   []Check
+	cacheTTL time.Duration
+
+	mu       sync.Mutex
+	report   *Report
+	started  bool // хотя бы одна проверка прошла успешно
+	draining bool
+}
+
+// NewChecker создает проверку готовности из checks
+func NewChecker(cacheTTL time.Duration, checks ...Check) *Checker {
+	return &Checker{checks: checks, cacheTTL: cacheTTL}
+}
+
+// Ready возвращает отчет не старше cacheTTL. Одновременные запросы ждут одну проверку.
+func (c *Checker) Ready(ctx context.Context) Report {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.draining {
+		return Report{Ready: false, Checks: []Result{{Name: "shutdown", Status: StatusDown, Error: "service is shutting down"}}, CheckedAt: time.Now()}
+	}
+	if c.report != nil && time.Since(c.report.CheckedAt) < c.cacheTTL {
+		return *c.report
+	}
+
+	report := c.run(ctx)
+	c.report = &report
+	if report.Ready {
+		c.started = true
+	}
+	return report
+}
+
+// Started - прошла ли хотя бы одна проверка готовности (startup probe)
+func (c *Checker) Started(ctx context.Context) bool {
+	c.mu.Lock()
+	started := c.started
+	c.mu.Unlock()
+	if started {
+		return true
+	}
+	return c.Ready(ctx).Ready
+}
+
+// Drain переводит сервис в неготовые перед остановкой, чтобы балансировщик
+// перестал присылать новые запросы
+func (c *Checker) Drain() {
+	c.mu.Lock()
+	c.draining = true
+	c.mu.Unlock()
+}
+
+func (c *Checker) run(ctx context.Context) Report {
+	results := make([]Result, len(c.checks))
+	var wg sync.WaitGroup
+	for i, check := range c.checks {
+		wg.Add(1)
+		go func(i int, check Check) {
+			defer wg.Done()
+			checkCtx, cancel := context.WithTimeout(ctx, check.Timeout)
+			defer cancel()
+
+			start := time.Now()
+			err := check.Run(checkCtx)
+			result := Result{
+				Name:       check.Name,
+				Status:     StatusUp,
+				Optional:   check.Optional,
+				DurationMs: float64(time.Since(start).Microseconds()) / 1000,
+			}
+			if err != nil {
+				result.Status = StatusDown
+				result.Error = err.Error()
+			}
+			results[i] = result
+		}(i, check)
+	}
+	wg.Wait()
+
+	report := Report{Ready: true, Checks: results, CheckedAt: time.Now()}
+	for _, r := range results {
+		if r.Status == StatusDown && !r.Optional {
+			report.Ready = false
+		}
+	}
+	return report
+}
+
+// TCPCheck - доступен ли адрес по TCP (SMTP сервер и т.п.)
+func TCPCheck(addr string) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+}
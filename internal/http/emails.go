@@ -0,0 +1,212 @@
+package http
+
+import (
+	stderrors "errors"
+	"strconv"
+
+	"github.com/RESERPIX/hubigr/internal/domain"
+	"github.com/RESERPIX/hubigr/internal/email"
+	"github.com/RESERPIX/hubigr/internal/logger"
+	"github.com/RESERPIX/hubigr/internal/store"
+	"github.com/RESERPIX/hubigr/internal/utils"
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5"
+)
+
+// GetOutboxEmails - очередь писем для админа, по умолчанию все статусы
+func (h *Handlers) GetOutboxEmails(c *fiber.Ctx) error {
+	page := c.QueryInt("page", 1)
+	limit := c.QueryInt("limit", 20)
+
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	status := domain.EmailStatus(c.Query("status"))
+	if status != "" && !status.IsValid() {
+		return c.Status(400).JSON(domain.NewError("bad_request", "Неверный статус письма"))
+	}
+
+	emails, total, err := h.outboxRepo.List(c.UserContext(), status, limit, (page-1)*limit)
+	if err != nil {
+		return c.Status(500).JSON(domain.NewError("internal_error", "Ошибка получения писем"))
+	}
+
+	counts, err := h.outboxRepo.CountByStatus(c.UserContext())
+	if err != nil {
+		return c.Status(500).JSON(domain.NewError("internal_error", "Ошибка получения писем"))
+	}
+
+	return c.JSON(fiber.Map{
+		"emails":    emails,
+		"by_status": counts,
+		"total":     total,
+		"page":      page,
+		"limit":     limit,
+	})
+}
+
+// GetOutboxEmail - детали письма (без payload с токенами)
+func (h *Handlers) GetOutboxEmail(c *fiber.Ctx) error {
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(domain.NewError("bad_request", "Неверный ID письма"))
+	}
+
+	e, err := h.outboxRepo.GetByID(c.UserContext(), id)
+	if stderrors.Is(err, pgx.ErrNoRows) {
+		return c.Status(404).JSON(domain.NewError("not_found", "Письмо не найдено"))
+	}
+	if err != nil {
+		return c.Status(500).JSON(domain.NewError("internal_error", "Ошибка получения письма"))
+	}
+
+	return c.JSON(e)
+}
+
+// RetryOutboxEmail - повторная отправка письма из dead letter
+func (h *Handlers) RetryOutboxEmail(c *fiber.Ctx) error {
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(domain.NewError("bad_request", "Неверный ID письма"))
+	}
+
+	adminID, ok := c.Locals("user_id").(int64)
+	if !ok {
+		return c.Status(500).JSON(domain.NewError("internal_error", "Ошибка получения ID админа"))
+	}
+
+	retried, err := h.outboxRepo.Retry(c.UserContext(), id)
+	if stderrors.Is(err, store.ErrOutboxTokenExpired) {
+		logger.InfoContext(c.UserContext(), "Admin email retry cancelled: token superseded or expired",
+			"admin_id", adminID,
+			"email_id", id,
+		)
+		return c.Status(409).JSON(domain.NewError("token_expired", "Ссылка в письме больше не действует, письмо отменено"))
+	}
+	if err != nil {
+		return c.Status(500).JSON(domain.NewError("internal_error", "Ошибка повтора отправки"))
+	}
+	if !retried {
+		return c.Status(409).JSON(domain.NewError("conflict", "Письмо уже отправлено или отправляется"))
+	}
+
+	logger.InfoContext(c.UserContext(), "Admin email retry",
+		"admin_id", adminID,
+		"email_id", id,
+	)
+
+	return c.JSON(fiber.Map{"message": "Письмо поставлено в очередь"})
+}
+
+// GetEmailTemplates - список шаблонов писем и языков для предпросмотра
+func (h *Handlers) GetEmailTemplates(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{
+		"templates": h.emailRenderer.Templates(),
+		"locales":   email.Locales,
+	})
+}
+
+// PreviewEmailTemplate - рендер шаблона с тестовыми данными.
+// format=html (по умолчанию) и text отдают готовое тело, json - тему и обе версии.
+func (h *Handlers) PreviewEmailTemplate(c *fiber.Ctx) error {
+	locale := c.Query("locale", domain.DefaultLocale)
+	if !domain.IsSupportedLocale(locale) {
+		return c.Status(400).JSON(domain.NewError("bad_request", "Неподдерживаемый язык"))
+	}
+
+	rendered, err := h.emailRenderer.Preview(c.Params("name"), locale, h.baseURL)
+	if stderrors.Is(err, email.ErrUnknownTemplate) {
+		return c.Status(404).JSON(domain.NewError("not_found", "Шаблон не найден"))
+	}
+	if err != nil {
+		logger.ErrorContext(c.UserContext(), "Failed to render email template", "template", c.Params("name"), "error", err)
+		return c.Status(500).JSON(domain.NewError("internal_error", "Ошибка рендера шаблона"))
+	}
+
+	switch c.Query("format", "html") {
+	case "html":
+		c.Set(fiber.HeaderContentType, fiber.MIMETextHTMLCharsetUTF8)
+		return c.SendString(rendered.HTML)
+	case "text":
+		c.Set(fiber.HeaderContentType, fiber.MIMETextPlainCharsetUTF8)
+		return c.SendString(rendered.Text)
+	case "json":
+		return c.JSON(fiber.Map{
+			"subject": rendered.Subject,
+			"text":    rendered.Text,
+			"html":    rendered.HTML,
+		})
+	}
+	return c.Status(400).JSON(domain.NewError("bad_request", "Формат должен быть html, text или json"))
+}
+
+// EmailDeliveryWebhook - уведомления провайдера о bounce и жалобах
+func (h *Handlers) EmailDeliveryWebhook(c *fiber.Ctx) error {
+	result, err := email.ParseDeliveryWebhook(c.Body())
+	if err != nil {
+		return c.Status(400).JSON(domain.NewError("bad_request", "Неподдерживаемый формат уведомления"))
+	}
+
+	if result.SubscribeURL != "" {
+		// Подписку SNS подтверждаем вручную, сами по ссылке из запроса не ходим
+		logger.WarnContext(c.UserContext(), "Email webhook subscription confirmation received", "subscribe_url", utils.SanitizeForLog(result.SubscribeURL))
+		return c.JSON(fiber.Map{"message": "Подтвердите подписку по ссылке из лога"})
+	}
+
+	suppressed := 0
+	for _, ev := range result.Events {
+		isSuppressed, err := h.deliveryRepo.RecordEvent(c.UserContext(), ev)
+		if err != nil {
+			logger.ErrorContext(c.UserContext(), "Failed to record email delivery event", "error", err, "email", utils.SanitizeEmail(ev.Email))
+			// 5xx - провайдер повторит доставку webhook
+			return c.Status(500).JSON(domain.NewError("internal_error", "Ошибка сохранения события"))
+		}
+		if isSuppressed {
+			suppressed++
+		}
+		logger.InfoContext(c.UserContext(), "Email delivery event",
+			"type", ev.Type,
+			"email", utils.SanitizeEmail(ev.Email),
+			"source", ev.Source,
+			"suppressed", isSuppressed,
+		)
+	}
+
+	return c.JSON(fiber.Map{
+		"processed":  len(result.Events),
+		"suppressed": suppressed,
+	})
+}
+
+// RemoveEmailSuppression - снять подавление адреса пользователя
+func (h *Handlers) RemoveEmailSuppression(c *fiber.Ctx) error {
+	userID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(domain.NewError("bad_request", "Неверный ID пользователя"))
+	}
+
+	adminID, ok := c.Locals("user_id").(int64)
+	if !ok {
+		return c.Status(500).JSON(domain.NewError("internal_error", "Ошибка получения ID админа"))
+	}
+
+	removed, err := h.deliveryRepo.RemoveSuppression(c.UserContext(), userID)
+	if stderrors.Is(err, pgx.ErrNoRows) {
+		return c.Status(404).JSON(domain.NewError("not_found", "Пользователь не найден"))
+	}
+	if err != nil {
+		return c.Status(500).JSON(domain.NewError("internal_error", "Ошибка снятия подавления"))
+	}
+
+	logger.InfoContext(c.UserContext(), "Admin removed email suppression",
+		"admin_id", adminID,
+		"user_id", userID,
+		"removed", removed,
+	)
+
+	return c.JSON(fiber.Map{"message": "Отправка писем пользователю возобновлена"})
+}
@@ -1,21 +1,30 @@
 package http
 
 import (
+	"context"
+	stderrors "errors"
 	"fmt"
 	"mime/multipart"
+	"net/url"
 	"strconv"
 	"strings"
 
 	"github.com/RESERPIX/hubigr/internal/captcha"
 	"github.com/RESERPIX/hubigr/internal/domain"
+	"github.com/RESERPIX/hubigr/internal/email"
+	"github.com/RESERPIX/hubigr/internal/health"
 	"github.com/RESERPIX/hubigr/internal/logger"
 	"github.com/RESERPIX/hubigr/internal/metrics"
+	"github.com/RESERPIX/hubigr/internal/monitoring"
 	"github.com/RESERPIX/hubigr/internal/ratelimit"
+	"github.com/RESERPIX/hubigr/internal/realtime"
 	"github.com/RESERPIX/hubigr/internal/security"
 	"github.com/RESERPIX/hubigr/internal/store"
+	"github.com/RESERPIX/hubigr/internal/tracing"
 	"github.com/RESERPIX/hubigr/internal/utils"
 	"github.com/RESERPIX/hubigr/internal/validation"
 	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5"
 )
 
 
@@ -23,28 +32,33 @@ import (
 type Handlers struct {
 	userRepo       *store.UserRepo
 	refreshRepo    *store.RefreshTokenRepo
+	notificationRepo *store.NotificationRepo
+	outboxRepo     *store.EmailOutboxRepo
+	deliveryRepo   *store.EmailDeliveryRepo
+	hub            *realtime.Hub
 	limiter        *ratelimit.RedisLimiter
-	emailSender    EmailSender
+	rateLimits     ratelimit.Policies
+	acl            *ratelimit.ACL
+	aclRepo        *store.RateLimitACLRepo
+	alerts         *monitoring.AlertManager
+	readiness      *health.Checker
 	avatarUploader AvatarUploader
 	jwtSecret      string
 	turnstile      *captcha.TurnstileService
+	emailRenderer  *email.Renderer
+	baseURL        string
 	// TTL Policies
 	accessTokenTTL  int
 	refreshTokenTTL int
 }
 
 type AvatarUploader interface {
-	UploadAvatar(userID int64, file *multipart.FileHeader) (string, error)
-	DeleteAvatar(avatarURL string) error
+	UploadAvatar(ctx context.Context, userID int64, file *multipart.FileHeader) (string, error)
+	DeleteAvatar(ctx context.Context, avatarURL string) error
 }
 
-type EmailSender interface {
-	SendVerificationEmail(to, token string) error
-	SendPasswordResetEmail(to, token string) error
-}
-
-func NewHandlers(userRepo *store.UserRepo, refreshRepo *store.RefreshTokenRepo, limiter *ratelimit.RedisLimiter, emailSender EmailSender, avatarUploader AvatarUploader, jwtSecret string, turnstile *captcha.TurnstileService, accessTTL, refreshTTL int) *Handlers {
-	return &Handlers{userRepo: userRepo, refreshRepo: refreshRepo, limiter: limiter, emailSender: emailSender, avatarUploader: avatarUploader, jwtSecret: jwtSecret, turnstile: turnstile, accessTokenTTL: accessTTL, refreshTokenTTL: refreshTTL}
+func NewHandlers(userRepo *store.UserRepo, refreshRepo *store.RefreshTokenRepo, notificationRepo *store.NotificationRepo, hub *realtime.Hub, limiter *ratelimit.RedisLimiter, rateLimits ratelimit.Policies, acl *ratelimit.ACL, aclRepo *store.RateLimitACLRepo, outboxRepo *store.EmailOutboxRepo, deliveryRepo *store.EmailDeliveryRepo, alerts *monitoring.AlertManager, readiness *health.Checker, avatarUploader AvatarUploader, jwtSecret string, turnstile *captcha.TurnstileService, emailRenderer *email.Renderer, baseURL string, accessTTL, refreshTTL int) *Handlers {
+	return &Handlers{userRepo: userRepo, refreshRepo: refreshRepo, notificationRepo: notificationRepo, hub: hub, limiter: limiter, rateLimits: rateLimits, acl: acl, aclRepo: aclRepo, outboxRepo: outboxRepo, deliveryRepo: deliveryRepo, alerts: alerts, readiness: readiness, avatarUploader: avatarUploader, jwtSecret: jwtSecret, turnstile: turnstile, emailRenderer: emailRenderer, baseURL: baseURL, accessTokenTTL: accessTTL, refreshTokenTTL: refreshTTL}
 }
 
 // SignUp - UC-1.1.1 из ТЗ
@@ -53,22 +67,42 @@ func (h *Handlers) SignUp(c *fiber.Ctx) error {
 	if err := c.BodyParser(&req); err != nil {
 		return c.Status(400).JSON(domain.NewError("bad_request", "Неверный формат данных"))
 	}
+	// Без явного выбора берем язык из браузера
+	if req.Locale == "" {
+		req.Locale = utils.PreferredLocale(c.Get("Accept-Language"))
+	}
 
 	// Валидация согласно ТЗ
 	if errors := validation.ValidateSignUp(req); len(errors) > 0 {
 		return c.Status(422).JSON(domain.NewError("validation_error", strings.Join(errors, "; ")))
 	}
 
+	// Хэндл не должен совпадать с текущими и старыми хэндлами других пользователей
+	if req.Handle != "" {
+		available, err := h.userRepo.IsHandleAvailable(c.UserContext(), req.Handle, 0)
+		if err != nil {
+			return c.Status(500).JSON(domain.NewError("internal_error", "Ошибка проверки хэндла"))
+		}
+		if !available {
+			return c.Status(409).JSON(domain.NewError("handle_taken", "Этот хэндл уже занят"))
+		}
+	}
+
 	// Хеширование пароля
+	_, span := tracing.Start(c.UserContext(), "bcrypt.hash")
 	hash, err := security.HashPassword(req.Password)
+	span.End()
 	if err != nil {
 		return c.Status(500).JSON(domain.NewError("internal_error", "Ошибка сервера"))
 	}
 
 	// Создание пользователя
-	userID, err := h.userRepo.CreateUser(c.Context(), req, hash)
+	userID, err := h.userRepo.CreateUser(c.UserContext(), req, hash)
 	if err != nil {
-		if strings.Contains(err.Error(), "duplicate") {
+		if stderrors.Is(err, store.ErrHandleTaken) {
+			return c.Status(409).JSON(domain.NewError("handle_taken", "Этот хэндл уже занят"))
+		}
+		if stderrors.Is(err, store.ErrEmailTaken) {
 			return c.Status(409).JSON(domain.NewError("conflict", "Пользователь с таким email уже зарегистрирован"))
 		}
 		return c.Status(500).JSON(domain.NewError("internal_error", "Ошибка создания пользователя"))
@@ -79,16 +113,11 @@ func (h *Handlers) SignUp(c *fiber.Ctx) error {
 	if err != nil {
 		return c.Status(500).JSON(domain.NewError("internal_error", "Ошибка генерации токена"))
 	}
-	if err := h.userRepo.CreateVerifyToken(c.Context(), userID, token); err != nil {
+	// Письмо с подтверждением ставится в outbox вместе с токеном и уходит в фоне
+	if err := h.userRepo.CreateVerifyToken(c.UserContext(), userID, req.Email, token); err != nil {
+		logger.ErrorContext(c.UserContext(), "Failed to create verification token", "error", err, "email", utils.SanitizeEmail(req.Email))
 		return c.Status(500).JSON(domain.NewError("internal_error", "Ошибка создания токена"))
 	}
-
-	// Отправка email с подтверждением
-	if err := h.emailSender.SendVerificationEmail(req.Email, token); err != nil {
-		logger.Error("Failed to send verification email", "error", err, "email", utils.SanitizeEmail(req.Email))
-	} else {
-		metrics.IncrementEmailSent()
-	}
 	
 	// Метрика регистрации
 	metrics.IncrementUserRegistered()
@@ -109,14 +138,17 @@ func (h *Handlers) Login(c *fiber.Ctx) error {
 
 
 	// Получение пользователя
-	user, err := h.userRepo.GetByEmail(c.Context(), req.Email)
+	user, err := h.userRepo.GetByEmail(c.UserContext(), req.Email)
 	if err != nil || user == nil {
 		metrics.IncrementLoginAttempt(false)
 		return c.Status(401).JSON(domain.NewError("unauthorized", "Неверный email или пароль"))
 	}
 
 	// Проверка пароля
-	if !security.CheckPassword(user.Hash, req.Password) {
+	_, span := tracing.Start(c.UserContext(), "bcrypt.compare")
+	passwordOK := security.CheckPassword(user.Hash, req.Password)
+	span.End()
+	if !passwordOK {
 		metrics.IncrementLoginAttempt(false)
 		return c.Status(401).JSON(domain.NewError("unauthorized", "Неверный email или пароль"))
 	}
@@ -139,8 +171,8 @@ func (h *Handlers) Login(c *fiber.Ctx) error {
 
 	// Создание refresh token
 	deviceInfo := c.Get("User-Agent")
-	ipAddress := c.IP()
-	refreshToken, err := h.refreshRepo.Create(c.Context(), user.ID, deviceInfo, ipAddress, h.refreshTokenTTL)
+	ipAddress := utils.ClientIP(c)
+	refreshToken, err := h.refreshRepo.Create(c.UserContext(), user.ID, deviceInfo, ipAddress, h.refreshTokenTTL)
 	if err != nil {
 		return c.Status(500).JSON(domain.NewError("internal_error", "Ошибка создания refresh токена"))
 	}
@@ -165,14 +197,16 @@ func (h *Handlers) VerifyEmail(c *fiber.Ctx) error {
 		return c.Status(400).JSON(domain.NewError("bad_request", "Токен обязателен"))
 	}
 
-	success, err := h.userRepo.VerifyEmail(c.Context(), token)
+	success, err := h.userRepo.VerifyEmail(c.UserContext(), token)
 	if err != nil {
 		return c.Status(500).JSON(domain.NewError("internal_error", "Ошибка подтверждения"))
 	}
 
 	if !success {
+		metrics.IncrementEmailVerification(false)
 		return c.Status(400).JSON(domain.NewError("invalid_token", "Токен недействителен или истек"))
 	}
+	metrics.IncrementEmailVerification(true)
 
 	return c.JSON(fiber.Map{"message": "Email успешно подтвержден"})
 }
@@ -181,75 +215,54 @@ func (h *Handlers) VerifyEmail(c *fiber.Ctx) error {
 func (h *Handlers) Logout(c *fiber.Ctx) error {
 	userID, ok := c.Locals("user_id").(int64)
 	if ok {
-		h.refreshRepo.RevokeUserTokens(c.Context(), userID)
+		h.refreshRepo.RevokeUserTokens(c.UserContext(), userID)
 	}
 	return c.JSON(fiber.Map{"message": "Вы успешно вышли из системы"})
 }
 
-// Health - проверка здоровья сервиса
+// Health - подробное состояние сервиса для админов: проверки зависимостей,
+// pools, сработавшие алерты и метрики. Для проб - Livez, Readyz, Startupz.
 func (h *Handlers) Health(c *fiber.Ctx) error {
-	ctx := c.Context()
+	report := h.readiness.Ready(c.UserContext())
+	alerts := h.alerts.Active()
+
 	status := "healthy"
 	statusCode := 200
-	
-	// Проверка БД
-	dbErr := h.userRepo.Ping(ctx)
-	if dbErr != nil {
-		status = "unhealthy"
-		statusCode = 503
-	}
-
-	// Проверка Redis
-	redisErr := h.limiter.Ping(ctx)
-	if redisErr != nil {
+	if !report.Ready {
 		status = "unhealthy"
 		statusCode = 503
-	}
-
-	// Проверка метрик
-	m := metrics.GetMetrics()
-	snapshot := m.GetSnapshot()
-	
-	// Простые алерты
-	alerts := []string{}
-	if failedLogins, ok := snapshot["failed_logins"].(int64); ok && failedLogins > 10 {
-		alerts = append(alerts, "High failed login rate")
-	}
-	if len(alerts) > 0 {
+	} else if len(alerts) > 0 || hasFailedCheck(report) {
 		status = "degraded"
 	}
 
+	redisStats := h.limiter.GetClient().PoolStats()
 	response := fiber.Map{
-		"status":   status,
-		"database": map[string]interface{}{"status": "up", "error": dbErr},
-		"redis":    map[string]interface{}{"status": "up", "error": redisErr},
-		"version":  "1.0.0",
-		"alerts":   alerts,
-		"metrics":  snapshot,
-	}
-	
-	if dbErr != nil {
-		response["database"] = map[string]interface{}{"status": "down", "error": dbErr.Error()}
-	}
-	if redisErr != nil {
-		response["redis"] = map[string]interface{}{"status": "down", "error": redisErr.Error()}
+		"status":     status,
+		"version":    "1.0.0",
+		"checks":     report.Checks,
+		"checked_at": report.CheckedAt,
+		"database": fiber.Map{
+			"status":     checkStatus(report, "database"),
+			"pool_stats": h.userRepo.GetPoolStats(),
+		},
+		"redis": fiber.Map{
+			"status": checkStatus(report, "redis"),
+			"pool_stats": fiber.Map{
+				"hits":        redisStats.Hits,
+				"misses":      redisStats.Misses,
+				"timeouts":    redisStats.Timeouts,
+				"total_conns": redisStats.TotalConns,
+				"idle_conns":  redisStats.IdleConns,
+				"stale_conns": redisStats.StaleConns,
+			},
+		},
+		"alerts":  alerts,
+		"metrics": metrics.GetSnapshot(),
 	}
 
 	return c.Status(statusCode).JSON(response)
 }
 
-// Metrics - эндпоинт для метрик
-func (h *Handlers) Metrics(c *fiber.Ctx) error {
-	m := metrics.GetMetrics()
-	return c.JSON(m.GetSnapshot())
-}
-
-// PrometheusMetrics - эндпоинт для Prometheus
-func (h *Handlers) PrometheusMetrics(c *fiber.Ctx) error {
-	c.Set("Content-Type", "text/plain; charset=utf-8")
-	return c.SendString(metrics.PrometheusFormat())
-}
-
 // GetProfile - UC-1.2.2 из ТЗ
 func (h *Handlers) GetProfile(c *fiber.Ctx) error {
 	userID, ok := c.Locals("user_id").(int64)
@@ -257,7 +270,7 @@ func (h *Handlers) GetProfile(c *fiber.Ctx) error {
 		return c.Status(500).JSON(domain.NewError("internal_error", "Ошибка получения ID пользователя"))
 	}
 
-	user, err := h.userRepo.GetByID(c.Context(), userID)
+	user, err := h.userRepo.GetByID(c.UserContext(), userID)
 	if err != nil {
 		return c.Status(404).JSON(domain.NewError("not_found", "Пользователь не найден"))
 	}
@@ -285,13 +298,90 @@ func (h *Handlers) UpdateProfile(c *fiber.Ctx) error {
 		return c.Status(422).JSON(domain.NewError("validation_error", strings.Join(errors, "; ")))
 	}
 
-	if err := h.userRepo.UpdateProfile(c.Context(), userID, req); err != nil {
+	// Аватар меняется только загрузкой через POST /profile/avatar; здесь его
+	// можно оставить прежним или удалить пустой строкой
+	var oldAvatar string
+	if req.Avatar != nil {
+		user, err := h.userRepo.GetByID(c.UserContext(), userID)
+		if err != nil {
+			return c.Status(404).JSON(domain.NewError("not_found", "Пользователь не найден"))
+		}
+		if user.Avatar != nil {
+			oldAvatar = *user.Avatar
+		}
+		if *req.Avatar != "" && *req.Avatar != oldAvatar {
+			return c.Status(422).JSON(domain.NewError("validation_error", "Аватар загружается через POST /profile/avatar"))
+		}
+	}
+
+	if err := h.userRepo.UpdateProfile(c.UserContext(), userID, req); err != nil {
 		return c.Status(500).JSON(domain.NewError("internal_error", "Ошибка обновления профиля"))
 	}
 
+	if req.Avatar != nil && *req.Avatar == "" && oldAvatar != "" {
+		// Если файл не удалится, его уберет задача orphaned_avatars
+		if err := h.avatarUploader.DeleteAvatar(c.UserContext(), oldAvatar); err != nil {
+			logger.ErrorContext(c.UserContext(), "Failed to delete removed avatar", "error", err, "user_id", userID)
+		}
+	}
+
 	return c.JSON(fiber.Map{"message": "Профиль обновлен"})
 }
 
+// UpdateHandle - смена уникального хэндла профиля
+func (h *Handlers) UpdateHandle(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(int64)
+	if !ok {
+		return c.Status(500).JSON(domain.NewError("internal_error", "Ошибка получения ID пользователя"))
+	}
+
+	var req domain.UpdateHandleRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(domain.NewError("bad_request", "Неверный формат данных"))
+	}
+
+	if errors := validation.ValidateHandle(req.Handle); len(errors) > 0 {
+		return c.Status(422).JSON(domain.NewError("validation_error", strings.Join(errors, "; ")))
+	}
+
+	err := h.userRepo.ChangeHandle(c.UserContext(), userID, req.Handle)
+	switch {
+	case stderrors.Is(err, store.ErrHandleTaken):
+		return c.Status(409).JSON(domain.NewError("handle_taken", "Этот хэндл уже занят"))
+	case stderrors.Is(err, store.ErrHandleCooldown):
+		return c.Status(429).JSON(domain.NewError("handle_cooldown",
+			fmt.Sprintf("Хэндл можно менять не чаще одного раза в %d дней", domain.HandleChangeCooldownDays)))
+	case err != nil:
+		return c.Status(500).JSON(domain.NewError("internal_error", "Ошибка смены хэндла"))
+	}
+
+	return c.JSON(fiber.Map{"message": "Хэндл обновлен", "handle": req.Handle})
+}
+
+// GetPublicProfile - публичный профиль по хэндлу с редиректом со старых хэндлов
+func (h *Handlers) GetPublicProfile(c *fiber.Ctx) error {
+	handle := c.Params("handle")
+	if handle == "" {
+		return c.Status(400).JSON(domain.NewError("bad_request", "Хэндл обязателен"))
+	}
+
+	profile, err := h.userRepo.GetPublicProfileByHandle(c.UserContext(), handle)
+	if err == nil {
+		return c.JSON(profile)
+	}
+	if !stderrors.Is(err, pgx.ErrNoRows) {
+		return c.Status(500).JSON(domain.NewError("internal_error", "Ошибка получения профиля"))
+	}
+
+	// Хэндл мог смениться - отправляем на актуальный адрес, чтобы старые ссылки не ломались
+	current, err := h.userRepo.ResolveOldHandle(c.UserContext(), handle)
+	if err != nil {
+		return c.Status(404).JSON(domain.NewError("not_found", "Пользователь не найден"))
+	}
+
+	return c.Redirect("/api/v1/users/"+url.PathEscape(current), fiber.StatusMovedPermanently)
+}
+
 // UpdateNotifications - UC-1.2.3 из ТЗ
 func (h *Handlers) UpdateNotifications(c *fiber.Ctx) error {
 	userID, ok := c.Locals("user_id").(int64)
@@ -304,8 +394,31 @@ func (h *Handlers) UpdateNotifications(c *fiber.Ctx) error {
 		return c.Status(400).JSON(domain.NewError("bad_request", "Неверный формат данных"))
 	}
 
+	// Периодичность дайджеста необязательна, по умолчанию ежедневно
+	if settings.EmailDigest == "" {
+		settings.EmailDigest = domain.DigestDaily
+	}
+	if !settings.EmailDigest.IsValid() {
+		return c.Status(422).JSON(domain.NewError("validation_error", "Периодичность дайджеста: daily или weekly"))
+	}
+	for _, t := range settings.Channels.EmailOptOut {
+		if !t.IsValid() {
+			return c.Status(422).JSON(domain.NewError("validation_error", "Неизвестный тип уведомления в email_opt_out"))
+		}
+	}
+
+	// Без email_opt_out в запросе сохраняем отписки, сделанные по ссылкам из
+	// писем; пустой массив их сбрасывает
+	if settings.Channels.EmailOptOut == nil {
+		current, err := h.userRepo.GetNotificationSettings(c.UserContext(), userID)
+		if err != nil {
+			return c.Status(500).JSON(domain.NewError("internal_error", "Ошибка получения настроек"))
+		}
+		settings.Channels.EmailOptOut = current.Channels.EmailOptOut
+	}
+
 	settings.UserID = userID
-	if err := h.userRepo.UpdateNotificationSettings(c.Context(), userID, settings); err != nil {
+	if err := h.userRepo.UpdateNotificationSettings(c.UserContext(), userID, settings); err != nil {
 		return c.Status(500).JSON(domain.NewError("internal_error", "Ошибка сохранения настроек"))
 	}
 
@@ -319,7 +432,7 @@ func (h *Handlers) GetNotifications(c *fiber.Ctx) error {
 		return c.Status(500).JSON(domain.NewError("internal_error", "Ошибка получения ID пользователя"))
 	}
 
-	settings, err := h.userRepo.GetNotificationSettings(c.Context(), userID)
+	settings, err := h.userRepo.GetNotificationSettings(c.UserContext(), userID)
 	if err != nil {
 		return c.Status(500).JSON(domain.NewError("internal_error", "Ошибка получения настроек"))
 	}
@@ -337,7 +450,7 @@ func (h *Handlers) ResendVerification(c *fiber.Ctx) error {
 	}
 
 	// Получение пользователя
-	user, err := h.userRepo.GetByEmail(c.Context(), req.Email)
+	user, err := h.userRepo.GetByEmail(c.UserContext(), req.Email)
 	if err != nil || user == nil {
 		// Не раскрываем существование email
 		return c.JSON(fiber.Map{"message": "Если email существует, мы отправим новую ссылку"})
@@ -353,15 +466,12 @@ func (h *Handlers) ResendVerification(c *fiber.Ctx) error {
 	if err != nil {
 		return c.Status(500).JSON(domain.NewError("internal_error", "Ошибка генерации токена"))
 	}
-	if err := h.userRepo.CreateVerifyToken(c.Context(), user.ID, token); err != nil {
+	// Письмо ставится в outbox вместе с токеном
+	if err := h.userRepo.CreateVerifyToken(c.UserContext(), user.ID, user.Email, token); err != nil {
+		logger.ErrorContext(c.UserContext(), "Failed to create verification token", "error", err, "email", utils.SanitizeEmail(req.Email))
 		return c.Status(500).JSON(domain.NewError("internal_error", "Ошибка создания токена"))
 	}
 
-	// Отправка email
-	if err := h.emailSender.SendVerificationEmail(req.Email, token); err != nil {
-		logger.Error("Failed to send verification email", "error", err, "email", utils.SanitizeEmail(req.Email))
-	}
-
 	return c.JSON(fiber.Map{"message": "Новая ссылка отправлена на email"})
 }
 
@@ -375,7 +485,7 @@ func (h *Handlers) ResetPasswordRequest(c *fiber.Ctx) error {
 	}
 
 	// Получение пользователя
-	user, err := h.userRepo.GetByEmail(c.Context(), req.Email)
+	user, err := h.userRepo.GetByEmail(c.UserContext(), req.Email)
 	if err != nil || user == nil {
 		// Не раскрываем существование email для безопасности
 		return c.JSON(fiber.Map{"message": "Мы отправили ссылку на email"})
@@ -386,14 +496,12 @@ func (h *Handlers) ResetPasswordRequest(c *fiber.Ctx) error {
 	if err != nil {
 		return c.Status(500).JSON(domain.NewError("internal_error", "Ошибка генерации токена"))
 	}
-	if err := h.userRepo.CreateResetToken(c.Context(), user.ID, token); err != nil {
+	// Письмо ставится в outbox вместе с токеном
+	if err := h.userRepo.CreateResetToken(c.UserContext(), user.ID, user.Email, token); err != nil {
+		logger.ErrorContext(c.UserContext(), "Failed to create reset token", "error", err, "email", utils.SanitizeEmail(req.Email))
 		return c.Status(500).JSON(domain.NewError("internal_error", "Ошибка создания токена"))
 	}
-
-	// Отправка email
-	if err := h.emailSender.SendPasswordResetEmail(req.Email, token); err != nil {
-		logger.Error("Failed to send reset email", "error", err, "email", utils.SanitizeEmail(req.Email))
-	}
+	metrics.IncrementPasswordResetRequested()
 
 	return c.JSON(fiber.Map{"message": "Мы отправили ссылку на email"})
 }
@@ -418,23 +526,27 @@ func (h *Handlers) ResetPasswordConfirm(c *fiber.Ctx) error {
 	}
 
 	// Хеширование нового пароля
+	_, span := tracing.Start(c.UserContext(), "bcrypt.hash")
 	hash, err := security.HashPassword(req.Password)
+	span.End()
 	if err != nil {
 		return c.Status(500).JSON(domain.NewError("internal_error", "Ошибка сервера"))
 	}
 
 	// Сброс пароля и всех сессий
-	success, userID, err := h.userRepo.ResetPassword(c.Context(), req.Token, hash)
+	success, userID, err := h.userRepo.ResetPassword(c.UserContext(), req.Token, hash)
 	if err != nil {
 		return c.Status(500).JSON(domain.NewError("internal_error", "Ошибка сброса пароля"))
 	}
 
 	if !success {
+		metrics.IncrementPasswordResetConfirmed(false)
 		return c.Status(400).JSON(domain.NewError("invalid_token", "Токен недействителен или истек"))
 	}
+	metrics.IncrementPasswordResetConfirmed(true)
 
 	// Отзываем все refresh токены при смене пароля
-	h.refreshRepo.RevokeUserTokens(c.Context(), userID)
+	h.refreshRepo.RevokeUserTokens(c.UserContext(), userID)
 
 	return c.JSON(fiber.Map{"message": "Пароль успешно изменен"})
 }
@@ -458,7 +570,7 @@ func (h *Handlers) GetMySubmissions(c *fiber.Ctx) error {
 		limit = 20
 	}
 
-	submissions, total, err := h.userRepo.GetUserSubmissions(c.Context(), userID, page, limit)
+	submissions, total, err := h.userRepo.GetUserSubmissions(c.UserContext(), userID, page, limit)
 	if err != nil {
 		return c.Status(500).JSON(domain.NewError("internal_error", "Ошибка получения сабмитов"))
 	}
@@ -485,33 +597,36 @@ func (h *Handlers) UploadAvatar(c *fiber.Ctx) error {
 	}
 
 	// Получение текущего аватара для удаления
-	user, err := h.userRepo.GetByID(c.Context(), userID)
+	user, err := h.userRepo.GetByID(c.UserContext(), userID)
 	if err != nil {
 		return c.Status(404).JSON(domain.NewError("not_found", "Пользователь не найден"))
 	}
 
 	// Загрузка нового аватара
-	avatarURL, err := h.avatarUploader.UploadAvatar(userID, file)
+	avatarURL, err := h.avatarUploader.UploadAvatar(c.UserContext(), userID, file)
 	if err != nil {
 		return c.Status(422).JSON(domain.NewError("upload_error", err.Error()))
 	}
 
 	// Обновление профиля
-	if err := h.userRepo.UpdateAvatar(c.Context(), userID, avatarURL); err != nil {
-		// Удаляем загруженный файл при ошибке
-		h.avatarUploader.DeleteAvatar(avatarURL)
+	if err := h.userRepo.UpdateAvatar(c.UserContext(), userID, avatarURL); err != nil {
+		// Удаляем загруженный файл при ошибке, если это не текущий аватар
+		if user.Avatar == nil || *user.Avatar != avatarURL {
+			h.avatarUploader.DeleteAvatar(c.UserContext(), avatarURL)
+		}
 		return c.Status(500).JSON(domain.NewError("internal_error", "Ошибка обновления профиля"))
 	}
 
-	// Удаляем старый аватар
-	if user.Avatar != nil && *user.Avatar != "" {
-		if err := h.avatarUploader.DeleteAvatar(*user.Avatar); err != nil {
-			logger.Error("Failed to delete old avatar", "error", err, "user_id", userID)
+	// Удаляем старый аватар; та же картинка дает тот же URL, его не трогаем
+	if user.Avatar != nil && *user.Avatar != "" && *user.Avatar != avatarURL {
+		if err := h.avatarUploader.DeleteAvatar(c.UserContext(), *user.Avatar); err != nil {
+			logger.ErrorContext(c.UserContext(), "Failed to delete old avatar", "error", err, "user_id", userID)
 		}
 	}
 
 	return c.JSON(fiber.Map{
 		"avatar_url": avatarURL,
+		"avatars":    domain.AvatarVariants(&avatarURL),
 		"message":    "Аватар обновлен",
 	})
 }
@@ -524,13 +639,14 @@ func (h *Handlers) RefreshToken(c *fiber.Ctx) error {
 	}
 
 	// Проверяем и обновляем refresh token
-	oldToken, newRefreshToken, err := h.refreshRepo.ValidateAndRotate(c.Context(), req.RefreshToken)
+	oldToken, newRefreshToken, err := h.refreshRepo.ValidateAndRotate(c.UserContext(), req.RefreshToken)
 	if err != nil {
+		metrics.IncrementTokenRefresh(false)
 		return c.Status(401).JSON(domain.NewError("unauthorized", "Недействительный refresh token"))
 	}
 
 	// Получаем пользователя
-	user, err := h.userRepo.GetByID(c.Context(), oldToken.UserID)
+	user, err := h.userRepo.GetByID(c.UserContext(), oldToken.UserID)
 	if err != nil {
 		return c.Status(404).JSON(domain.NewError("not_found", "Пользователь не найден"))
 	}
@@ -548,6 +664,7 @@ func (h *Handlers) RefreshToken(c *fiber.Ctx) error {
 
 	// Очищаем хеш пароля
 	user.Hash = ""
+	metrics.IncrementTokenRefresh(true)
 
 	return c.JSON(domain.AuthResponse{
 		User:         *user,
@@ -573,7 +690,7 @@ func (h *Handlers) GetUsers(c *fiber.Ctx) error {
 
 	offset := (page - 1) * limit
 
-	users, total, err := h.userRepo.GetUsers(c.Context(), limit, offset)
+	users, total, err := h.userRepo.GetUsers(c.UserContext(), limit, offset)
 	if err != nil {
 		return c.Status(500).JSON(domain.NewError("internal_error", "Ошибка получения пользователей"))
 	}
@@ -607,15 +724,7 @@ func (h *Handlers) UpdateUserRole(c *fiber.Ctx) error {
 	}
 
 	// Валидация роли
-	validRoles := map[string]bool{
-		"participant": true,
-		"jury":        true,
-		"moderator":   true,
-		"admin":       true,
-		"organizer":   true,
-	}
-
-	if !validRoles[req.Role] {
+	if !domain.IsValidRole(req.Role) {
 		return c.Status(400).JSON(domain.NewError("invalid_role", "Неверная роль"))
 	}
 
@@ -626,13 +735,13 @@ func (h *Handlers) UpdateUserRole(c *fiber.Ctx) error {
 	}
 
 	// Логируем действие
-	logger.Info("Admin role update",
+	logger.InfoContext(c.UserContext(), "Admin role update",
 		"admin_id", adminID,
 		"target_user_id", userID,
 		"new_role", req.Role,
 	)
 
-	if err := h.userRepo.UpdateUserRole(c.Context(), userID, req.Role); err != nil {
+	if err := h.userRepo.UpdateUserRole(c.UserContext(), userID, req.Role); err != nil {
 		return c.Status(500).JSON(domain.NewError("internal_error", "Ошибка обновления роли"))
 	}
 
@@ -672,20 +781,21 @@ func (h *Handlers) BanUser(c *fiber.Ctx) error {
 		action = "unban"
 	}
 
-	logger.Info("Admin user ban/unban",
+	logger.InfoContext(c.UserContext(), "Admin user ban/unban",
 		"admin_id", adminID,
 		"target_user_id", userID,
 		"action", action,
 		"reason", req.Reason,
 	)
 
-	if err := h.userRepo.UpdateUserBanStatus(c.Context(), userID, req.Banned); err != nil {
+	if err := h.userRepo.UpdateUserBanStatus(c.UserContext(), userID, req.Banned); err != nil {
 		return c.Status(500).JSON(domain.NewError("internal_error", "Ошибка обновления статуса бана"))
 	}
+	metrics.IncrementUserBan(req.Banned)
 
 	// Если бан, отзываем все токены
 	if req.Banned {
-		h.refreshRepo.RevokeUserTokens(c.Context(), userID)
+		h.refreshRepo.RevokeUserTokens(c.UserContext(), userID)
 	}
 
 	message := "Пользователь заблокирован"
@@ -708,7 +818,7 @@ func (h *Handlers) GetUserDetails(c *fiber.Ctx) error {
 		return c.Status(400).JSON(domain.NewError("bad_request", "Неверный ID пользователя"))
 	}
 
-	user, err := h.userRepo.GetByID(c.Context(), userID)
+	user, err := h.userRepo.GetByID(c.UserContext(), userID)
 	if err != nil {
 		return c.Status(404).JSON(domain.NewError("not_found", "Пользователь не найден"))
 	}
@@ -716,7 +826,18 @@ func (h *Handlers) GetUserDetails(c *fiber.Ctx) error {
 	// Очистка хеша пароля
 	user.Hash = ""
 
-	return c.JSON(user)
+	delivery, err := h.deliveryRepo.GetDeliveryInfo(c.UserContext(), userID)
+	if err != nil {
+		return c.Status(500).JSON(domain.NewError("internal_error", "Ошибка получения статуса доставки писем"))
+	}
+
+	return c.JSON(adminUserDetails{User: user, EmailDelivery: delivery})
+}
+
+// adminUserDetails - пользователь со статусом доставки писем
+type adminUserDetails struct {
+	*domain.User
+	EmailDelivery *domain.EmailDeliveryInfo `json:"email_delivery"`
 }
 
 // parseUserID - вспомогательная функция для парсинга ID
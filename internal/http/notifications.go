@@ -0,0 +1,243 @@
+package http
+
+import (
+	"bytes"
+	"html/template"
+	"strings"
+
+	"github.com/RESERPIX/hubigr/internal/domain"
+	"github.com/RESERPIX/hubigr/internal/logger"
+	"github.com/RESERPIX/hubigr/internal/security"
+	"github.com/RESERPIX/hubigr/internal/validation"
+	"github.com/gofiber/fiber/v2"
+)
+
+// PublishNotification - прием события от других сервисов (игры, билды, посты)
+func (h *Handlers) PublishNotification(c *fiber.Ctx) error {
+	var req domain.PublishNotificationRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(domain.NewError("bad_request", "Неверный формат данных"))
+	}
+
+	if errors := validation.ValidatePublishNotification(req); len(errors) > 0 {
+		return c.Status(422).JSON(domain.NewError("validation_error", strings.Join(errors, "; ")))
+	}
+
+	// Настройки пользователей учитываются при вставке: неподписанным событие не сохраняется
+	stored, err := h.notificationRepo.Publish(c.UserContext(), req)
+	if err != nil {
+		logger.ErrorContext(c.UserContext(), "Failed to publish notification", "error", err, "type", req.Type)
+		return c.Status(500).JSON(domain.NewError("internal_error", "Ошибка сохранения уведомлений"))
+	}
+
+	// Доставка в открытые стримы на всех инстансах; при ошибке клиенты получат события из inbox
+	inbox := make([]domain.Notification, 0, len(stored))
+	for _, n := range stored {
+		if n.InApp {
+			inbox = append(inbox, n)
+		}
+	}
+	if err := h.hub.Publish(c.UserContext(), inbox); err != nil {
+		logger.ErrorContext(c.UserContext(), "Failed to fan out notifications", "error", err, "count", len(inbox))
+	}
+
+	return c.Status(202).JSON(fiber.Map{
+		"stored":  len(stored),
+		"dropped": len(req.UserIDs) - len(stored),
+	})
+}
+
+// GetInbox - входящие уведомления пользователя с количеством непрочитанных
+func (h *Handlers) GetInbox(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(int64)
+	if !ok {
+		return c.Status(500).JSON(domain.NewError("internal_error", "Ошибка получения ID пользователя"))
+	}
+
+	page := c.QueryInt("page", 1)
+	limit := c.QueryInt("limit", 20)
+
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	unreadOnly := c.QueryBool("unread", false)
+	offset := (page - 1) * limit
+
+	notifications, total, err := h.notificationRepo.List(c.UserContext(), userID, unreadOnly, limit, offset)
+	if err != nil {
+		return c.Status(500).JSON(domain.NewError("internal_error", "Ошибка получения уведомлений"))
+	}
+
+	unread, err := h.notificationRepo.CountUnread(c.UserContext(), userID)
+	if err != nil {
+		return c.Status(500).JSON(domain.NewError("internal_error", "Ошибка получения уведомлений"))
+	}
+
+	return c.JSON(fiber.Map{
+		"notifications": notifications,
+		"unread":        unread,
+		"total":         total,
+		"page":          page,
+		"limit":         limit,
+	})
+}
+
+// MarkInboxRead - отметка выбранных уведомлений прочитанными
+func (h *Handlers) MarkInboxRead(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(int64)
+	if !ok {
+		return c.Status(500).JSON(domain.NewError("internal_error", "Ошибка получения ID пользователя"))
+	}
+
+	var req domain.MarkReadRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(domain.NewError("bad_request", "Неверный формат данных"))
+	}
+	if len(req.IDs) == 0 || len(req.IDs) > 100 {
+		return c.Status(422).JSON(domain.NewError("validation_error", "Укажите от 1 до 100 уведомлений"))
+	}
+
+	updated, err := h.notificationRepo.MarkRead(c.UserContext(), userID, req.IDs)
+	if err != nil {
+		return c.Status(500).JSON(domain.NewError("internal_error", "Ошибка обновления уведомлений"))
+	}
+
+	return h.inboxReadResponse(c, userID, updated)
+}
+
+// MarkInboxAllRead - отметка всех уведомлений прочитанными
+func (h *Handlers) MarkInboxAllRead(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(int64)
+	if !ok {
+		return c.Status(500).JSON(domain.NewError("internal_error", "Ошибка получения ID пользователя"))
+	}
+
+	updated, err := h.notificationRepo.MarkAllRead(c.UserContext(), userID)
+	if err != nil {
+		return c.Status(500).JSON(domain.NewError("internal_error", "Ошибка обновления уведомлений"))
+	}
+
+	return h.inboxReadResponse(c, userID, updated)
+}
+
+// inboxReadResponse - ответ с актуальным счетчиком непрочитанных
+func (h *Handlers) inboxReadResponse(c *fiber.Ctx, userID, updated int64) error {
+	unread, err := h.notificationRepo.CountUnread(c.UserContext(), userID)
+	if err != nil {
+		return c.Status(500).JSON(domain.NewError("internal_error", "Ошибка получения уведомлений"))
+	}
+
+	return c.JSON(fiber.Map{
+		"updated": updated,
+		"unread":  unread,
+	})
+}
+
+// unsubscribeKinds - вопрос на странице подтверждения и ответ после отписки
+// для каждого вида ссылки из письма
+var unsubscribeKinds = map[string]struct{ question, done string }{
+	domain.UnsubscribeAll:               {"Отписаться от писем с уведомлениями?", "Вы отписались от писем с уведомлениями"},
+	string(domain.NotificationNewGame):  {"Отписаться от писем о новых играх?", "Вы отписались от писем о новых играх"},
+	string(domain.NotificationNewBuild): {"Отписаться от писем о новых билдах?", "Вы отписались от писем о новых билдах"},
+	string(domain.NotificationNewPost):  {"Отписаться от писем о новых постах?", "Вы отписались от писем о новых постах"},
+}
+
+// unsubscribePage - страница подтверждения отписки. Форма без action
+// отправляет POST на тот же адрес вместе с токеном в query.
+var unsubscribePage = template.Must(template.New("unsubscribe").Parse(`<!DOCTYPE html>
+<html lang="ru">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>Отписка от писем</title>
+</head>
+<body style="font-family: sans-serif; max-width: 480px; margin: 48px auto; padding: 0 16px;">
+<p>{{.Message}}</p>
+{{if .Confirm}}<form method="post"><button type="submit">Отписаться</button></form>{{end}}
+</body>
+</html>`))
+
+func renderUnsubscribePage(c *fiber.Ctx, status int, message string, confirm bool) error {
+	var buf bytes.Buffer
+	if err := unsubscribePage.Execute(&buf, fiber.Map{"Message": message, "Confirm": confirm}); err != nil {
+		return c.Status(500).JSON(domain.NewError("internal_error", "Ошибка отображения страницы"))
+	}
+	c.Set("Cache-Control", "no-store")
+	c.Set("X-Frame-Options", "DENY")
+	c.Type("html", "utf-8")
+	return c.Status(status).Send(buf.Bytes())
+}
+
+// UnsubscribePage - переход по ссылке отписки из письма. Только показывает
+// подтверждение: GET не меняет настройки, иначе ссылку "нажмут" сканеры почты.
+func (h *Handlers) UnsubscribePage(c *fiber.Ctx) error {
+	token := c.Query("token")
+	if token == "" {
+		return renderUnsubscribePage(c, 400, "Ссылка отписки недействительна", false)
+	}
+
+	_, kind, err := security.VerifyUnsubscribeToken(token, h.jwtSecret)
+	texts, known := unsubscribeKinds[kind]
+	if err != nil || !known {
+		return renderUnsubscribePage(c, 400, "Ссылка отписки недействительна", false)
+	}
+
+	return renderUnsubscribePage(c, 200, texts.question, true)
+}
+
+// Unsubscribe - отписка по подписанной ссылке из письма без входа в аккаунт:
+// кнопка на странице подтверждения или one-click отписка почтового клиента
+// (List-Unsubscribe-Post, RFC 8058). Токен в query или в поле формы token.
+// Отписка от типа события выключает только письма, во входящих события остаются.
+func (h *Handlers) Unsubscribe(c *fiber.Ctx) error {
+	// Браузеру после кнопки отвечаем страницей, почтовому клиенту и API - JSON
+	html := c.Accepts("application/json", "text/html") == "text/html"
+	fail := func(status int, code, message string) error {
+		if html {
+			return renderUnsubscribePage(c, status, message, false)
+		}
+		return c.Status(status).JSON(domain.NewError(code, message))
+	}
+
+	token := c.Query("token")
+	if token == "" {
+		token = c.FormValue("token")
+	}
+	if token == "" {
+		return fail(400, "bad_request", "Токен обязателен")
+	}
+
+	userID, kind, err := security.VerifyUnsubscribeToken(token, h.jwtSecret)
+	texts, known := unsubscribeKinds[kind]
+	if err != nil || !known {
+		return fail(400, "invalid_token", "Ссылка отписки недействительна")
+	}
+
+	settings, err := h.userRepo.GetNotificationSettings(c.UserContext(), userID)
+	if err != nil {
+		return fail(500, "internal_error", "Ошибка получения настроек")
+	}
+
+	if kind == domain.UnsubscribeAll {
+		disabled := false
+		settings.Channels.Email = &disabled
+	} else if t := domain.NotificationType(kind); !settings.Channels.EmailOptedOut(t) {
+		settings.Channels.EmailOptOut = append(settings.Channels.EmailOptOut, t)
+	}
+
+	if err := h.userRepo.UpdateNotificationSettings(c.UserContext(), userID, *settings); err != nil {
+		return fail(500, "internal_error", "Ошибка сохранения настроек")
+	}
+
+	logger.InfoContext(c.UserContext(), "User unsubscribed via email link", "user_id", userID, "kind", kind)
+
+	if html {
+		return renderUnsubscribePage(c, 200, texts.done, false)
+	}
+	return c.JSON(fiber.Map{"message": texts.done})
+}
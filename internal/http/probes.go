@@ -0,0 +1,57 @@
+package http
+
+import (
+	"github.com/RESERPIX/hubigr/internal/health"
+	"github.com/gofiber/fiber/v2"
+)
+
+// Livez - liveness probe: процесс жив и обслуживает запросы. Зависимости не
+// проверяются, иначе сбой БД привел бы к перезапуску всех инстансов.
+func (h *Handlers) Livez(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{"status": "ok"})
+}
+
+// Readyz - readiness probe: БД, Redis и миграции доступны, инстанс можно
+// включать в балансировку. Тексты ошибок только в /api/v1/health.
+func (h *Handlers) Readyz(c *fiber.Ctx) error {
+	report := h.readiness.Ready(c.UserContext())
+
+	checks := make(fiber.Map, len(report.Checks))
+	for _, r := range report.Checks {
+		checks[r.Name] = r.Status
+	}
+	status, code := "ok", fiber.StatusOK
+	if !report.Ready {
+		status, code = "unavailable", fiber.StatusServiceUnavailable
+	}
+	return c.Status(code).JSON(fiber.Map{"status": status, "checks": checks})
+}
+
+// Startupz - startup probe: успешна после первой успешной проверки готовности,
+// дальше работоспособность отслеживают Livez и Readyz
+func (h *Handlers) Startupz(c *fiber.Ctx) error {
+	if !h.readiness.Started(c.UserContext()) {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{"status": "starting"})
+	}
+	return c.JSON(fiber.Map{"status": "ok"})
+}
+
+// checkStatus - статус проверки name в отчете
+func checkStatus(report health.Report, name string) string {
+	for _, r := range report.Checks {
+		if r.Name == name {
+			return r.Status
+		}
+	}
+	return health.StatusDown
+}
+
+// hasFailedCheck - есть ли упавшие проверки, в том числе необязательные
+func hasFailedCheck(report health.Report) bool {
+	for _, r := range report.Checks {
+		if r.Status == health.StatusDown {
+			return true
+		}
+	}
+	return false
+}
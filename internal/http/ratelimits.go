@@ -0,0 +1,260 @@
+package http
+
+import (
+	"net/netip"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/RESERPIX/hubigr/internal/domain"
+	"github.com/RESERPIX/hubigr/internal/logger"
+	"github.com/RESERPIX/hubigr/internal/ratelimit"
+	"github.com/gofiber/fiber/v2"
+)
+
+// maxACLCommentLength - ограничение комментария записи списка IP
+const maxACLCommentLength = 200
+
+// GetRateLimitState - счетчики и TTL всех правил для IP, пользователя или email
+// (?key_by=ip|user|email&value=...)
+func (h *Handlers) GetRateLimitState(c *fiber.Ctx) error {
+	keyBy, value, ok := rateLimitTarget(c)
+	if !ok {
+		return c.Status(400).JSON(domain.NewError("bad_request", "Укажите key_by (ip, user, email) и корректное value"))
+	}
+
+	counters := []domain.RateLimitCounter{}
+	for _, name := range h.rateLimitPolicyNames(c.Query("policy")) {
+		for _, rule := range h.rateLimits[name].Rules {
+			key, ok := ruleKey(name, rule, keyBy, value)
+			if !ok {
+				continue
+			}
+			remaining, err := h.limiter.GetRemaining(c.UserContext(), key, rule)
+			if err != nil {
+				return c.Status(500).JSON(domain.NewError("internal_error", "Ошибка чтения счетчиков"))
+			}
+			ttl, err := h.limiter.GetTTL(c.UserContext(), key, rule.Algorithm)
+			if err != nil {
+				return c.Status(500).JSON(domain.NewError("internal_error", "Ошибка чтения счетчиков"))
+			}
+			counters = append(counters, domain.RateLimitCounter{
+				Policy:        name,
+				KeyBy:         string(rule.KeyBy),
+				Algorithm:     string(rule.Algorithm),
+				Limit:         rule.Limit,
+				WindowSeconds: ceilSeconds(rule.Window),
+				Remaining:     remaining,
+				TTLSeconds:    ceilSeconds(ttl),
+			})
+		}
+	}
+
+	resp := fiber.Map{
+		"key_by":   keyBy,
+		"value":    value,
+		"counters": counters,
+	}
+	if keyBy == ratelimit.KeyByIP {
+		resp["acl"] = h.acl.Match(value)
+	}
+	return c.JSON(resp)
+}
+
+// ResetRateLimit - сброс счетчиков IP, пользователя или email во всех маршрутах
+// или только в ?policy=
+func (h *Handlers) ResetRateLimit(c *fiber.Ctx) error {
+	keyBy, value, ok := rateLimitTarget(c)
+	if !ok {
+		return c.Status(400).JSON(domain.NewError("bad_request", "Укажите key_by (ip, user, email) и корректное value"))
+	}
+
+	adminID, ok := c.Locals("user_id").(int64)
+	if !ok {
+		return c.Status(500).JSON(domain.NewError("internal_error", "Ошибка получения ID админа"))
+	}
+
+	var deleted int64
+	policies := []string{}
+	for _, name := range h.rateLimitPolicyNames(c.Query("policy")) {
+		// Reset удаляет все алгоритмы ключа, правила маршрута с тем же ключом пропускаем
+		reset := map[string]bool{}
+		for _, rule := range h.rateLimits[name].Rules {
+			key, ok := ruleKey(name, rule, keyBy, value)
+			if !ok || reset[key] {
+				continue
+			}
+			n, err := h.limiter.Reset(c.UserContext(), key)
+			if err != nil {
+				return c.Status(500).JSON(domain.NewError("internal_error", "Ошибка сброса счетчиков"))
+			}
+			deleted += n
+			reset[key] = true
+		}
+		if len(reset) > 0 {
+			policies = append(policies, name)
+		}
+	}
+
+	logger.InfoContext(c.UserContext(), "Admin rate limit reset",
+		"admin_id", adminID,
+		"key_by", keyBy,
+		"policies", policies,
+		"deleted", deleted,
+	)
+
+	return c.JSON(fiber.Map{
+		"message":  "Счетчики сброшены",
+		"policies": policies,
+		"deleted":  deleted,
+	})
+}
+
+// GetRateLimitACL - списки разрешенных и запрещенных IP, включая истекшие записи
+func (h *Handlers) GetRateLimitACL(c *fiber.Ctx) error {
+	entries, err := h.aclRepo.List(c.UserContext())
+	if err != nil {
+		return c.Status(500).JSON(domain.NewError("internal_error", "Ошибка получения списков IP"))
+	}
+	return c.JSON(fiber.Map{"entries": entries})
+}
+
+// AddRateLimitACL - добавление IP или подсети в allow/deny список; повторное
+// добавление той же подсети заменяет действие и срок
+func (h *Handlers) AddRateLimitACL(c *fiber.Ctx) error {
+	var req domain.RateLimitACLRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(domain.NewError("bad_request", "Неверный формат данных"))
+	}
+
+	prefix, err := ratelimit.ParseCIDR(req.CIDR)
+	if err != nil {
+		return c.Status(422).JSON(domain.NewError("validation_error", "Неверный IP или подсеть"))
+	}
+	req.CIDR = prefix.String()
+	if req.Action != domain.RateLimitAllow && req.Action != domain.RateLimitDeny {
+		return c.Status(422).JSON(domain.NewError("validation_error", "action должен быть allow или deny"))
+	}
+	req.Comment = strings.TrimSpace(req.Comment)
+	if len([]rune(req.Comment)) > maxACLCommentLength {
+		return c.Status(422).JSON(domain.NewError("validation_error", "Комментарий слишком длинный"))
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return c.Status(422).JSON(domain.NewError("validation_error", "expires_at должен быть в будущем"))
+	}
+
+	adminID, ok := c.Locals("user_id").(int64)
+	if !ok {
+		return c.Status(500).JSON(domain.NewError("internal_error", "Ошибка получения ID админа"))
+	}
+
+	entry, err := h.aclRepo.Upsert(c.UserContext(), req, adminID)
+	if err != nil {
+		return c.Status(500).JSON(domain.NewError("internal_error", "Ошибка сохранения списка IP"))
+	}
+	h.reloadACL(c)
+
+	logger.InfoContext(c.UserContext(), "Admin rate limit ACL updated",
+		"admin_id", adminID,
+		"cidr", entry.CIDR,
+		"action", entry.Action,
+	)
+
+	return c.Status(201).JSON(entry)
+}
+
+// DeleteRateLimitACL - удаление записи из списков IP
+func (h *Handlers) DeleteRateLimitACL(c *fiber.Ctx) error {
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(domain.NewError("bad_request", "Неверный ID записи"))
+	}
+
+	adminID, ok := c.Locals("user_id").(int64)
+	if !ok {
+		return c.Status(500).JSON(domain.NewError("internal_error", "Ошибка получения ID админа"))
+	}
+
+	deleted, err := h.aclRepo.Delete(c.UserContext(), id)
+	if err != nil {
+		return c.Status(500).JSON(domain.NewError("internal_error", "Ошибка удаления записи"))
+	}
+	if !deleted {
+		return c.Status(404).JSON(domain.NewError("not_found", "Запись не найдена"))
+	}
+	h.reloadACL(c)
+
+	logger.InfoContext(c.UserContext(), "Admin rate limit ACL entry removed",
+		"admin_id", adminID,
+		"entry_id", id,
+	)
+
+	return c.JSON(fiber.Map{"message": "Запись удалена"})
+}
+
+// reloadACL применяет изменения списков на этом инстансе сразу; остальные
+// инстансы подхватят их при периодической перезагрузке
+func (h *Handlers) reloadACL(c *fiber.Ctx) {
+	if err := h.acl.Reload(c.UserContext()); err != nil {
+		logger.ErrorContext(c.UserContext(), "Failed to reload rate limit ACL", "error", err)
+	}
+}
+
+// rateLimitPolicyNames - имена маршрутов по порядку; с фильтром - только указанный
+func (h *Handlers) rateLimitPolicyNames(filter string) []string {
+	if filter != "" {
+		if _, ok := h.rateLimits[filter]; ok {
+			return []string{filter}
+		}
+		return nil
+	}
+	names := make([]string, 0, len(h.rateLimits))
+	for name := range h.rateLimits {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ruleKey - ключ счетчика правила для keyBy и value, false если правило так не
+// считает. Правила по пользователю, email и токену для запросов без этого значения
+// считаются по IP под значением "ip:<адрес>" (см. rateLimitKey), поэтому для
+// key_by=ip возвращаются и они.
+func ruleKey(policy string, rule ratelimit.Rule, keyBy ratelimit.KeyBy, value string) (string, bool) {
+	switch {
+	case rule.KeyBy == keyBy:
+		return ratelimit.Key(policy, keyBy, value), true
+	case keyBy == ratelimit.KeyByIP:
+		return ratelimit.Key(policy, rule.KeyBy, "ip:"+value), true
+	}
+	return "", false
+}
+
+// rateLimitTarget разбирает ?key_by=&value= и приводит значение к виду ключа в middleware
+func rateLimitTarget(c *fiber.Ctx) (ratelimit.KeyBy, string, bool) {
+	keyBy := ratelimit.KeyBy(c.Query("key_by"))
+	value := strings.TrimSpace(c.Query("value"))
+
+	switch keyBy {
+	case ratelimit.KeyByIP:
+		addr, err := netip.ParseAddr(value)
+		if err != nil {
+			return keyBy, "", false
+		}
+		return keyBy, addr.Unmap().String(), true
+	case ratelimit.KeyByUser:
+		userID, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || userID < 1 {
+			return keyBy, "", false
+		}
+		return keyBy, strconv.FormatInt(userID, 10), true
+	case ratelimit.KeyByEmail:
+		email := strings.ToLower(value)
+		if email == "" || len(email) > 254 {
+			return keyBy, "", false
+		}
+		return keyBy, email, true
+	}
+	return keyBy, "", false
+}
@@ -1,54 +1,88 @@
 package http
 
 import (
-	"time"
-
 	"github.com/RESERPIX/hubigr/internal/domain"
 	"github.com/RESERPIX/hubigr/internal/metrics"
+	"github.com/RESERPIX/hubigr/internal/storage"
+	"github.com/RESERPIX/hubigr/internal/tracing"
+	"github.com/RESERPIX/hubigr/internal/utils"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
-	"github.com/gofiber/fiber/v2/middleware/logger"
 )
 
-func SetupRoutes(app *fiber.App, handlers *Handlers, jwtSecret string, corsOrigins string) {
+func SetupRoutes(app *fiber.App, handlers *Handlers, files storage.Storage, trustedProxies *utils.TrustedProxies, jwtSecret string, corsOrigins string, internalToken string, emailWebhookSecret string) {
+	// Пробы Kubernetes/compose регистрируются до middleware: им не нужны лимиты,
+	// и они не должны попадать в журнал запросов и метрики
+	app.Get("/livez", handlers.Livez)
+	app.Get("/readyz", handlers.Readyz)
+	app.Get("/startupz", handlers.Startupz)
+
 	// Middleware
+	app.Use(ClientIPMiddleware(trustedProxies))
+	// Спан запроса (traceparent от KrakenD) до остальных middleware, чтобы в трейс
+	// попали и проверки лимитов в Redis
+	app.Use(tracing.Middleware())
+	app.Use(RequestIDMiddleware())
+	app.Use(AccessLogMiddleware())
 	app.Use(metrics.MetricsMiddleware())
-	app.Use(logger.New())
 	app.Use(cors.New(cors.Config{
 		AllowOrigins:     corsOrigins,
 		AllowMethods:     "GET,POST,PUT,DELETE,OPTIONS",
-		AllowHeaders:     "Origin,Authorization,Content-Type",
-		ExposeHeaders:    "Content-Length",
+		AllowHeaders:     "Origin,Authorization,Content-Type,Last-Event-ID,X-Request-ID",
+		ExposeHeaders:    "Content-Length,X-Request-ID,RateLimit-Limit,RateLimit-Remaining,RateLimit-Reset,RateLimit-Policy,Retry-After",
 		AllowCredentials: false,
 		MaxAge:           12 * 60 * 60, // 12 hours
 	}))
 
+	// Лимиты маршрутов из конфигурации (RATE_LIMITS) и списки IP из админки
+	limit := func(name string) fiber.Handler {
+		return RateLimitMiddleware(handlers.limiter, handlers.acl, handlers.rateLimits.Get(name))
+	}
+
 	// API группа
 	api := app.Group("/api/v1")
 
 	// Auth routes (API-4.1 - API-4.5 из ТЗ)
 	auth := api.Group("/auth")
-	auth.Post("/signup", LoginRateLimitMiddleware(handlers.limiter), handlers.SignUp)
+	auth.Post("/signup", limit("signup"), handlers.SignUp)
 	// Login outside group to bypass middleware
-	api.Post("/auth/login", LoginRateLimitMiddleware(handlers.limiter), handlers.Login)
+	api.Post("/auth/login", limit("login"), handlers.Login)
 	auth.Post("/logout", AuthMiddleware(jwtSecret), CSRFMiddleware(), handlers.Logout)
-	auth.Post("/refresh", LoginRateLimitMiddleware(handlers.limiter), handlers.RefreshToken)
+	auth.Post("/refresh", limit("refresh"), handlers.RefreshToken)
 	auth.Post("/verify-email", handlers.VerifyEmail)
-	auth.Post("/resend-verification", LoginRateLimitMiddleware(handlers.limiter), handlers.ResendVerification)
-	auth.Post("/reset-password", LoginRateLimitMiddleware(handlers.limiter), handlers.ResetPasswordRequest)
+	auth.Post("/resend-verification", limit("email_send"), handlers.ResendVerification)
+	auth.Post("/reset-password", limit("email_send"), handlers.ResetPasswordRequest)
 	auth.Post("/reset-password/confirm", handlers.ResetPasswordConfirm)
 
 	// Profile routes (API-4.6 - API-4.8 из ТЗ)
-	profile := api.Group("/profile", AuthMiddleware(jwtSecret), LoggingMiddleware(), RateLimitMiddleware(handlers.limiter, "profile", 30, time.Minute), CSRFMiddleware())
+	profile := api.Group("/profile", AuthMiddleware(jwtSecret), limit("profile"), CSRFMiddleware())
 	profile.Get("/", handlers.GetProfile)
 	profile.Put("/", handlers.UpdateProfile)
+	profile.Put("/handle", handlers.UpdateHandle)
 	profile.Get("/notifications", handlers.GetNotifications)
 	profile.Put("/notifications", handlers.UpdateNotifications)
 	profile.Get("/submissions", handlers.GetMySubmissions)
 	profile.Post("/avatar", handlers.UploadAvatar)
+	profile.Get("/inbox", handlers.GetInbox)
+	profile.Post("/inbox/read", handlers.MarkInboxRead)
+	profile.Post("/inbox/read-all", handlers.MarkInboxAllRead)
+	
+	// SSE стрим уведомлений (токен можно передать в ?access_token для EventSource)
+	api.Get("/notifications/stream", QueryTokenMiddleware(), AuthMiddleware(jwtSecret), handlers.StreamNotifications)
+
+	// Отписка от email-уведомлений по подписанной ссылке (без авторизации)
+	unsubscribeLimit := limit("unsubscribe")
+	api.Get("/notifications/unsubscribe", unsubscribeLimit, handlers.UnsubscribePage)
+	api.Post("/notifications/unsubscribe", unsubscribeLimit, handlers.Unsubscribe)
+
+	// Уведомления почтового провайдера о bounce/complaint
+	api.Post("/webhooks/email", WebhookAuthMiddleware(emailWebhookSecret), handlers.EmailDeliveryWebhook)
+
+	// Публичные профили по хэндлу
+	api.Get("/users/:handle", limit("public"), handlers.GetPublicProfile)
 	
 	// Безопасная раздача статических файлов (аватары)
-	app.Get("/uploads/*", SecureStaticHandler)
+	app.Get("/uploads/*", SecureStaticHandler(files))
 
 	// Admin routes (US-1.1.5 из ТЗ)
 	admin := api.Group("/admin", AuthMiddleware(jwtSecret), RoleMiddleware(domain.RoleAdmin, domain.RoleModerator))
@@ -56,9 +90,30 @@ func SetupRoutes(app *fiber.App, handlers *Handlers, jwtSecret string, corsOrigi
 	admin.Get("/users/:id", handlers.GetUserDetails)
 	admin.Put("/users/:id/role", CSRFMiddleware(), handlers.UpdateUserRole)
 	admin.Put("/users/:id/ban", CSRFMiddleware(), handlers.BanUser)
+	admin.Delete("/users/:id/email-suppression", RoleMiddleware(domain.RoleAdmin), CSRFMiddleware(), handlers.RemoveEmailSuppression)
+
+	// Очередь исходящих писем (адреса и ошибки доставки - только для админов)
+	emails := admin.Group("/emails", RoleMiddleware(domain.RoleAdmin))
+	emails.Get("/", handlers.GetOutboxEmails)
+	emails.Get("/templates", handlers.GetEmailTemplates)
+	emails.Get("/templates/:name", handlers.PreviewEmailTemplate)
+	emails.Get("/:id", handlers.GetOutboxEmail)
+	emails.Post("/:id/retry", CSRFMiddleware(), handlers.RetryOutboxEmail)
+
+	// Состояние rate limiting и списки IP
+	rateLimit := admin.Group("/rate-limits", RoleMiddleware(domain.RoleAdmin))
+	rateLimit.Get("/", handlers.GetRateLimitState)
+	rateLimit.Delete("/", CSRFMiddleware(), handlers.ResetRateLimit)
+	rateLimit.Get("/acl", handlers.GetRateLimitACL)
+	rateLimit.Post("/acl", CSRFMiddleware(), handlers.AddRateLimitACL)
+	rateLimit.Delete("/acl/:id", CSRFMiddleware(), handlers.DeleteRateLimitACL)
 
-	// Health check
-	api.Get("/health", handlers.Health)
+	// Внутреннее API для других сервисов (не публикуется через KrakenD)
+	internal := app.Group("/internal/v1", InternalAuthMiddleware(internalToken), limit("internal"))
+	internal.Post("/notifications", handlers.PublishNotification)
+
+	// Подробное состояние сервиса - только для админов
+	api.Get("/health", AuthMiddleware(jwtSecret), RoleMiddleware(domain.RoleAdmin), handlers.Health)
 
 	// CSRF token endpoint
 	api.Get("/csrf-token", func(c *fiber.Ctx) error {
@@ -68,8 +123,4 @@ func SetupRoutes(app *fiber.App, handlers *Handlers, jwtSecret string, corsOrigi
 
 	// Test endpoint without any middleware - COMMENTED OUT FOR PRODUCTION SECURITY
 	// api.Post("/test-login", handlers.Login)
-
-	// Metrics endpoints
-	api.Get("/metrics", handlers.Metrics)
-	api.Get("/metrics/prometheus", handlers.PrometheusMetrics)
 }
\ No newline at end of file
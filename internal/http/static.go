@@ -1,47 +1,36 @@
 package http
 
 import (
-	"os"
-	"path/filepath"
+	stderrors "errors"
+	"path"
 	"strings"
-	"sync"
 
 	"github.com/RESERPIX/hubigr/internal/domain"
+	"github.com/RESERPIX/hubigr/internal/storage"
+	"github.com/RESERPIX/hubigr/internal/upload"
 	"github.com/gofiber/fiber/v2"
 )
 
-const (
-	UploadsDir = "./uploads"
-	MaxFileSize = 10 << 20 // 10 MB
-)
-
-// Превычисленный абсолютный путь для эффективности
-var (
-	absUploadsDir string
-	uploadsDirOnce sync.Once
-)
+const MaxFileSize = 10 << 20 // 10 MB
 
-func getAbsUploadsDir() string {
-	uploadsDirOnce.Do(func() {
-		var err error
-		absUploadsDir, err = filepath.Abs(UploadsDir)
-		if err != nil {
-			panic("Failed to resolve uploads directory: " + err.Error())
-		}
-	})
-	return absUploadsDir
+// SecureStaticHandler безопасно обслуживает загруженные файлы (аватары) из
+// хранилища. Если хранилище выдает прямые ссылки (S3), клиент получает
+// редирект на временную подписанную ссылку, иначе файл отдается сервисом.
+func SecureStaticHandler(files storage.Storage) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return serveStatic(c, files)
+	}
 }
 
-// SecureStaticHandler безопасно обслуживает статические файлы
-func SecureStaticHandler(c *fiber.Ctx) error {
+func serveStatic(c *fiber.Ctx, files storage.Storage) error {
 	requestedPath := c.Params("*")
 	if requestedPath == "" {
 		return c.Status(404).JSON(domain.NewError("not_found", "File not found"))
 	}
 
 	// Безопасное извлечение имени файла - используем только базовое имя
-	safeFilename := filepath.Base(requestedPath)
-	
+	safeFilename := path.Base(requestedPath)
+
 	// Строгая валидация имени файла
 	for _, r := range safeFilename {
 		if !((r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '_' || r == '.' || r == '-') {
@@ -49,39 +38,45 @@ func SecureStaticHandler(c *fiber.Ctx) error {
 		}
 	}
 
-	// Создаем полный путь только из безопасных компонентов
-	absUploadsDir := getAbsUploadsDir()
-	fullPath := filepath.Join(absUploadsDir, "avatars", safeFilename)
-	absFullPath, err := filepath.Abs(fullPath)
-	if err != nil {
-		return c.Status(500).JSON(domain.NewError("internal_error", "Server error"))
-	}
-	
-	// Критическая проверка - файл должен быть строго внутри uploads
-	expectedPrefix := absUploadsDir + string(filepath.Separator)
-	if !strings.HasPrefix(absFullPath, expectedPrefix) || 
-	   strings.Contains(absFullPath[len(expectedPrefix):], "..") {
+	// Ключ строится только из безопасных компонентов; выход из каталога
+	// дополнительно отсекает хранилище
+	key := upload.AvatarPrefix + safeFilename
+	if !storage.ValidKey(key) {
 		return c.Status(403).JSON(domain.NewError("forbidden", "Path traversal detected"))
 	}
 
-	fileInfo, err := os.Stat(absFullPath)
-	if os.IsNotExist(err) {
+	presigned, err := files.PresignGet(c.UserContext(), key)
+	if err == nil {
+		// Подписанная ссылка живет ограниченное время, поэтому редирект кешируется ненадолго
+		c.Set("Cache-Control", "private, max-age=60")
+		return c.Redirect(presigned, fiber.StatusFound)
+	}
+	if !stderrors.Is(err, storage.ErrPresignNotSupported) {
+		return c.Status(500).JSON(domain.NewError("internal_error", "File access error"))
+	}
+
+	body, object, err := files.Open(c.UserContext(), key)
+	if stderrors.Is(err, storage.ErrNotFound) {
 		return c.Status(404).JSON(domain.NewError("not_found", "File not found"))
 	}
 	if err != nil {
 		return c.Status(500).JSON(domain.NewError("internal_error", "File access error"))
 	}
-	
-	if fileInfo.Size() > MaxFileSize {
+
+	if object.Size > MaxFileSize {
+		body.Close()
 		return c.Status(413).JSON(domain.NewError("file_too_large", "File too large"))
 	}
 
 	// Установка безопасных заголовков
 	c.Set("X-Content-Type-Options", "nosniff")
 	c.Set("X-Frame-Options", "DENY")
-	
+
+	// Имена аватаров зависят от содержимого, файл под именем не меняется
+	c.Set("Cache-Control", "public, max-age=31536000, immutable")
+
 	// Определение Content-Type по расширению
-	ext := strings.ToLower(filepath.Ext(fullPath))
+	ext := strings.ToLower(path.Ext(safeFilename))
 	switch ext {
 	case ".jpg", ".jpeg":
 		c.Set("Content-Type", "image/jpeg")
@@ -89,12 +84,14 @@ func SecureStaticHandler(c *fiber.Ctx) error {
 		c.Set("Content-Type", "image/png")
 	case ".gif":
 		c.Set("Content-Type", "image/gif")
+	case ".webp":
+		c.Set("Content-Type", "image/webp")
 	default:
 		// Для неизвестных типов принудительно скачивание
 		c.Set("Content-Type", "application/octet-stream")
 		c.Set("Content-Disposition", "attachment")
 	}
 
-	// Отправка файла
-	return c.SendFile(absFullPath)
-}
\ No newline at end of file
+	// Отправка файла; поток закрывается после ответа
+	return c.SendStream(body, int(object.Size))
+}
@@ -0,0 +1,164 @@
+package http
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/RESERPIX/hubigr/internal/domain"
+	"github.com/RESERPIX/hubigr/internal/logger"
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	// streamHeartbeat - интервал комментариев-пингов, чтобы прокси не закрывали соединение;
+	// по ошибке записи пинга замечаем отключившегося клиента
+	streamHeartbeat = 15 * time.Second
+	// streamReplayPage - сколько пропущенных уведомлений читаем из БД за раз при переподключении
+	streamReplayPage = 100
+	// streamReplayMax - сколько пропущенных уведомлений отдаем в стрим; при большем
+	// отставании клиент получает resync и перечитывает входящие
+	streamReplayMax = 1000
+)
+
+// StreamNotifications - SSE стрим новых уведомлений с догрузкой по Last-Event-ID
+func (h *Handlers) StreamNotifications(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(int64)
+	if !ok {
+		return c.Status(500).JSON(domain.NewError("internal_error", "Ошибка получения ID пользователя"))
+	}
+
+	// EventSource передает Last-Event-ID заголовком при переподключении
+	lastEventID := c.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = c.Query("last_event_id")
+	}
+	var lastID int64
+	if lastEventID != "" {
+		id, err := strconv.ParseInt(lastEventID, 10, 64)
+		if err != nil || id < 0 {
+			return c.Status(400).JSON(domain.NewError("bad_request", "Неверный Last-Event-ID"))
+		}
+		lastID = id
+	}
+
+	// Подписываемся до догрузки из БД, чтобы не потерять события между ними
+	sub := h.hub.Subscribe(userID)
+
+	c.Set("Content-Type", "text/event-stream")
+	c.Set("Cache-Control", "no-cache")
+	c.Set("Connection", "keep-alive")
+	c.Set("X-Accel-Buffering", "no")
+
+	notificationRepo := h.notificationRepo
+	hub := h.hub
+
+	// fiber.Ctx нельзя использовать после возврата из handler - работаем только с захваченными значениями
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer hub.Unsubscribe(sub)
+
+		fmt.Fprintf(w, "retry: 3000\n\n")
+
+		if lastEventID != "" {
+			// Догружаем страницами, пока не дойдем до конца или до streamReplayMax
+			for replayed := 0; ; {
+				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				missed, err := notificationRepo.ListAfter(ctx, userID, lastID, streamReplayPage)
+				cancel()
+				if err != nil {
+					logger.Error("Failed to replay notifications", "error", err, "user_id", userID)
+					return
+				}
+				for _, n := range missed {
+					if err := writeNotificationEvent(w, n); err != nil {
+						return
+					}
+					lastID = n.ID
+				}
+				replayed += len(missed)
+				if len(missed) < streamReplayPage {
+					break
+				}
+				if err := w.Flush(); err != nil {
+					return
+				}
+				if replayed >= streamReplayMax {
+					// Отставание слишком большое: пропускаем его целиком, клиент
+					// перечитывает входящие через API. ID события сдвигает
+					// Last-Event-ID, чтобы следующее переподключение не догружало то же.
+					ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+					latestID, err := notificationRepo.LatestID(ctx, userID)
+					cancel()
+					if err != nil {
+						logger.Error("Failed to replay notifications", "error", err, "user_id", userID)
+						return
+					}
+					if latestID > lastID {
+						lastID = latestID
+					}
+					fmt.Fprintf(w, "id: %d\nevent: resync\ndata: {}\n\n", lastID)
+					break
+				}
+			}
+		} else {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			unread, err := notificationRepo.CountUnread(ctx, userID)
+			cancel()
+			if err == nil {
+				fmt.Fprintf(w, "event: unread\ndata: {\"unread\":%d}\n\n", unread)
+			}
+		}
+		if err := w.Flush(); err != nil {
+			return
+		}
+
+		heartbeat := time.NewTicker(streamHeartbeat)
+		defer heartbeat.Stop()
+
+		for {
+			select {
+			case n := <-sub.C():
+				// Уже отданное при догрузке пропускаем
+				if n.ID <= lastID {
+					continue
+				}
+				if err := writeNotificationEvent(w, n); err != nil {
+					return
+				}
+				if err := w.Flush(); err != nil {
+					return
+				}
+				lastID = n.ID
+			case <-heartbeat.C:
+				// Ошибка записи означает, что клиент отключился
+				fmt.Fprintf(w, ": ping\n\n")
+				if err := w.Flush(); err != nil {
+					return
+				}
+			case <-sub.Done():
+				// Вытесненному стриму сообщаем, чтобы клиент не переподключался
+				// и не вытеснял в ответ другие вкладки
+				if sub.Evicted() {
+					fmt.Fprintf(w, "event: evicted\ndata: {}\n\n")
+					_ = w.Flush()
+				}
+				return
+			}
+		}
+	})
+
+	return nil
+}
+
+// writeNotificationEvent пишет уведомление в формате SSE, ID события = ID уведомления
+func writeNotificationEvent(w *bufio.Writer, n domain.Notification) error {
+	data, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: notification\ndata: %s\n\n", n.ID, data)
+	return err
+}
@@ -1,9 +1,12 @@
 package logger
 
 import (
+	"context"
 	"log/slog"
 	"os"
 	"sync"
+
+	"go.opentelemetry.io/otel/trace"
 )
 
 var (
@@ -27,9 +30,9 @@ func Init(level string) {
 			logLevel = slog.LevelInfo
 		}
 
-		Logger = slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
+		Logger = slog.New(traceHandler{slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
 			Level: logLevel,
-		}))
+		})})
 	})
 }
 
@@ -55,4 +58,69 @@ func Warn(msg string, args ...any) {
 	if Logger != nil {
 		Logger.Warn(msg, args...)
 	}
-}
\ No newline at end of file
+}
+
+// loggerKey - ключ контекста с логгером запроса
+type loggerKey struct{}
+
+// WithContext кладет в ctx логгер запроса (с request_id и т.п.)
+func WithContext(ctx context.Context, l *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, l)
+}
+
+// FromContext - логгер запроса из ctx, без него - общий Logger
+func FromContext(ctx context.Context) *slog.Logger {
+	if l, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return l
+	}
+	return Logger
+}
+
+// InfoContext, ErrorContext, WarnContext и DebugContext пишут через логгер запроса
+// из ctx и добавляют trace_id и span_id текущего спана
+func InfoContext(ctx context.Context, msg string, args ...any) {
+	if l := FromContext(ctx); l != nil {
+		l.InfoContext(ctx, msg, args...)
+	}
+}
+
+func ErrorContext(ctx context.Context, msg string, args ...any) {
+	if l := FromContext(ctx); l != nil {
+		l.ErrorContext(ctx, msg, args...)
+	}
+}
+
+func WarnContext(ctx context.Context, msg string, args ...any) {
+	if l := FromContext(ctx); l != nil {
+		l.WarnContext(ctx, msg, args...)
+	}
+}
+
+func DebugContext(ctx context.Context, msg string, args ...any) {
+	if l := FromContext(ctx); l != nil {
+		l.DebugContext(ctx, msg, args...)
+	}
+}
+
+// traceHandler дописывает идентификаторы трейса, чтобы по записи лога найти трейс
+type traceHandler struct {
+	slog.Handler
+}
+
+func (h traceHandler) Handle(ctx context.Context, r slog.Record) error {
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		r.AddAttrs(
+			slog.String("trace_id", sc.TraceID().String()),
+			slog.String("span_id", sc.SpanID().String()),
+		)
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h traceHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return traceHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h traceHandler) WithGroup(name string) slog.Handler {
+	return traceHandler{h.Handler.WithGroup(name)}
+}
@@ -1,128 +1,339 @@
 package metrics
 
 import (
-	"sync"
+	"strings"
 	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	dto "github.com/prometheus/client_model/go"
 )
 
-// Metrics - структура для хранения метрик
-type Metrics struct {
-	mu sync.RWMutex
-	
-	// HTTP метрики
-	RequestsTotal     map[string]int64 // по методам
-	RequestDuration   map[string]time.Duration // средняя длительность
-	ResponseStatus    map[int]int64 // по статус кодам
-	
-	// Бизнес метрики
-	UsersRegistered   int64
-	EmailsSent        int64
-	LoginAttempts     int64
-	FailedLogins      int64
-	
-	// Системные метрики
-	StartTime         time.Time
-	LastRequestTime   time.Time
-}
+// Registry - реестр метрик сервиса (свой, а не глобальный, чтобы в выдаче были
+// только наши метрики и метрики рантайма)
+var Registry = prometheus.NewRegistry()
+
+var startTime = time.Now()
 
+// HTTP метрики. route - шаблон маршрута (/api/v1/users/:handle), а не сам путь,
+// чтобы число рядов не зависело от параметров запроса.
 var (
-	globalMetrics *Metrics
-	metricsOnce   sync.Once
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "Total number of HTTP requests by route, method and status class",
+	}, []string{"method", "route", "status"})
+
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "HTTP request duration in seconds",
+		Buckets: []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10},
+	}, []string{"method", "route", "status"})
+
+	httpInFlight = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "http_requests_in_flight",
+		Help: "Number of HTTP requests being served",
+	})
 )
 
-// GetMetrics возвращает текущие метрики
-func GetMetrics() *Metrics {
-	metricsOnce.Do(func() {
-		globalMetrics = &Metrics{
-			RequestsTotal:   make(map[string]int64),
-			RequestDuration: make(map[string]time.Duration),
-			ResponseStatus:  make(map[int]int64),
-			StartTime:       time.Now(),
-		}
+// Бизнес метрики
+var (
+	usersRegistered = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "users_registered_total",
+		Help: "Total number of registered users",
 	})
-	return globalMetrics
-}
-
-// IncrementRequests увеличивает счетчик запросов
-func IncrementRequests(method string) {
-	m := GetMetrics()
-	m.mu.Lock()
-	defer m.mu.Unlock()
-	m.RequestsTotal[method]++
-	m.LastRequestTime = time.Now()
-}
-
-// RecordDuration записывает длительность запроса
-func RecordDuration(method string, duration time.Duration) {
-	m := GetMetrics()
-	m.mu.Lock()
-	defer m.mu.Unlock()
-	// Экспоненциальное скользящее среднее (EMA)
-	if current, exists := m.RequestDuration[method]; exists {
-		// EMA: new_avg = alpha * new_value + (1 - alpha) * old_avg
-		m.RequestDuration[method] = time.Duration(0.1*float64(duration) + 0.9*float64(current))
-	} else {
-		m.RequestDuration[method] = duration
-	}
+
+	emailsSent = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "emails_sent_total",
+		Help: "Total number of emails sent",
+	})
+
+	loginAttempts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "login_attempts_total",
+		Help: "Total number of login attempts by result",
+	}, []string{"result"})
+
+	tokenRefreshes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "token_refreshes_total",
+		Help: "Total number of refresh token exchanges by result",
+	}, []string{"result"})
+
+	emailVerifications = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "email_verifications_total",
+		Help: "Total number of email verification attempts by result",
+	}, []string{"result"})
+
+	passwordResets = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "password_resets_total",
+		Help: "Total number of password reset requests and confirmations",
+	}, []string{"stage", "result"})
+
+	userBans = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "user_bans_total",
+		Help: "Total number of user bans and unbans by admins",
+	}, []string{"action"})
+)
+
+// Rate limiter
+var (
+	rateLimitFallbacks = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "rate_limit_fallback_total",
+		Help: "Rate limit checks handled without Redis by route and failure mode",
+	}, []string{"policy", "mode"})
+
+	rateLimitBreakerTrips = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "rate_limit_breaker_trips_total",
+		Help: "Number of times the Redis circuit breaker opened",
+	})
+
+	rateLimitBreakerOpen = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "rate_limit_breaker_open",
+		Help: "Whether the Redis circuit breaker is open",
+	})
+)
+
+// Фоновые задачи планировщика (очистка истекших данных и т.п.)
+var (
+	jobRuns = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "scheduler_job_runs_total",
+		Help: "Total number of scheduled job runs by job and result",
+	}, []string{"job", "result"})
+
+	jobDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "scheduler_job_duration_seconds",
+		Help:    "Scheduled job duration in seconds",
+		Buckets: []float64{0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30, 60, 300},
+	}, []string{"job"})
+
+	jobRemoved = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "scheduler_job_removed_total",
+		Help: "Total number of rows and files removed by scheduled jobs",
+	}, []string{"job", "target"})
+
+	schedulerLeader = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "scheduler_leader",
+		Help: "Whether this instance holds the scheduler leader lock",
+	})
+)
+
+// Значения меток result
+const (
+	ResultSuccess = "success"
+	ResultFailure = "failure"
+)
+
+func init() {
+	Registry.MustRegister(
+		// Рантайм Go: кроме памяти и горутин по умолчанию - паузы GC и задержки планировщика
+		collectors.NewGoCollector(collectors.WithGoCollectorRuntimeMetrics(collectors.MetricsGC, collectors.MetricsScheduler)),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		collectors.NewBuildInfoCollector(),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "uptime_seconds",
+			Help: "Service uptime in seconds",
+		}, func() float64 { return time.Since(startTime).Seconds() }),
+		httpRequests, httpDuration, httpInFlight,
+		usersRegistered, emailsSent, loginAttempts, tokenRefreshes, emailVerifications, passwordResets, userBans,
+		rateLimitFallbacks, rateLimitBreakerTrips, rateLimitBreakerOpen,
+		jobRuns, jobDuration, jobRemoved, schedulerLeader,
+	)
 }
 
-// IncrementStatus увеличивает счетчик статус кодов
-func IncrementStatus(status int) {
-	m := GetMetrics()
-	m.mu.Lock()
-	defer m.mu.Unlock()
-	m.ResponseStatus[status]++
+// Register добавляет сборщик метрик другого пакета (пулы соединений и т.п.)
+func Register(c prometheus.Collector) error {
+	return Registry.Register(c)
 }
 
 // IncrementUserRegistered увеличивает счетчик регистраций
 func IncrementUserRegistered() {
-	m := GetMetrics()
-	m.mu.Lock()
-	defer m.mu.Unlock()
-	m.UsersRegistered++
+	usersRegistered.Inc()
 }
 
 // IncrementEmailSent увеличивает счетчик отправленных email
 func IncrementEmailSent() {
-	m := GetMetrics()
-	m.mu.Lock()
-	defer m.mu.Unlock()
-	m.EmailsSent++
+	emailsSent.Inc()
 }
 
 // IncrementLoginAttempt увеличивает счетчик попыток входа
 func IncrementLoginAttempt(success bool) {
-	m := GetMetrics()
-	m.mu.Lock()
-	defer m.mu.Unlock()
-	m.LoginAttempts++
-	if !success {
-		m.FailedLogins++
+	loginAttempts.WithLabelValues(result(success)).Inc()
+}
+
+// IncrementTokenRefresh учитывает обмен refresh токена
+func IncrementTokenRefresh(success bool) {
+	tokenRefreshes.WithLabelValues(result(success)).Inc()
+}
+
+// IncrementEmailVerification учитывает подтверждение email
+func IncrementEmailVerification(success bool) {
+	emailVerifications.WithLabelValues(result(success)).Inc()
+}
+
+// IncrementPasswordResetRequested учитывает запрос сброса пароля
+func IncrementPasswordResetRequested() {
+	passwordResets.WithLabelValues("requested", ResultSuccess).Inc()
+}
+
+// IncrementPasswordResetConfirmed учитывает установку нового пароля по токену
+func IncrementPasswordResetConfirmed(success bool) {
+	passwordResets.WithLabelValues("confirmed", result(success)).Inc()
+}
+
+// IncrementUserBan учитывает блокировку или разблокировку пользователя
+func IncrementUserBan(banned bool) {
+	action := "unban"
+	if banned {
+		action = "ban"
+	}
+	userBans.WithLabelValues(action).Inc()
+}
+
+// IncrementRateLimitFallback учитывает проверку лимита без Redis
+func IncrementRateLimitFallback(policy, mode string) {
+	rateLimitFallbacks.WithLabelValues(policy, mode).Inc()
+}
+
+// IncrementRateLimitBreakerTrips учитывает размыкание circuit breaker
+func IncrementRateLimitBreakerTrips() {
+	rateLimitBreakerTrips.Inc()
+}
+
+// SetRateLimitBreakerOpen - текущее состояние circuit breaker
+func SetRateLimitBreakerOpen(open bool) {
+	if open {
+		rateLimitBreakerOpen.Set(1)
+	} else {
+		rateLimitBreakerOpen.Set(0)
+	}
+}
+
+// ObserveJobRun учитывает выполнение задачи планировщика
+func ObserveJobRun(job string, duration time.Duration, success bool) {
+	jobRuns.WithLabelValues(job, result(success)).Inc()
+	jobDuration.WithLabelValues(job).Observe(duration.Seconds())
+}
+
+// AddJobRemoved учитывает удаленные задачей строки или файлы
+func AddJobRemoved(job, target string, count int64) {
+	jobRemoved.WithLabelValues(job, target).Add(float64(count))
+}
+
+// SetSchedulerLeader - выполняет ли этот инстанс задачи планировщика
+func SetSchedulerLeader(leader bool) {
+	if leader {
+		schedulerLeader.Set(1)
+	} else {
+		schedulerLeader.Set(0)
+	}
+}
+
+func result(success bool) string {
+	if success {
+		return ResultSuccess
+	}
+	return ResultFailure
+}
+
+// FailedLogins - число неудачных попыток входа с момента запуска
+func FailedLogins() float64 {
+	var m dto.Metric
+	if err := loginAttempts.WithLabelValues(ResultFailure).Write(&m); err != nil {
+		return 0
 	}
+	return m.GetCounter().GetValue()
 }
 
-// GetSnapshot возвращает снимок метрик для безопасного чтения
-func (m *Metrics) GetSnapshot() map[string]interface{} {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
-	
-	uptime := time.Since(m.StartTime)
-	
-	return map[string]interface{}{
-		"uptime_seconds": uptime.Seconds(),
-		"requests_total": m.RequestsTotal,
-		"request_duration_ms": func() map[string]float64 {
-			durations := make(map[string]float64)
-			for k, v := range m.RequestDuration {
-				durations[k] = float64(v.Nanoseconds()) / 1e6
+// HTTPRequestCounts - число HTTP запросов с момента запуска: всего и с ответом 5xx
+func HTTPRequestCounts() (total, serverErrors float64) {
+	families, err := Registry.Gather()
+	if err != nil {
+		return 0, 0
+	}
+	for _, family := range families {
+		if family.GetName() != "http_requests_total" {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			value := m.GetCounter().GetValue()
+			total += value
+			for _, l := range m.GetLabel() {
+				if l.GetName() == "status" && l.GetValue() == "5xx" {
+					serverErrors += value
+				}
 			}
-			return durations
-		}(),
-		"response_status": m.ResponseStatus,
-		"users_registered": m.UsersRegistered,
-		"emails_sent": m.EmailsSent,
-		"login_attempts": m.LoginAttempts,
-		"failed_logins": m.FailedLogins,
-		"last_request": m.LastRequestTime.Unix(),
+		}
 	}
-}
\ No newline at end of file
+	return total, serverErrors
+}
+
+// RateLimitBreakerIsOpen - разомкнут ли circuit breaker Redis
+func RateLimitBreakerIsOpen() bool {
+	var m dto.Metric
+	if err := rateLimitBreakerOpen.Write(&m); err != nil {
+		return false
+	}
+	return m.GetGauge().GetValue() > 0
+}
+
+// Uptime - время работы сервиса
+func Uptime() time.Duration {
+	return time.Since(startTime)
+}
+
+// GetSnapshot возвращает метрики сервиса (без рантайма Go) в виде JSON-совместимой
+// карты: метрика без меток - число, с метками - карта "метка=значение,..." -> число.
+// Гистограммы представлены количеством и суммой.
+func GetSnapshot() map[string]interface{} {
+	snapshot := map[string]interface{}{}
+	families, err := Registry.Gather()
+	if err != nil {
+		return snapshot
+	}
+
+	for _, family := range families {
+		name := family.GetName()
+		if isRuntimeMetric(name) {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			value := metricValue(family.GetType(), m)
+			if len(m.GetLabel()) == 0 {
+				snapshot[name] = value
+				continue
+			}
+			labeled, ok := snapshot[name].(map[string]interface{})
+			if !ok {
+				labeled = map[string]interface{}{}
+				snapshot[name] = labeled
+			}
+			labeled[labelString(m.GetLabel())] = value
+		}
+	}
+	return snapshot
+}
+
+func isRuntimeMetric(name string) bool {
+	return strings.HasPrefix(name, "go_") || strings.HasPrefix(name, "process_")
+}
+
+func metricValue(t dto.MetricType, m *dto.Metric) interface{} {
+	switch t {
+	case dto.MetricType_COUNTER:
+		return m.GetCounter().GetValue()
+	case dto.MetricType_GAUGE:
+		return m.GetGauge().GetValue()
+	case dto.MetricType_HISTOGRAM:
+		return map[string]interface{}{
+			"count": m.GetHistogram().GetSampleCount(),
+			"sum":   m.GetHistogram().GetSampleSum(),
+		}
+	}
+	return m.GetUntyped().GetValue()
+}
+
+func labelString(labels []*dto.LabelPair) string {
+	parts := make([]string, 0, len(labels))
+	for _, l := range labels {
+		parts = append(parts, l.GetName()+"="+l.GetValue())
+	}
+	return strings.Join(parts, ",")
+}
@@ -1,30 +1,61 @@
 package metrics
 
 import (
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 )
 
+// unmatchedRoute - метка запросов, для которых не нашлось маршрута (404 сканеров и т.п.)
+const unmatchedRoute = "unmatched"
+
 // MetricsMiddleware собирает метрики HTTP запросов
 func MetricsMiddleware() fiber.Handler {
+	var (
+		routesOnce sync.Once
+		routes     map[string]bool
+	)
+
 	return func(c *fiber.Ctx) error {
 		start := time.Now()
-		method := c.Method()
-		
-		// Увеличиваем счетчик запросов
-		IncrementRequests(method)
-		
+		httpInFlight.Inc()
+		defer httpInFlight.Dec()
+
 		// Выполняем запрос
 		err := c.Next()
-		
-		// Записываем метрики после выполнения
-		duration := time.Since(start)
+
+		// Маршруты известны только после SetupRoutes, поэтому собираем их при первом запросе
+		routesOnce.Do(func() {
+			routes = make(map[string]bool)
+			for _, r := range c.App().GetRoutes(true) {
+				routes[r.Method+" "+r.Path] = true
+			}
+		})
+
+		// После c.Next() в c.Route() - последний выполненный маршрут; если это
+		// middleware (Use), обработчика для запроса не нашлось
+		method := c.Method()
+		route := c.Route().Path
+		if !routes[method+" "+route] {
+			route = unmatchedRoute
+		}
+
 		status := c.Response().StatusCode()
-		
-		RecordDuration(method, duration)
-		IncrementStatus(status)
-		
+		if err != nil {
+			// Ошибку еще обработает ErrorHandler
+			if e, ok := err.(*fiber.Error); ok {
+				status = e.Code
+			} else {
+				status = fiber.StatusInternalServerError
+			}
+		}
+		statusClass := strconv.Itoa(status/100) + "xx"
+
+		httpRequests.WithLabelValues(method, route, statusClass).Inc()
+		httpDuration.WithLabelValues(method, route, statusClass).Observe(time.Since(start).Seconds())
+
 		return err
 	}
-}
\ No newline at end of file
+}
@@ -0,0 +1,321 @@
+package migrate
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/RESERPIX/hubigr/internal/logger"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Ключ advisory lock: одновременно миграции применяет только один инстанс
+const lockKey int64 = 0x6875626967720001
+
+var fileRe = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+// Migration - пара файлов NNN_name.up.sql и NNN_name.down.sql
+type Migration struct {
+	Version  int64
+	Name     string
+	Up       string
+	Down     string
+	Checksum string // sha256 up-скрипта
+}
+
+// Status - состояние миграции в БД
+type Status struct {
+	Version   int64      `json:"version"`
+	Name      string     `json:"name"`
+	Applied   bool       `json:"applied"`
+	AppliedAt *time.Time `json:"applied_at,omitempty"`
+	// Modified - файл изменился после применения; Unknown - в БД есть версия,
+	// которой нет в бинарнике (БД мигрирована более новой версией сервиса)
+	Modified bool `json:"modified,omitempty"`
+	Unknown  bool `json:"unknown,omitempty"`
+}
+
+type applied struct {
+	name      string
+	checksum  string
+	appliedAt time.Time
+}
+
+// Load читает миграции из fsys и проверяет, что у каждой версии есть up-скрипт
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		m := fileRe.FindStringSubmatch(entry.Name())
+		if m == nil {
+			if strings.HasSuffix(entry.Name(), ".sql") {
+				return nil, fmt.Errorf("migration %s: name must be NNN_name.up.sql or NNN_name.down.sql", entry.Name())
+			}
+			continue
+		}
+		version, err := strconv.ParseInt(m[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s: %w", entry.Name(), err)
+		}
+		body, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = mig
+		} else if mig.Name != m[2] {
+			return nil, fmt.Errorf("migration %d: conflicting names %s and %s", version, mig.Name, m[2])
+		}
+		if (m[3] == "up" && mig.Checksum != "") || (m[3] == "down" && mig.Down != "") {
+			return nil, fmt.Errorf("migration %d: duplicate %s script", version, m[3])
+		}
+		if m[3] == "up" {
+			mig.Up = string(body)
+			sum := sha256.Sum256(body)
+			mig.Checksum = hex.EncodeToString(sum[:])
+		} else {
+			mig.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, mig := range byVersion {
+		if mig.Checksum == "" {
+			return nil, fmt.Errorf("migration %d_%s: missing up script", mig.Version, mig.Name)
+		}
+		migrations = append(migrations, *mig)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Migrator применяет и откатывает миграции. Каждая миграция выполняется в своей
+// транзакции вместе с записью в schema_migrations.
+type Migrator struct {
+	db         *pgxpool.Pool
+	migrations []Migration
+}
+
+func NewMigrator(db *pgxpool.Pool, migrations []Migration) *Migrator {
+	return &Migrator{db: db, migrations: migrations}
+}
+
+// Up применяет все непримененные миграции по порядку и возвращает их.
+// Если примененная миграция изменена, ничего не применяется.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var done []Migration
+	err := m.withLock(ctx, func(conn *pgxpool.Conn, state map[int64]applied) error {
+		if err := m.verify(state); err != nil {
+			return err
+		}
+		for _, mig := range m.migrations {
+			if _, ok := state[mig.Version]; ok {
+				continue
+			}
+			start := time.Now()
+			err := pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+				if _, err := tx.Exec(ctx, mig.Up); err != nil {
+					return err
+				}
+				_, err := tx.Exec(ctx, `
+					INSERT INTO schema_migrations (version, name, checksum) VALUES ($1, $2, $3)`,
+					mig.Version, mig.Name, mig.Checksum)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("migration %d_%s: %w", mig.Version, mig.Name, err)
+			}
+			logger.Info("Migration applied", "version", mig.Version, "name", mig.Name, "duration_ms", time.Since(start).Milliseconds())
+			done = append(done, mig)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Down откатывает steps последних примененных миграций и возвращает их
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	var done []Migration
+	err := m.withLock(ctx, func(conn *pgxpool.Conn, state map[int64]applied) error {
+		if err := m.verify(state); err != nil {
+			return err
+		}
+		for i := len(m.migrations) - 1; i >= 0 && len(done) < steps; i-- {
+			mig := m.migrations[i]
+			if _, ok := state[mig.Version]; !ok {
+				continue
+			}
+			if mig.Down == "" {
+				return fmt.Errorf("migration %d_%s: missing down script", mig.Version, mig.Name)
+			}
+			start := time.Now()
+			err := pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+				if _, err := tx.Exec(ctx, mig.Down); err != nil {
+					return err
+				}
+				_, err := tx.Exec(ctx, `DELETE FROM schema_migrations WHERE version = $1`, mig.Version)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("migration %d_%s: %w", mig.Version, mig.Name, err)
+			}
+			logger.Info("Migration rolled back", "version", mig.Version, "name", mig.Name, "duration_ms", time.Since(start).Milliseconds())
+			done = append(done, mig)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Status - все известные миграции и версии из БД, которых нет в бинарнике
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	state, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	known := make(map[int64]bool, len(m.migrations))
+	statuses := make([]Status, 0, len(m.migrations))
+	for _, mig := range m.migrations {
+		known[mig.Version] = true
+		s := Status{Version: mig.Version, Name: mig.Name}
+		if a, ok := state[mig.Version]; ok {
+			appliedAt := a.appliedAt
+			s.Applied = true
+			s.AppliedAt = &appliedAt
+			s.Modified = a.checksum != mig.Checksum
+		}
+		statuses = append(statuses, s)
+	}
+	for version, a := range state {
+		if !known[version] {
+			appliedAt := a.appliedAt
+			statuses = append(statuses, Status{Version: version, Name: a.name, Applied: true, AppliedAt: &appliedAt, Unknown: true})
+		}
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Version < statuses[j].Version })
+	return statuses, nil
+}
+
+// Check - ошибка, если есть непримененные или измененные миграции (для /readyz)
+func (m *Migrator) Check(ctx context.Context) error {
+	state, err := m.applied(ctx)
+	if err != nil {
+		return err
+	}
+	if err := m.verify(state); err != nil {
+		return err
+	}
+	var pending []int64
+	for _, mig := range m.migrations {
+		if _, ok := state[mig.Version]; !ok {
+			pending = append(pending, mig.Version)
+		}
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("pending migrations: %v", pending)
+	}
+	return nil
+}
+
+// verify сверяет контрольные суммы примененных миграций с файлами
+func (m *Migrator) verify(state map[int64]applied) error {
+	for _, mig := range m.migrations {
+		if a, ok := state[mig.Version]; ok && a.checksum != mig.Checksum {
+			return fmt.Errorf("migration %d_%s was modified after it was applied", mig.Version, mig.Name)
+		}
+	}
+	return nil
+}
+
+// withLock выполняет fn на одном соединении под advisory lock. Lock сессионный,
+// поэтому держится на выделенном соединении и снимается до возврата его в пул.
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *pgxpool.Conn, state map[int64]applied) error) error {
+	conn, err := m.db.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, `SELECT pg_advisory_lock($1)`, lockKey); err != nil {
+		return fmt.Errorf("acquire migration lock: %w", err)
+	}
+	defer func() {
+		// ctx мог быть отменен, lock снимаем в любом случае
+		if _, err := conn.Exec(context.Background(), `SELECT pg_advisory_unlock($1)`, lockKey); err != nil {
+			logger.Error("Failed to release migration lock", "error", err)
+			// Соединение с удерживаемым lock не должно вернуться в пул
+			conn.Conn().Close(context.Background())
+		}
+	}()
+
+	if _, err := conn.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version BIGINT PRIMARY KEY,
+			name TEXT NOT NULL,
+			checksum TEXT NOT NULL,
+			applied_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		)`); err != nil {
+		return fmt.Errorf("create schema_migrations: %w", err)
+	}
+
+	// Состояние читаем под lock: другой инстанс мог только что применить миграции
+	state, err := readApplied(ctx, conn)
+	if err != nil {
+		return err
+	}
+	return fn(conn, state)
+}
+
+// applied читает schema_migrations без lock; таблицы нет - ничего не применено
+func (m *Migrator) applied(ctx context.Context) (map[int64]applied, error) {
+	var exists bool
+	if err := m.db.QueryRow(ctx, `SELECT to_regclass('schema_migrations') IS NOT NULL`).Scan(&exists); err != nil {
+		return nil, err
+	}
+	if !exists {
+		return map[int64]applied{}, nil
+	}
+	return readApplied(ctx, m.db)
+}
+
+type querier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+func readApplied(ctx context.Context, q querier) (map[int64]applied, error) {
+	rows, err := q.Query(ctx, `SELECT version, name, checksum, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	state := make(map[int64]applied)
+	for rows.Next() {
+		var version int64
+		var a applied
+		if err := rows.Scan(&version, &a.name, &a.checksum, &a.appliedAt); err != nil {
+			return nil, err
+		}
+		state[version] = a
+	}
+	return state, rows.Err()
+}
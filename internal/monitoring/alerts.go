@@ -2,10 +2,11 @@ package monitoring
 
 import (
 	"context"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/RESERPIX/hubigr/internal/logger"
-	"github.com/RESERPIX/hubigr/internal/metrics"
 )
 
 type AlertLevel string
@@ -15,28 +16,99 @@ const (
 	AlertWarning  AlertLevel = "warning"
 )
 
+// AlertStatus - алерт сработал или условие больше не выполняется
+type AlertStatus string
+
+const (
+	AlertFiring   AlertStatus = "firing"
+	AlertResolved AlertStatus = "resolved"
+)
+
 type Alert struct {
-	Level   AlertLevel `json:"level"`
-	Service string     `json:"service"`
-	Message string     `json:"message"`
-	Time    time.Time  `json:"time"`
+	Name    string      `json:"name"`
+	Status  AlertStatus `json:"status"`
+	Level   AlertLevel  `json:"level"`
+	Service string      `json:"service"`
+	Message string      `json:"message"`
+	Time    time.Time   `json:"time"`
 }
 
+// activeAlert - сработавшее правило
+type activeAlert struct {
+	alert    Alert
+	notified bool // дежурные знают об алерте, значит им нужно и сообщение о снятии
+}
+
+// AlertManager периодически проверяет правила и рассылает алерты через notifiers.
+// Одинаковые алерты не повторяются чаще cooldown: ни пока условие выполняется,
+// ни если правило "мигает" (снялось и сразу сработало снова).
 type AlertManager struct {
-	alerts chan Alert
+	notifiers []Notifier
+	rules     []Rule
+	interval  time.Duration
+	cooldown  time.Duration
+	alerts    chan Alert
+
+	mu       sync.Mutex
+	active   map[string]*activeAlert
+	lastSent map[string]time.Time
+
+	stopCh chan struct{}
+	doneCh chan struct{}
 }
 
-func NewAlertManager() *AlertManager {
-	am := &AlertManager{
-		alerts: make(chan Alert, 100),
+func NewAlertManager(notifiers []Notifier, interval, cooldown time.Duration) *AlertManager {
+	return &AlertManager{
+		notifiers: notifiers,
+		interval:  interval,
+		cooldown:  cooldown,
+		alerts:    make(chan Alert, 100),
+		active:    make(map[string]*activeAlert),
+		lastSent:  make(map[string]time.Time),
+		stopCh:    make(chan struct{}),
+		doneCh:    make(chan struct{}),
+	}
+}
+
+// AddRules добавляет правила; вызывается до Start
+func (am *AlertManager) AddRules(rules ...Rule) {
+	am.rules = append(am.rules, rules...)
+}
+
+// Start проверяет правила каждые interval и рассылает алерты из SendAlert
+func (am *AlertManager) Start(ctx context.Context) {
+	defer close(am.doneCh)
+
+	ticker := time.NewTicker(am.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			am.evaluate(ctx, time.Now())
+		case alert := <-am.alerts:
+			am.handleEvent(ctx, alert)
+		case <-am.stopCh:
+			return
+		case <-ctx.Done():
+			return
+		}
 	}
-	go am.processAlerts()
-	return am
 }
 
+// Stop останавливает проверку правил и дожидается текущей рассылки
+func (am *AlertManager) Stop() {
+	close(am.stopCh)
+	<-am.doneCh
+}
+
+// SendAlert - разовый алерт вне правил (сбой фоновой задачи и т.п.); повторы
+// с тем же сервисом и текстом подавляются на cooldown
 func (am *AlertManager) SendAlert(level AlertLevel, service, message string) {
 	select {
 	case am.alerts <- Alert{
+		Name:    service,
+		Status:  AlertFiring,
 		Level:   level,
 		Service: service,
 		Message: message,
@@ -47,27 +119,111 @@ func (am *AlertManager) SendAlert(level AlertLevel, service, message string) {
 	}
 }
 
-func (am *AlertManager) processAlerts() {
-	for alert := range am.alerts {
-		logger.Error("ALERT", 
-			"level", alert.Level,
-			"service", alert.Service,
-			"message", alert.Message,
-			"time", alert.Time)
+// Active - сработавшие сейчас правила (для /health)
+func (am *AlertManager) Active() []Alert {
+	am.mu.Lock()
+	defer am.mu.Unlock()
+
+	alerts := make([]Alert, 0, len(am.active))
+	for _, a := range am.active {
+		alerts = append(alerts, a.alert)
+	}
+	sort.Slice(alerts, func(i, j int) bool { return alerts[i].Name < alerts[j].Name })
+	return alerts
+}
+
+// evaluate проверяет все правила и рассылает изменения состояния
+func (am *AlertManager) evaluate(ctx context.Context, now time.Time) {
+	for _, rule := range am.rules {
+		message, firing := rule.Check(ctx, now)
+
+		am.mu.Lock()
+		state, active := am.active[rule.Name]
+		var notify *Alert
+		switch {
+		case firing && !active:
+			state = &activeAlert{alert: Alert{
+				Name:    rule.Name,
+				Status:  AlertFiring,
+				Level:   rule.Level,
+				Service: rule.Service,
+				Message: message,
+				Time:    now,
+			}}
+			am.active[rule.Name] = state
+			if am.cooldownPassed(rule.Name, now) {
+				notify = &state.alert
+			}
+		case firing && active:
+			// Пока условие выполняется, напоминаем раз в cooldown
+			state.alert.Message = message
+			if am.cooldownPassed(rule.Name, now) {
+				notify = &state.alert
+			}
+		case !firing && active:
+			delete(am.active, rule.Name)
+			if state.notified {
+				resolved := state.alert
+				resolved.Status = AlertResolved
+				resolved.Message = message
+				resolved.Time = now
+				notify = &resolved
+			}
+		}
+		if notify != nil && notify.Status == AlertFiring {
+			state.notified = true
+			am.lastSent[rule.Name] = now
+		}
+		var alert Alert
+		if notify != nil {
+			alert = *notify
+		}
+		am.mu.Unlock()
+
+		if notify != nil {
+			am.notify(ctx, alert)
+		}
 	}
 }
 
-func (am *AlertManager) CheckMetrics(ctx context.Context) {
-	m := metrics.GetMetrics()
-	snapshot := m.GetSnapshot()
+// handleEvent рассылает разовый алерт с учетом cooldown
+func (am *AlertManager) handleEvent(ctx context.Context, alert Alert) {
+	key := alert.Service + "\x00" + alert.Message
+	am.mu.Lock()
+	send := am.cooldownPassed(key, alert.Time)
+	if send {
+		am.lastSent[key] = alert.Time
+	}
+	am.mu.Unlock()
 
-	// Проверка failed logins
-	if failedLogins, ok := snapshot["failed_logins"].(int64); ok && failedLogins > 10 {
-		am.SendAlert(AlertWarning, "auth", "High number of failed logins detected")
+	if send {
+		am.notify(ctx, alert)
 	}
+}
 
-	// Проверка uptime
-	if uptime, ok := snapshot["uptime_seconds"].(float64); ok && uptime < 60 {
-		am.SendAlert(AlertWarning, "system", "Service recently restarted")
+// cooldownPassed вызывается под am.mu
+func (am *AlertManager) cooldownPassed(key string, now time.Time) bool {
+	last, ok := am.lastSent[key]
+	return !ok || now.Sub(last) >= am.cooldown
+}
+
+// notify пишет алерт в лог и отправляет во все notifiers; ошибка одного
+// канала не мешает остальным
+func (am *AlertManager) notify(ctx context.Context, alert Alert) {
+	logger.Error("ALERT",
+		"name", alert.Name,
+		"status", alert.Status,
+		"level", alert.Level,
+		"service", alert.Service,
+		"message", alert.Message,
+		"time", alert.Time)
+
+	for _, n := range am.notifiers {
+		notifyCtx, cancel := context.WithTimeout(ctx, notifyTimeout)
+		err := n.Notify(notifyCtx, alert)
+		cancel()
+		if err != nil {
+			logger.Error("Failed to send alert notification", "notifier", n.Name(), "alert", alert.Name, "error", err)
+		}
 	}
-}
\ No newline at end of file
+}
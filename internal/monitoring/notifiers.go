@@ -0,0 +1,151 @@
+package monitoring
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	neturl "net/url"
+	"strings"
+	"time"
+
+	"github.com/RESERPIX/hubigr/internal/email"
+)
+
+// notifyTimeout - ограничение на отправку одного уведомления
+const notifyTimeout = 10 * time.Second
+
+// Notifier доставляет алерты дежурным
+type Notifier interface {
+	Name() string
+	Notify(ctx context.Context, alert Alert) error
+}
+
+// WebhookNotifier отправляет алерт как JSON (см. Alert) POST-запросом
+type WebhookNotifier struct {
+	url    string
+	client *http.Client
+}
+
+// NewWebhookNotifier создает уведомления в произвольный webhook
+func NewWebhookNotifier(url string) *WebhookNotifier {
+	return &WebhookNotifier{
+		url:    url,
+		client: &http.Client{Timeout: notifyTimeout},
+	}
+}
+
+func (n *WebhookNotifier) Name() string {
+	return "webhook"
+}
+
+func (n *WebhookNotifier) Notify(ctx context.Context, alert Alert) error {
+	return postJSON(ctx, n.client, n.url, alert)
+}
+
+// SlackNotifier отправляет алерт в Slack-совместимый incoming webhook
+// (Slack, Mattermost, Rocket.Chat принимают {"text": "..."})
+type SlackNotifier struct {
+	url    string
+	client *http.Client
+}
+
+// NewSlackNotifier создает уведомления в Slack-совместимый webhook
+func NewSlackNotifier(url string) *SlackNotifier {
+	return &SlackNotifier{
+		url:    url,
+		client: &http.Client{Timeout: notifyTimeout},
+	}
+}
+
+func (n *SlackNotifier) Name() string {
+	return "slack"
+}
+
+func (n *SlackNotifier) Notify(ctx context.Context, alert Alert) error {
+	icon := ":warning:"
+	switch {
+	case alert.Status == AlertResolved:
+		icon = ":white_check_mark:"
+	case alert.Level == AlertCritical:
+		icon = ":red_circle:"
+	}
+	status := strings.ToUpper(string(alert.Level))
+	if alert.Status == AlertResolved {
+		status = "RESOLVED"
+	}
+	text := fmt.Sprintf("%s *[%s] %s: %s*\n%s", icon, status, alert.Service, alert.Name, alert.Message)
+	return postJSON(ctx, n.client, n.url, map[string]string{"text": text})
+}
+
+// EmailNotifier отправляет алерт письмом напрямую через транспорт, минуя outbox:
+// outbox хранится в БД, а алерт может быть о ее недоступности
+type EmailNotifier struct {
+	sender     email.EmailSender
+	recipients []string
+}
+
+// NewEmailNotifier создает уведомления письмом на адреса recipients
+func NewEmailNotifier(sender email.EmailSender, recipients []string) *EmailNotifier {
+	return &EmailNotifier{
+		sender:     sender,
+		recipients: recipients,
+	}
+}
+
+func (n *EmailNotifier) Name() string {
+	return "email"
+}
+
+func (n *EmailNotifier) Notify(ctx context.Context, alert Alert) error {
+	msg := email.AlertEmail{
+		Name:    alert.Name,
+		Status:  string(alert.Status),
+		Level:   string(alert.Level),
+		Service: alert.Service,
+		Message: alert.Message,
+		Time:    alert.Time,
+	}
+	var failed []string
+	for _, to := range n.recipients {
+		if err := n.sender.SendAlertEmail(ctx, to, msg); err != nil {
+			failed = append(failed, err.Error())
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("send alert email: %s", strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+func postJSON(ctx context.Context, client *http.Client, url string, payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		// В адресе webhook Slack - секретный токен, в логи его не пишем
+		var urlErr *neturl.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("webhook request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
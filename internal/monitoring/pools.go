@@ -2,10 +2,12 @@ package monitoring
 
 import (
 	"context"
+	"fmt"
 	"time"
 
 	"github.com/RESERPIX/hubigr/internal/logger"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/redis/go-redis/v9"
 )
 
@@ -49,83 +51,81 @@ func (pm *PoolMonitor) Stop() {
 	close(pm.stopCh)
 }
 
-// checkPools проверяет состояние всех pools
+// checkPools пишет в лог состояние pools; проблемы отслеживают правила из Rules
 func (pm *PoolMonitor) checkPools(ctx context.Context) {
-	pm.checkDBPool()
-	pm.checkRedisPool(ctx)
-}
-
-// checkDBPool проверяет PostgreSQL connection pool
-func (pm *PoolMonitor) checkDBPool() {
-	stats := pm.dbPool.Stat()
-	
-	// Логируем статистику
+	db := pm.dbPool.Stat()
 	logger.Info("DB Pool Stats",
-		"acquired_conns", stats.AcquiredConns(),
-		"constructing_conns", stats.ConstructingConns(),
-		"idle_conns", stats.IdleConns(),
-		"max_conns", stats.MaxConns(),
-		"total_conns", stats.TotalConns(),
+		"acquired_conns", db.AcquiredConns(),
+		"constructing_conns", db.ConstructingConns(),
+		"idle_conns", db.IdleConns(),
+		"max_conns", db.MaxConns(),
+		"total_conns", db.TotalConns(),
 	)
 
-	// Проверяем на потенциальные проблемы
-	if stats.AcquiredConns() > int32(float64(stats.MaxConns())*0.8) {
-		logger.Warn("DB Pool: High connection usage",
-			"acquired", stats.AcquiredConns(),
-			"max", stats.MaxConns(),
-			"usage_percent", float64(stats.AcquiredConns())/float64(stats.MaxConns())*100,
-		)
-	}
-
-	if stats.ConstructingConns() > 5 {
-		logger.Warn("DB Pool: Many connections being constructed",
-			"constructing", stats.ConstructingConns(),
-		)
-	}
-
-	// Проверяем на заблокированные acquire операции
-	if stats.CanceledAcquireCount() > 0 {
-		logger.Warn("DB Pool: Canceled acquire operations detected",
-			"canceled_count", stats.CanceledAcquireCount(),
-		)
-	}
-}
-
-// checkRedisPool проверяет Redis connection pool
-func (pm *PoolMonitor) checkRedisPool(ctx context.Context) {
-	stats := pm.redisPool.PoolStats()
-	
-	// Логируем статистику
+	redisStats := pm.redisPool.PoolStats()
 	logger.Info("Redis Pool Stats",
-		"hits", stats.Hits,
-		"misses", stats.Misses,
-		"timeouts", stats.Timeouts,
-		"total_conns", stats.TotalConns,
-		"idle_conns", stats.IdleConns,
-		"stale_conns", stats.StaleConns,
+		"hits", redisStats.Hits,
+		"misses", redisStats.Misses,
+		"timeouts", redisStats.Timeouts,
+		"total_conns", redisStats.TotalConns,
+		"idle_conns", redisStats.IdleConns,
+		"stale_conns", redisStats.StaleConns,
 	)
+}
 
-	// Проверяем на потенциальные проблемы
-	if stats.Timeouts > 0 {
-		logger.Warn("Redis Pool: Connection timeouts detected",
-			"timeouts", stats.Timeouts,
-		)
-	}
-
-	if stats.StaleConns > 0 {
-		logger.Warn("Redis Pool: Stale connections detected",
-			"stale_conns", stats.StaleConns,
-		)
-	}
-
-	// Проверяем hit rate
-	if stats.Hits+stats.Misses > 0 {
-		hitRate := float64(stats.Hits) / float64(stats.Hits+stats.Misses) * 100
-		if hitRate < 50 {
-			logger.Warn("Redis Pool: Low hit rate",
-				"hit_rate_percent", hitRate,
-			)
-		}
+// pingTimeout - ограничение на проверку доступности БД и Redis в правилах
+const pingTimeout = 5 * time.Second
+
+// dbPoolSaturation - доля занятых соединений PostgreSQL, при которой срабатывает алерт
+const dbPoolSaturation = 0.8
+
+// Rules - правила алертов по БД, Redis и их pools. Счетчики pgx и go-redis растут
+// с момента запуска, поэтому смотрим на их прирост за последние минуты.
+func (pm *PoolMonitor) Rules() []Rule {
+	return []Rule{
+		{
+			Name:    "database_unavailable",
+			Level:   AlertCritical,
+			Service: "database",
+			Check: func(ctx context.Context, _ time.Time) (string, bool) {
+				ctx, cancel := context.WithTimeout(ctx, pingTimeout)
+				defer cancel()
+				if err := pm.dbPool.Ping(ctx); err != nil {
+					return "PostgreSQL ping failed: " + err.Error(), true
+				}
+				return "PostgreSQL is reachable", false
+			},
+		},
+		{
+			Name:    "redis_unavailable",
+			Level:   AlertCritical,
+			Service: "redis",
+			Check: func(ctx context.Context, _ time.Time) (string, bool) {
+				ctx, cancel := context.WithTimeout(ctx, pingTimeout)
+				defer cancel()
+				if err := pm.redisPool.Ping(ctx).Err(); err != nil {
+					return "Redis ping failed: " + err.Error(), true
+				}
+				return "Redis is reachable", false
+			},
+		},
+		{
+			Name:    "db_pool_saturated",
+			Level:   AlertWarning,
+			Service: "database",
+			Check: func(context.Context, time.Time) (string, bool) {
+				stats := pm.dbPool.Stat()
+				usage := float64(stats.AcquiredConns()) / float64(stats.MaxConns())
+				message := fmt.Sprintf("PostgreSQL pool usage: %d of %d connections", stats.AcquiredConns(), stats.MaxConns())
+				return message, usage >= dbPoolSaturation
+			},
+		},
+		IncreaseRule("db_pool_canceled_acquires", AlertWarning, "database", ruleWindow, 0,
+			func() float64 { return float64(pm.dbPool.Stat().CanceledAcquireCount()) },
+			"PostgreSQL connection acquires canceled in the last 5m: %.0f (threshold %.0f)"),
+		IncreaseRule("redis_pool_timeouts", AlertWarning, "redis", ruleWindow, 0,
+			func() float64 { return float64(pm.redisPool.PoolStats().Timeouts) },
+			"Redis pool timeouts in the last 5m: %.0f (threshold %.0f)"),
 	}
 }
 
@@ -156,4 +156,49 @@ func (pm *PoolMonitor) GetRedisPoolStats() map[string]interface{} {
 		"idle_conns":  stats.IdleConns,
 		"stale_conns": stats.StaleConns,
 	}
-}
\ No newline at end of file
+}
+var (
+	dbPoolConnsDesc = prometheus.NewDesc("db_pool_connections",
+		"PostgreSQL pool connections by state", []string{"state"}, nil)
+	dbPoolMaxConnsDesc = prometheus.NewDesc("db_pool_max_connections",
+		"PostgreSQL pool maximum connections", nil, nil)
+	dbPoolAcquiresDesc = prometheus.NewDesc("db_pool_acquires_total",
+		"PostgreSQL pool connection acquires by result", []string{"result"}, nil)
+	dbPoolAcquireSecondsDesc = prometheus.NewDesc("db_pool_acquire_duration_seconds_total",
+		"Total time spent acquiring PostgreSQL connections", nil, nil)
+	redisPoolConnsDesc = prometheus.NewDesc("redis_pool_connections",
+		"Redis pool connections by state", []string{"state"}, nil)
+	redisPoolRequestsDesc = prometheus.NewDesc("redis_pool_requests_total",
+		"Redis pool connection requests by result", []string{"result"}, nil)
+)
+
+// Describe - prometheus.Collector: метрики пулов читаются в момент запроса /metrics
+func (pm *PoolMonitor) Describe(ch chan<- *prometheus.Desc) {
+	ch <- dbPoolConnsDesc
+	ch <- dbPoolMaxConnsDesc
+	ch <- dbPoolAcquiresDesc
+	ch <- dbPoolAcquireSecondsDesc
+	ch <- redisPoolConnsDesc
+	ch <- redisPoolRequestsDesc
+}
+
+// Collect - prometheus.Collector
+func (pm *PoolMonitor) Collect(ch chan<- prometheus.Metric) {
+	db := pm.dbPool.Stat()
+	ch <- prometheus.MustNewConstMetric(dbPoolConnsDesc, prometheus.GaugeValue, float64(db.AcquiredConns()), "acquired")
+	ch <- prometheus.MustNewConstMetric(dbPoolConnsDesc, prometheus.GaugeValue, float64(db.IdleConns()), "idle")
+	ch <- prometheus.MustNewConstMetric(dbPoolConnsDesc, prometheus.GaugeValue, float64(db.ConstructingConns()), "constructing")
+	ch <- prometheus.MustNewConstMetric(dbPoolMaxConnsDesc, prometheus.GaugeValue, float64(db.MaxConns()))
+	ch <- prometheus.MustNewConstMetric(dbPoolAcquiresDesc, prometheus.CounterValue, float64(db.AcquireCount()), "success")
+	ch <- prometheus.MustNewConstMetric(dbPoolAcquiresDesc, prometheus.CounterValue, float64(db.EmptyAcquireCount()), "waited")
+	ch <- prometheus.MustNewConstMetric(dbPoolAcquiresDesc, prometheus.CounterValue, float64(db.CanceledAcquireCount()), "canceled")
+	ch <- prometheus.MustNewConstMetric(dbPoolAcquireSecondsDesc, prometheus.CounterValue, db.AcquireDuration().Seconds())
+
+	redisStats := pm.redisPool.PoolStats()
+	ch <- prometheus.MustNewConstMetric(redisPoolConnsDesc, prometheus.GaugeValue, float64(redisStats.TotalConns), "total")
+	ch <- prometheus.MustNewConstMetric(redisPoolConnsDesc, prometheus.GaugeValue, float64(redisStats.IdleConns), "idle")
+	ch <- prometheus.MustNewConstMetric(redisPoolConnsDesc, prometheus.GaugeValue, float64(redisStats.StaleConns), "stale")
+	ch <- prometheus.MustNewConstMetric(redisPoolRequestsDesc, prometheus.CounterValue, float64(redisStats.Hits), "hit")
+	ch <- prometheus.MustNewConstMetric(redisPoolRequestsDesc, prometheus.CounterValue, float64(redisStats.Misses), "miss")
+	ch <- prometheus.MustNewConstMetric(redisPoolRequestsDesc, prometheus.CounterValue, float64(redisStats.Timeouts), "timeout")
+}
@@ -0,0 +1,121 @@
+package monitoring
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/RESERPIX/hubigr/internal/metrics"
+)
+
+// Окно, за которое считаются приросты счетчиков в правилах
+const ruleWindow = 5 * time.Minute
+
+// Пороги доли ошибок: меньше minRequestsForErrorRate запросов за окно - не показатель
+const (
+	errorRateThreshold      = 0.05
+	minRequestsForErrorRate = 20
+)
+
+// Rule - условие алерта. Check возвращает текущее значение в виде текста для
+// уведомления и выполняется ли условие.
+type Rule struct {
+	Name    string
+	Level   AlertLevel
+	Service string
+	Check   func(ctx context.Context, now time.Time) (string, bool)
+}
+
+// rateWindow хранит значения счетчика за окно, чтобы считать прирост за последние
+// минуты, а не с момента запуска
+type rateWindow struct {
+	mu      sync.Mutex
+	window  time.Duration
+	samples []sample
+}
+
+type sample struct {
+	at    time.Time
+	value float64
+}
+
+func newRateWindow(window time.Duration) *rateWindow {
+	return &rateWindow{window: window}
+}
+
+// Add добавляет значение счетчика и возвращает его прирост за окно
+func (w *rateWindow) Add(now time.Time, value float64) float64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.samples = append(w.samples, sample{at: now, value: value})
+	// Оставляем последнее значение до начала окна - от него считается прирост
+	cutoff := now.Add(-w.window)
+	drop := 0
+	for drop+1 < len(w.samples) && !w.samples[drop+1].at.After(cutoff) {
+		drop++
+	}
+	w.samples = w.samples[drop:]
+
+	increase := value - w.samples[0].value
+	if increase < 0 {
+		// Счетчик сбросился
+		increase = value
+	}
+	return increase
+}
+
+// IncreaseRule - алерт, если счетчик read вырос больше threshold за window.
+// format получает прирост и порог.
+func IncreaseRule(name string, level AlertLevel, service string, window time.Duration, threshold float64, read func() float64, format string) Rule {
+	counter := newRateWindow(window)
+	return Rule{
+		Name:    name,
+		Level:   level,
+		Service: service,
+		Check: func(_ context.Context, now time.Time) (string, bool) {
+			increase := counter.Add(now, read())
+			return fmt.Sprintf(format, increase, threshold), increase > threshold
+		},
+	}
+}
+
+// DefaultRules - правила по метрикам сервиса: неудачные входы и 5xx за последние
+// минуты и недоступность Redis для лимитов
+func DefaultRules(failedLoginThreshold int) []Rule {
+	requests := newRateWindow(ruleWindow)
+	serverErrors := newRateWindow(ruleWindow)
+
+	return []Rule{
+		IncreaseRule("high_failed_logins", AlertWarning, "auth", ruleWindow, float64(failedLoginThreshold),
+			metrics.FailedLogins, "Failed logins in the last 5m: %.0f (threshold %.0f)"),
+		{
+			Name:    "high_error_rate",
+			Level:   AlertCritical,
+			Service: "http",
+			Check: func(_ context.Context, now time.Time) (string, bool) {
+				total, failed := metrics.HTTPRequestCounts()
+				total = requests.Add(now, total)
+				failed = serverErrors.Add(now, failed)
+				if total == 0 {
+					return "No requests in the last 5m", false
+				}
+				rate := failed / total
+				message := fmt.Sprintf("5xx responses in the last 5m: %.1f%% of %.0f requests", rate*100, total)
+				return message, total >= minRequestsForErrorRate && rate > errorRateThreshold
+			},
+		},
+		{
+			Name:    "rate_limit_redis_unavailable",
+			Level:   AlertCritical,
+			Service: "redis",
+			Check: func(context.Context, time.Time) (string, bool) {
+				if metrics.RateLimitBreakerIsOpen() {
+					return "Redis circuit breaker is open, rate limits use the fallback policy", true
+				}
+				return "Redis circuit breaker is closed", false
+			},
+		},
+	}
+}
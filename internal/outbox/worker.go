@@ -0,0 +1,248 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/RESERPIX/hubigr/internal/domain"
+	"github.com/RESERPIX/hubigr/internal/email"
+	"github.com/RESERPIX/hubigr/internal/logger"
+	"github.com/RESERPIX/hubigr/internal/metrics"
+	"github.com/RESERPIX/hubigr/internal/store"
+	"github.com/RESERPIX/hubigr/internal/tracing"
+	"github.com/RESERPIX/hubigr/internal/utils"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// baseBackoff - задержка перед первой повторной попыткой, дальше удваивается
+	baseBackoff = 30 * time.Second
+	// maxBackoff - потолок задержки между попытками
+	maxBackoff = time.Hour
+	// maxErrorLength - сколько текста ошибки храним в outbox
+	maxErrorLength = 500
+)
+
+// Worker разбирает email_outbox пулом горутин и отправляет письма с повторами
+type Worker struct {
+	repo         *store.EmailOutboxRepo
+	sender       email.EmailSender
+	concurrency  int
+	pollInterval time.Duration
+	stopCh       chan struct{}
+	doneCh       chan struct{}
+	wg           sync.WaitGroup
+}
+
+// NewWorker создает пул отправки писем
+func NewWorker(repo *store.EmailOutboxRepo, sender email.EmailSender, concurrency int, pollInterval time.Duration) *Worker {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	return &Worker{
+		repo:         repo,
+		sender:       sender,
+		concurrency:  concurrency,
+		pollInterval: pollInterval,
+		stopCh:       make(chan struct{}),
+		doneCh:       make(chan struct{}),
+	}
+}
+
+// Start запускает опрос outbox и воркеры; блокируется до Stop или отмены контекста
+func (w *Worker) Start(ctx context.Context) {
+	defer close(w.doneCh)
+	jobs := make(chan domain.OutboxEmail)
+
+	for i := 0; i < w.concurrency; i++ {
+		w.wg.Add(1)
+		go func() {
+			defer w.wg.Done()
+			for e := range jobs {
+				w.deliver(ctx, e)
+			}
+		}()
+	}
+	defer func() {
+		close(jobs)
+		w.wg.Wait()
+	}()
+
+	ticker := time.NewTicker(w.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		// Забираем очередь, пока она не опустеет, затем ждем следующего тика
+		for {
+			batch, err := w.repo.Claim(ctx, w.concurrency*2)
+			if err != nil {
+				logger.Error("Failed to claim outbox emails", "error", err)
+				break
+			}
+			for _, e := range batch {
+				select {
+				case jobs <- e:
+				case <-w.stopCh:
+					// Невзятые письма вернутся в очередь по истечении аренды
+					return
+				case <-ctx.Done():
+					return
+				}
+			}
+			if len(batch) < w.concurrency*2 {
+				break
+			}
+		}
+
+		select {
+		case <-ticker.C:
+		case <-w.stopCh:
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Stop останавливает опрос и дожидается писем, которые уже отправляются
+func (w *Worker) Stop() {
+	close(w.stopCh)
+	<-w.doneCh
+}
+
+// deliver отправляет одно письмо и фиксирует результат
+func (w *Worker) deliver(ctx context.Context, e domain.OutboxEmail) {
+	// Каждое письмо - отдельный трейс: запрос, поставивший его в outbox, давно завершен
+	ctx, span := tracing.Start(ctx, "outbox.deliver", trace.WithNewRoot(), trace.WithAttributes(
+		attribute.Int64("email.id", e.ID),
+		attribute.String("email.kind", string(e.Kind)),
+		attribute.Int("email.attempt", e.Attempts),
+	))
+	defer span.End()
+
+	err := w.send(ctx, e)
+	if err == nil {
+		w.logMarkError(ctx, e, "sent", w.repo.MarkSent(ctx, e.ID, e.Attempts))
+		metrics.IncrementEmailSent()
+		return
+	}
+
+	// Токен заменен новым запросом или истек, пока письмо ждало повтора
+	if errors.Is(err, store.ErrOutboxTokenExpired) {
+		w.logMarkError(ctx, e, "cancelled", w.repo.MarkCancelled(ctx, e.ID, e.Attempts))
+		logger.InfoContext(ctx, "Email with superseded or expired token cancelled",
+			"email_id", e.ID,
+			"kind", e.Kind,
+			"email", utils.SanitizeEmail(e.Recipient),
+		)
+		return
+	}
+
+	// Подавленный адрес - не ошибка доставки, повторять бессмысленно
+	if errors.Is(err, email.ErrSuppressed) {
+		w.logMarkError(ctx, e, "suppressed", w.repo.MarkSuppressed(ctx, e.ID, e.Attempts))
+		logger.InfoContext(ctx, "Email to suppressed address skipped",
+			"email_id", e.ID,
+			"kind", e.Kind,
+			"email", utils.SanitizeEmail(e.Recipient),
+		)
+		return
+	}
+
+	errText := utils.SanitizeForLog(err.Error())
+	if len(errText) > maxErrorLength {
+		errText = errText[:maxErrorLength]
+	}
+
+	status, markErr := w.repo.MarkFailed(ctx, e.ID, e.Attempts, errText, time.Now().Add(Backoff(e.Attempts)))
+	if markErr != nil {
+		w.logMarkError(ctx, e, "failed", markErr)
+		return
+	}
+
+	if status == domain.EmailStatusDead {
+		logger.ErrorContext(ctx, "Email moved to dead letter",
+			"email_id", e.ID,
+			"kind", e.Kind,
+			"email", utils.SanitizeEmail(e.Recipient),
+			"attempts", e.Attempts,
+			"error", errText,
+		)
+		return
+	}
+	logger.WarnContext(ctx, "Email send failed, will retry",
+		"email_id", e.ID,
+		"kind", e.Kind,
+		"email", utils.SanitizeEmail(e.Recipient),
+		"attempt", e.Attempts,
+		"error", errText,
+	)
+}
+
+// logMarkError логирует ошибку записи результата отправки. Потерянный захват -
+// не сбой: письмо отменили или его уже обрабатывает другой воркер
+func (w *Worker) logMarkError(ctx context.Context, e domain.OutboxEmail, result string, err error) {
+	if err == nil {
+		return
+	}
+	if errors.Is(err, store.ErrOutboxClaimLost) {
+		logger.WarnContext(ctx, "Email result not recorded, claim lost",
+			"email_id", e.ID,
+			"kind", e.Kind,
+			"attempt", e.Attempts,
+			"result", result,
+		)
+		return
+	}
+	logger.ErrorContext(ctx, "Failed to mark email as "+result, "error", err, "email_id", e.ID)
+}
+
+// send выбирает метод отправителя по типу письма
+func (w *Worker) send(ctx context.Context, e domain.OutboxEmail) error {
+	switch e.Kind {
+	case domain.EmailKindVerification, domain.EmailKindPasswordReset:
+		var payload domain.TokenEmailPayload
+		if err := json.Unmarshal(e.Payload, &payload); err != nil {
+			return fmt.Errorf("invalid payload: %w", err)
+		}
+		valid, err := w.repo.TokenValid(ctx, e.ID)
+		if err != nil {
+			return fmt.Errorf("check token: %w", err)
+		}
+		if !valid {
+			return store.ErrOutboxTokenExpired
+		}
+		if e.Kind == domain.EmailKindVerification {
+			return w.sender.SendVerificationEmail(ctx, e.Recipient, payload.Token, payload.Locale)
+		}
+		return w.sender.SendPasswordResetEmail(ctx, e.Recipient, payload.Token, payload.Locale)
+	case domain.EmailKindDigest:
+		var digest email.Digest
+		if err := json.Unmarshal(e.Payload, &digest); err != nil {
+			return fmt.Errorf("invalid payload: %w", err)
+		}
+		return w.sender.SendDigestEmail(ctx, e.Recipient, digest)
+	}
+	return fmt.Errorf("unknown email kind %q", e.Kind)
+}
+
+// Backoff - экспоненциальная задержка перед попыткой attempt+1 с джиттером до 20%
+func Backoff(attempt int) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+	delay := maxBackoff
+	if attempt <= 16 {
+		delay = baseBackoff << (attempt - 1)
+		if delay > maxBackoff {
+			delay = maxBackoff
+		}
+	}
+	return delay + time.Duration(rand.Int64N(int64(delay)/5+1))
+}
@@ -0,0 +1,132 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/RESERPIX/hubigr/internal/domain"
+	"github.com/RESERPIX/hubigr/internal/logger"
+)
+
+// ACLSource - хранилище списков IP (store.RateLimitACLRepo)
+type ACLSource interface {
+	ListActive(ctx context.Context) ([]domain.RateLimitACLEntry, error)
+}
+
+type aclRule struct {
+	prefix    netip.Prefix
+	action    domain.RateLimitACLAction
+	expiresAt *time.Time
+}
+
+// ACL - списки разрешенных и запрещенных IP/подсетей. Проверяется на каждом запросе,
+// поэтому держится в памяти и периодически перечитывается из БД; изменения через
+// админку применяются на этом инстансе сразу, на остальных - за interval.
+type ACL struct {
+	source   ACLSource
+	rules    atomic.Pointer[[]aclRule]
+	interval time.Duration
+	stopCh   chan struct{}
+}
+
+// NewACL создает пустые списки; до первого Reload все IP проверяются только лимитами
+func NewACL(source ACLSource, interval time.Duration) *ACL {
+	a := &ACL{source: source, interval: interval, stopCh: make(chan struct{})}
+	a.rules.Store(&[]aclRule{})
+	return a
+}
+
+// Start периодически перечитывает списки
+func (a *ACL) Start(ctx context.Context) {
+	ticker := time.NewTicker(a.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := a.Reload(ctx); err != nil {
+				logger.Error("Failed to reload rate limit ACL", "error", err)
+			}
+		case <-a.stopCh:
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Stop останавливает перечитывание
+func (a *ACL) Stop() {
+	close(a.stopCh)
+}
+
+// Reload загружает списки из БД
+func (a *ACL) Reload(ctx context.Context) error {
+	entries, err := a.source.ListActive(ctx)
+	if err != nil {
+		return err
+	}
+
+	rules := make([]aclRule, 0, len(entries))
+	for _, e := range entries {
+		prefix, err := ParseCIDR(e.CIDR)
+		if err != nil {
+			logger.Warn("Skipping invalid rate limit ACL entry", "id", e.ID, "cidr", e.CIDR)
+			continue
+		}
+		rules = append(rules, aclRule{prefix: prefix, action: e.Action, expiresAt: e.ExpiresAt})
+	}
+	a.rules.Store(&rules)
+	return nil
+}
+
+// Match возвращает действие для IP; пустая строка - IP нет в списках.
+// Побеждает самая узкая подсеть, при равных - deny.
+func (a *ACL) Match(ip string) domain.RateLimitACLAction {
+	if a == nil {
+		return ""
+	}
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ""
+	}
+	addr = addr.Unmap()
+
+	now := time.Now()
+	var action domain.RateLimitACLAction
+	bits := -1
+	for _, r := range *a.rules.Load() {
+		if r.expiresAt != nil && now.After(*r.expiresAt) {
+			continue
+		}
+		if !r.prefix.Contains(addr) {
+			continue
+		}
+		if r.prefix.Bits() > bits || (r.prefix.Bits() == bits && r.action == domain.RateLimitDeny) {
+			action, bits = r.action, r.prefix.Bits()
+		}
+	}
+	return action
+}
+
+// ParseCIDR разбирает подсеть или отдельный IP (как /32 или /128) и обнуляет биты хоста
+func ParseCIDR(s string) (netip.Prefix, error) {
+	s = strings.TrimSpace(s)
+	if !strings.Contains(s, "/") {
+		addr, err := netip.ParseAddr(s)
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("invalid IP or CIDR %q", s)
+		}
+		addr = addr.Unmap()
+		return netip.PrefixFrom(addr, addr.BitLen()), nil
+	}
+	prefix, err := netip.ParsePrefix(s)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("invalid IP or CIDR %q", s)
+	}
+	return prefix.Masked(), nil
+}
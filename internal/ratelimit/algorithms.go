@@ -0,0 +1,216 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Algorithm - алгоритм подсчета лимита
+type Algorithm string
+
+const (
+	// FixedWindow - счетчик на окно; на границе окон возможен всплеск до 2×limit
+	FixedWindow Algorithm = "fixed_window"
+	// SlidingLog - точный скользящий журнал запросов (ZSET), память O(limit) на ключ
+	SlidingLog Algorithm = "sliding_log"
+	// SlidingWindow - счетчики текущего и прошлого окна со взвешиванием, память O(1)
+	SlidingWindow Algorithm = "sliding_window"
+	// GCRA - token bucket (generic cell rate algorithm): равномерное пополнение,
+	// всплеск до limit запросов
+	GCRA Algorithm = "gcra"
+)
+
+// DefaultAlgorithm - алгоритм правил, для которых он не указан явно
+const DefaultAlgorithm = SlidingWindow
+
+// IsValid проверяет название алгоритма
+func (a Algorithm) IsValid() bool {
+	switch a {
+	case FixedWindow, SlidingLog, SlidingWindow, GCRA:
+		return true
+	}
+	return false
+}
+
+// Limiter - проверка лимита одним из алгоритмов
+type Limiter interface {
+	Allow(ctx context.Context, key string, limit int, window time.Duration) (Result, error)
+}
+
+// Result - итог проверки лимита для заголовков RateLimit-*
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset - через сколько квота восстановится (для отказа - когда можно повторить)
+	Reset time.Duration
+}
+
+// Все скрипты принимают KEYS[1] - ключ, ARGV[1] - лимит, ARGV[2] - окно в мс
+// и возвращают {разрешен ли запрос, использовано запросов, мс до сброса}.
+// Время берется из Redis, чтобы инстансы с разными часами считали одинаково.
+
+var fixedWindowScript = redis.NewScript(`
+local key = KEYS[1]
+local limit = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+
+local current = tonumber(redis.call('GET', key) or '0')
+if current >= limit then
+    return {0, current, redis.call('PTTL', key)}
+end
+
+current = redis.call('INCR', key)
+if current == 1 then
+    redis.call('PEXPIRE', key, window)
+end
+return {1, current, redis.call('PTTL', key)}
+`)
+
+// KEYS[2] - счетчик для уникальных элементов журнала
+var slidingLogScript = redis.NewScript(`
+local key = KEYS[1]
+local limit = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+
+redis.call('ZREMRANGEBYSCORE', key, '-inf', now - window)
+local count = redis.call('ZCARD', key)
+local allowed = 0
+if count < limit then
+    local seq = redis.call('INCR', KEYS[2])
+    redis.call('PEXPIRE', KEYS[2], window)
+    redis.call('ZADD', key, now, now .. '-' .. seq)
+    redis.call('PEXPIRE', key, window)
+    count = count + 1
+    allowed = 1
+end
+
+local oldest = redis.call('ZRANGE', key, 0, 0, 'WITHSCORES')
+local reset = window
+if oldest[2] then
+    reset = tonumber(oldest[2]) + window - now
+end
+return {allowed, count, reset}
+`)
+
+var slidingWindowScript = redis.NewScript(`
+local key = KEYS[1]
+local limit = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+local cur_start = now - (now % window)
+
+local data = redis.call('HMGET', key, 'start', 'cur', 'prev')
+local start = tonumber(data[1])
+local cur = tonumber(data[2]) or 0
+local prev = tonumber(data[3]) or 0
+if start ~= cur_start then
+    if start == cur_start - window then
+        prev = cur
+    else
+        prev = 0
+    end
+    cur = 0
+end
+
+local elapsed = now - cur_start
+local estimated = prev * (window - elapsed) / window + cur
+if estimated + 1 > limit then
+    local retry = window - elapsed
+    if prev > 0 and limit - 1 - cur >= 0 then
+        retry = math.ceil(window - (limit - 1 - cur) * window / prev) - elapsed
+    end
+    if retry < 1 then
+        retry = 1
+    end
+    return {0, limit, retry}
+end
+
+cur = cur + 1
+redis.call('HSET', key, 'start', cur_start, 'cur', cur, 'prev', prev)
+redis.call('PEXPIRE', key, window * 2)
+return {1, math.ceil(estimated + 1), window - elapsed}
+`)
+
+var gcraScript = redis.NewScript(`
+local key = KEYS[1]
+local limit = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+local interval = window / limit
+
+local tat = tonumber(redis.call('GET', key) or '0')
+if tat < now then
+    tat = now
+end
+local new_tat = tat + interval
+local allow_at = new_tat - window
+if now < allow_at then
+    return {0, limit, math.ceil(allow_at - now)}
+end
+
+redis.call('SET', key, string.format('%.3f', new_tat), 'PX', math.ceil(new_tat - now))
+local remaining = math.floor((now - allow_at) / interval)
+return {1, limit - remaining, math.ceil(new_tat - now)}
+`)
+
+// storageKey - ключ счетчика алгоритма. Алгоритмы хранят разные типы данных,
+// поэтому ключи у них свои.
+func storageKey(key string, algorithm Algorithm) string {
+	return key + ":" + string(algorithm)
+}
+
+var algorithmScripts = map[Algorithm]*redis.Script{
+	FixedWindow:   fixedWindowScript,
+	SlidingLog:    slidingLogScript,
+	SlidingWindow: slidingWindowScript,
+	GCRA:          gcraScript,
+}
+
+// scriptLimiter выполняет Lua скрипт алгоритма через EVALSHA
+// (go-redis сам догружает скрипт через EVAL, если Redis его забыл)
+type scriptLimiter struct {
+	client    *redis.Client
+	algorithm Algorithm
+	script    *redis.Script
+}
+
+func (l *scriptLimiter) Allow(ctx context.Context, key string, limit int, window time.Duration) (Result, error) {
+	key = storageKey(key, l.algorithm)
+	keys := []string{key}
+	if l.algorithm == SlidingLog {
+		keys = append(keys, key+":seq")
+	}
+
+	result, err := l.script.Run(ctx, l.client, keys, limit, window.Milliseconds()).Int64Slice()
+	if err != nil {
+		return Result{}, err
+	}
+	if len(result) != 3 {
+		return Result{}, fmt.Errorf("unexpected script result")
+	}
+
+	reset := time.Duration(result[2]) * time.Millisecond
+	if reset < 0 {
+		// Ключ без TTL (не должен возникать) - считаем, что окно только началось
+		reset = window
+	}
+	remaining := limit - int(result[1])
+	if remaining < 0 {
+		remaining = 0
+	}
+
+	return Result{
+		Allowed:   result[0] == 1,
+		Limit:     limit,
+		Remaining: remaining,
+		Reset:     reset,
+	}, nil
+}
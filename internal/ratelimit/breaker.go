@@ -0,0 +1,115 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+
+	"github.com/RESERPIX/hubigr/internal/logger"
+	"github.com/RESERPIX/hubigr/internal/metrics"
+)
+
+// BreakerState - состояние circuit breaker
+type BreakerState string
+
+const (
+	BreakerClosed   BreakerState = "closed"    // Redis работает, запросы идут в него
+	BreakerOpen     BreakerState = "open"      // Redis недоступен, запросы сразу идут в fallback
+	BreakerHalfOpen BreakerState = "half_open" // пробный запрос после паузы
+)
+
+const (
+	// breakerFailureThreshold - сколько ошибок подряд размыкают цепь
+	breakerFailureThreshold = 5
+	// breakerCooldown - через сколько после размыкания пробовать Redis снова
+	breakerCooldown = 10 * time.Second
+)
+
+// CircuitBreaker - после нескольких ошибок Redis подряд перестает обращаться к нему
+// на breakerCooldown, чтобы запросы не ждали таймаутов недоступного Redis.
+// После паузы пропускает один пробный запрос: успех замыкает цепь, ошибка - снова размыкает.
+type CircuitBreaker struct {
+	mu        sync.Mutex
+	state     BreakerState
+	failures  int
+	openedAt  time.Time
+	threshold int
+	cooldown  time.Duration
+}
+
+// NewCircuitBreaker создает замкнутый breaker
+func NewCircuitBreaker(threshold int, cooldown time.Duration) *CircuitBreaker {
+	metrics.SetRateLimitBreakerOpen(false)
+	return &CircuitBreaker{state: BreakerClosed, threshold: threshold, cooldown: cooldown}
+}
+
+// Allow сообщает, можно ли обращаться к Redis
+func (b *CircuitBreaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return false
+		}
+		// Пауза прошла - пропускаем один пробный запрос
+		b.state = BreakerHalfOpen
+		return true
+	case BreakerHalfOpen:
+		// Пробный запрос уже выполняется
+		return false
+	}
+	return true
+}
+
+// Success - запрос к Redis прошел
+func (b *CircuitBreaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures = 0
+	if b.state != BreakerClosed {
+		b.state = BreakerClosed
+		metrics.SetRateLimitBreakerOpen(false)
+		logger.Info("Rate limiter circuit breaker closed, Redis is back")
+	}
+}
+
+// Failure - запрос к Redis завершился ошибкой
+func (b *CircuitBreaker) Failure(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	if b.state == BreakerHalfOpen || (b.state == BreakerClosed && b.failures >= b.threshold) {
+		if b.state == BreakerClosed {
+			metrics.IncrementRateLimitBreakerTrips()
+		}
+		b.state = BreakerOpen
+		b.openedAt = time.Now()
+		metrics.SetRateLimitBreakerOpen(true)
+		logger.Warn("Rate limiter circuit breaker opened", "failures", b.failures, "cooldown", b.cooldown, "error", err)
+	}
+}
+
+// State возвращает текущее состояние
+func (b *CircuitBreaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// RetryAfter - сколько осталось до пробного запроса к Redis
+func (b *CircuitBreaker) RetryAfter() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state != BreakerOpen {
+		return time.Second
+	}
+	left := b.cooldown - time.Since(b.openedAt)
+	if left < time.Second {
+		return time.Second
+	}
+	return left
+}
@@ -0,0 +1,207 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	// localMaxKeys - ограничение памяти локального лимитера; при переполнении
+	// вытесняются произвольные ключи
+	localMaxKeys = 100000
+	// localSweepInterval - как часто удалять истекшие ключи
+	localSweepInterval = time.Minute
+)
+
+// LocalLimiter - лимиты в памяти процесса на случай недоступности Redis. Алгоритмы
+// повторяют Lua скрипты, но счетчики у каждого инстанса свои, поэтому при нескольких
+// инстансах фактический лимит в N раз выше.
+type LocalLimiter struct {
+	mu        sync.Mutex
+	entries   map[string]*localEntry
+	nextSweep time.Time
+}
+
+// localEntry - состояние ключа; используются поля алгоритма ключа
+type localEntry struct {
+	expiresAt time.Time
+
+	count int       // fixed_window: запросов в окне; sliding_window: в текущем окне
+	start time.Time // sliding_window: начало текущего окна
+	prev  int       // sliding_window: запросов в прошлом окне
+	log   []time.Time
+	tat   time.Time // gcra: theoretical arrival time
+}
+
+// NewLocalLimiter создает пустой локальный лимитер
+func NewLocalLimiter() *LocalLimiter {
+	return &LocalLimiter{entries: make(map[string]*localEntry)}
+}
+
+// Limiter возвращает проверку лимита выбранным алгоритмом
+func (l *LocalLimiter) Limiter(algorithm Algorithm) Limiter {
+	if !algorithm.IsValid() {
+		algorithm = DefaultAlgorithm
+	}
+	return &localAlgorithm{local: l, algorithm: algorithm}
+}
+
+type localAlgorithm struct {
+	local     *LocalLimiter
+	algorithm Algorithm
+}
+
+func (a *localAlgorithm) Allow(_ context.Context, key string, limit int, window time.Duration) (Result, error) {
+	return a.local.allow(storageKey(key, a.algorithm), a.algorithm, limit, window, time.Now()), nil
+}
+
+func (l *LocalLimiter) allow(key string, algorithm Algorithm, limit int, window time.Duration, now time.Time) Result {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.After(l.nextSweep) {
+		l.sweep(now)
+		l.nextSweep = now.Add(localSweepInterval)
+	}
+
+	e, ok := l.entries[key]
+	if ok && now.After(e.expiresAt) {
+		ok = false
+	}
+	if !ok {
+		if len(l.entries) >= localMaxKeys {
+			l.evict()
+		}
+		e = &localEntry{}
+		l.entries[key] = e
+	}
+
+	var allowed bool
+	var used int
+	var reset time.Duration
+	switch algorithm {
+	case FixedWindow:
+		allowed, used, reset = e.fixedWindow(limit, window, now)
+	case SlidingLog:
+		allowed, used, reset = e.slidingLog(limit, window, now)
+	case GCRA:
+		allowed, used, reset = e.gcra(limit, window, now)
+	default:
+		allowed, used, reset = e.slidingWindow(limit, window, now)
+	}
+
+	remaining := limit - used
+	if remaining < 0 {
+		remaining = 0
+	}
+	return Result{Allowed: allowed, Limit: limit, Remaining: remaining, Reset: reset}
+}
+
+func (e *localEntry) fixedWindow(limit int, window time.Duration, now time.Time) (bool, int, time.Duration) {
+	if e.count == 0 {
+		e.expiresAt = now.Add(window)
+	}
+	if e.count >= limit {
+		return false, e.count, e.expiresAt.Sub(now)
+	}
+	e.count++
+	return true, e.count, e.expiresAt.Sub(now)
+}
+
+func (e *localEntry) slidingLog(limit int, window time.Duration, now time.Time) (bool, int, time.Duration) {
+	cutoff := now.Add(-window)
+	i := 0
+	for i < len(e.log) && !e.log[i].After(cutoff) {
+		i++
+	}
+	e.log = e.log[i:]
+
+	allowed := false
+	if len(e.log) < limit {
+		e.log = append(e.log, now)
+		e.expiresAt = now.Add(window)
+		allowed = true
+	}
+	return allowed, len(e.log), e.log[0].Add(window).Sub(now)
+}
+
+func (e *localEntry) slidingWindow(limit int, window time.Duration, now time.Time) (bool, int, time.Duration) {
+	curStart := now.Truncate(window)
+	if !e.start.Equal(curStart) {
+		if e.start.Equal(curStart.Add(-window)) {
+			e.prev = e.count
+		} else {
+			e.prev = 0
+		}
+		e.count = 0
+		e.start = curStart
+	}
+
+	elapsed := now.Sub(curStart)
+	weight := float64(window-elapsed) / float64(window)
+	estimated := float64(e.prev)*weight + float64(e.count)
+	if estimated+1 > float64(limit) {
+		retry := window - elapsed
+		if e.prev > 0 && limit-1-e.count >= 0 {
+			retry = time.Duration(math.Ceil(float64(window)-float64(limit-1-e.count)*float64(window)/float64(e.prev))) - elapsed
+		}
+		if retry < time.Millisecond {
+			retry = time.Millisecond
+		}
+		return false, limit, retry
+	}
+
+	e.count++
+	e.expiresAt = now.Add(2 * window)
+	return true, int(math.Ceil(estimated + 1)), window - elapsed
+}
+
+func (e *localEntry) gcra(limit int, window time.Duration, now time.Time) (bool, int, time.Duration) {
+	interval := window / time.Duration(limit)
+	tat := e.tat
+	if tat.Before(now) {
+		tat = now
+	}
+	newTAT := tat.Add(interval)
+	allowAt := newTAT.Add(-window)
+	if now.Before(allowAt) {
+		return false, limit, allowAt.Sub(now)
+	}
+
+	e.tat = newTAT
+	e.expiresAt = newTAT
+	remaining := int(now.Sub(allowAt) / interval)
+	return true, limit - remaining, newTAT.Sub(now)
+}
+
+// sweep удаляет истекшие ключи
+func (l *LocalLimiter) sweep(now time.Time) {
+	for key, e := range l.entries {
+		if now.After(e.expiresAt) {
+			delete(l.entries, key)
+		}
+	}
+}
+
+// evict освобождает десятую часть ключей
+func (l *LocalLimiter) evict() {
+	n := len(l.entries) / 10
+	for key := range l.entries {
+		if n <= 0 {
+			break
+		}
+		delete(l.entries, key)
+		n--
+	}
+}
+
+// Reset удаляет локальные счетчики ключа всех алгоритмов
+func (l *LocalLimiter) Reset(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for algorithm := range algorithmScripts {
+		delete(l.entries, storageKey(key, algorithm))
+	}
+}
@@ -0,0 +1,222 @@
+package ratelimit
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// KeyBy - по какому признаку считается лимит
+type KeyBy string
+
+const (
+	KeyByIP    KeyBy = "ip"    // IP клиента
+	KeyByUser  KeyBy = "user"  // user_id авторизованного пользователя, без авторизации - "ip:<адрес>"
+	KeyByEmail KeyBy = "email" // email из тела запроса (вход, регистрация, сброс пароля)
+	KeyByToken KeyBy = "token" // хэш API токена (внутреннее API)
+)
+
+// Rule - один лимит: не больше Limit запросов за Window для ключа KeyBy
+type Rule struct {
+	KeyBy     KeyBy
+	Limit     int
+	Window    time.Duration
+	Algorithm Algorithm
+}
+
+// FailureMode - что делать с запросом, когда Redis недоступен
+type FailureMode string
+
+const (
+	// FailClosed - отклонять запросы (503)
+	FailClosed FailureMode = "closed"
+	// FailOpen - пропускать запросы без ограничений
+	FailOpen FailureMode = "open"
+	// FailLocal - считать лимиты в памяти инстанса теми же алгоритмами
+	FailLocal FailureMode = "local"
+)
+
+// IsValid проверяет название режима
+func (m FailureMode) IsValid() bool {
+	switch m {
+	case FailClosed, FailOpen, FailLocal:
+		return true
+	}
+	return false
+}
+
+// Policy - набор лимитов маршрута; запрос проходит, только если не превышен ни один
+type Policy struct {
+	Name      string
+	Rules     []Rule
+	OnFailure FailureMode
+}
+
+// Policies - лимиты по именам маршрутов
+type Policies map[string]Policy
+
+// DefaultPolicies - лимиты по умолчанию. Вход и отправка писем ограничены по email
+// (подбор пароля к одному аккаунту) и мягче по IP, чтобы пользователи за одним NAT
+// не делили общий лимит.
+func DefaultPolicies() Policies {
+	return defaultPolicies(DefaultAlgorithm)
+}
+
+// Без Redis маршруты входа и регистрации продолжают ограничиваться локально
+// (иначе открывается подбор паролей), остальные пропускаются.
+func defaultPolicies(alg Algorithm) Policies {
+	return Policies{
+		"login":       {"login", []Rule{{KeyByEmail, 5, time.Minute, alg}, {KeyByIP, 30, time.Minute, alg}}, FailLocal},
+		"signup":      {"signup", []Rule{{KeyByEmail, 3, time.Minute, alg}, {KeyByIP, 20, time.Minute, alg}}, FailLocal},
+		"refresh":     {"refresh", []Rule{{KeyByIP, 30, time.Minute, alg}}, FailLocal},
+		"email_send":  {"email_send", []Rule{{KeyByEmail, 5, time.Minute, alg}, {KeyByIP, 30, time.Minute, alg}}, FailLocal},
+		"profile":     {"profile", []Rule{{KeyByUser, 30, time.Minute, alg}}, FailOpen},
+		"public":      {"public", []Rule{{KeyByIP, 60, time.Minute, alg}}, FailOpen},
+		"unsubscribe": {"unsubscribe", []Rule{{KeyByIP, 20, time.Minute, alg}}, FailOpen},
+		"internal":    {"internal", []Rule{{KeyByToken, 600, time.Minute, GCRA}}, FailOpen},
+	}
+}
+
+// ParsePolicies переопределяет лимиты по умолчанию из строки вида
+// "login=email:5/1m,ip:30/1m@gcra;profile=user:60/1m". Маршруты, которых нет
+// в строке, сохраняют лимиты по умолчанию. Алгоритм указывается после "@",
+// без него используется defaultAlgorithm.
+func ParsePolicies(spec string, defaultAlgorithm Algorithm) (Policies, error) {
+	if !defaultAlgorithm.IsValid() {
+		return nil, fmt.Errorf("unknown rate limit algorithm %q", defaultAlgorithm)
+	}
+	policies := defaultPolicies(defaultAlgorithm)
+	for _, entry := range strings.Split(spec, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, rulesSpec, ok := strings.Cut(entry, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("rate limit %q: expected <route>=<rules>", entry)
+		}
+		if _, known := policies[name]; !known {
+			return nil, fmt.Errorf("rate limit %q: unknown route", name)
+		}
+
+		var rules []Rule
+		for _, ruleSpec := range strings.Split(rulesSpec, ",") {
+			rule, err := parseRule(strings.TrimSpace(ruleSpec), defaultAlgorithm)
+			if err != nil {
+				return nil, fmt.Errorf("rate limit %q: %w", name, err)
+			}
+			rules = append(rules, rule)
+		}
+		policies[name] = Policy{Name: name, Rules: rules, OnFailure: policies[name].OnFailure}
+	}
+	return policies, nil
+}
+
+// SetFailureModes переопределяет поведение при недоступности Redis из строки вида
+// "local;login=closed;public=open". Значение без имени маршрута применяется ко всем
+// маршрутам, указанные по имени - поверх него.
+func (p Policies) SetFailureModes(spec string) error {
+	overrides := map[string]FailureMode{}
+	for _, entry := range strings.Split(spec, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, mode, ok := strings.Cut(entry, "=")
+		if !ok {
+			name, mode = "", entry
+		}
+		name, mode = strings.TrimSpace(name), strings.TrimSpace(mode)
+		if !FailureMode(mode).IsValid() {
+			return fmt.Errorf("failure mode %q: must be closed, open or local", entry)
+		}
+		if name != "" {
+			if _, known := p[name]; !known {
+				return fmt.Errorf("failure mode %q: unknown route", name)
+			}
+		}
+		overrides[name] = FailureMode(mode)
+	}
+
+	for name, policy := range p {
+		if mode, ok := overrides[""]; ok {
+			policy.OnFailure = mode
+		}
+		if mode, ok := overrides[name]; ok {
+			policy.OnFailure = mode
+		}
+		p[name] = policy
+	}
+	return nil
+}
+
+// parseRule разбирает "email:5/1m" или "email:5/1m@gcra"
+func parseRule(spec string, defaultAlgorithm Algorithm) (Rule, error) {
+	algorithm := defaultAlgorithm
+	if rest, alg, ok := strings.Cut(spec, "@"); ok {
+		algorithm = Algorithm(alg)
+		if !algorithm.IsValid() {
+			return Rule{}, fmt.Errorf("rule %q: algorithm must be fixed_window, sliding_log, sliding_window or gcra", spec)
+		}
+		spec = rest
+	}
+
+	keyBy, limitSpec, ok := strings.Cut(spec, ":")
+	if !ok {
+		return Rule{}, fmt.Errorf("rule %q: expected <key>:<limit>/<window>", spec)
+	}
+	switch KeyBy(keyBy) {
+	case KeyByIP, KeyByUser, KeyByEmail, KeyByToken:
+	default:
+		return Rule{}, fmt.Errorf("rule %q: key must be ip, user, email or token", spec)
+	}
+
+	limitStr, windowStr, ok := strings.Cut(limitSpec, "/")
+	if !ok {
+		return Rule{}, fmt.Errorf("rule %q: expected <limit>/<window>", spec)
+	}
+	limit, err := strconv.Atoi(limitStr)
+	if err != nil || limit < 1 {
+		return Rule{}, fmt.Errorf("rule %q: limit must be a positive number", spec)
+	}
+	window, err := time.ParseDuration(windowStr)
+	if err != nil || window < time.Second {
+		return Rule{}, fmt.Errorf("rule %q: window must be a duration of at least 1s", spec)
+	}
+	return Rule{KeyBy: KeyBy(keyBy), Limit: limit, Window: window, Algorithm: algorithm}, nil
+}
+
+// Get возвращает лимиты маршрута; для неизвестного имени - пустую политику без ограничений
+func (p Policies) Get(name string) Policy {
+	if policy, ok := p[name]; ok {
+		return policy
+	}
+	return Policy{Name: name, OnFailure: FailOpen}
+}
+
+// String - лимиты в формате ParsePolicies с режимом отказа, для логов при старте
+func (p Policies) String() string {
+	names := make([]string, 0, len(p))
+	for name := range p {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	entries := make([]string, 0, len(names))
+	for _, name := range names {
+		rules := make([]string, 0, len(p[name].Rules))
+		for _, r := range p[name].Rules {
+			rules = append(rules, fmt.Sprintf("%s:%d/%s@%s", r.KeyBy, r.Limit, r.Window, r.Algorithm))
+		}
+		entries = append(entries, name+"="+strings.Join(rules, ",")+" (on failure: "+string(p[name].OnFailure)+")")
+	}
+	return strings.Join(entries, ";")
+}
+
+// Key - ключ счетчика в Redis
+func Key(policy string, keyBy KeyBy, value string) string {
+	return "rl:" + policy + ":" + string(keyBy) + ":" + value
+}
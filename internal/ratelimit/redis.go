@@ -2,14 +2,26 @@ package ratelimit
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math"
+	"strconv"
 	"time"
 
+	"github.com/RESERPIX/hubigr/internal/metrics"
 	"github.com/redis/go-redis/v9"
 )
 
+// ErrUnavailable - Redis недоступен, а маршрут настроен отклонять запросы (FailClosed)
+var ErrUnavailable = errors.New("rate limiter unavailable")
+
+// callTimeout - сколько ждать Redis при проверке лимита, прежде чем считать его недоступным
+const callTimeout = 500 * time.Millisecond
+
 type RedisLimiter struct {
-	client *redis.Client
+	client  *redis.Client
+	breaker *CircuitBreaker
+	local   *LocalLimiter
 }
 
 func NewRedisLimiter(redisURL string) (*RedisLimiter, error) {
@@ -34,71 +46,165 @@ func NewRedisLimiter(redisURL string) (*RedisLimiter, error) {
 	if err := client.Ping(ctx).Err(); err != nil {
 		return nil, err
 	}
-	
-	return &RedisLimiter{client: client}, nil
-}
 
-// Lua скрипт для атомарного rate limiting
-var rateLimitScript = `
-local key = KEYS[1]
-local limit = tonumber(ARGV[1])
-local window = tonumber(ARGV[2])
-
-local current = redis.call('GET', key)
-if current == false then
-    redis.call('SET', key, 1, 'EX', window)
-    return 1
-end
-
-current = tonumber(current)
-if current >= limit then
-    return 0
-end
-
-local new_count = redis.call('INCR', key)
-return new_count <= limit and 1 or 0
-`
-
-// Allow проверяет лимит согласно ТЗ: 5 попыток входа/мин
-func (r *RedisLimiter) Allow(ctx context.Context, key string, limit int, window time.Duration) (bool, error) {
-	result, err := r.client.Eval(ctx, rateLimitScript, []string{key}, limit, int(window.Seconds())).Result()
-	if err != nil {
-		return false, err
+	limiter := &RedisLimiter{
+		client:  client,
+		breaker: NewCircuitBreaker(breakerFailureThreshold, breakerCooldown),
+		local:   NewLocalLimiter(),
 	}
-	
-	allowed, ok := result.(int64)
+	if err := limiter.loadScripts(ctx); err != nil {
+		client.Close()
+		return nil, err
+	}
+	return limiter, nil
+}
+
+// Limiter возвращает проверку лимита выбранным алгоритмом
+func (r *RedisLimiter) Limiter(algorithm Algorithm) Limiter {
+	script, ok := algorithmScripts[algorithm]
 	if !ok {
-		return false, fmt.Errorf("unexpected script result")
+		algorithm, script = DefaultAlgorithm, algorithmScripts[DefaultAlgorithm]
 	}
-	
-	return allowed == 1, nil
+	return &scriptLimiter{client: r.client, algorithm: algorithm, script: script}
+}
+
+// Check проверяет правило политики. Пока Redis недоступен (ошибка или разомкнутый
+// circuit breaker), поступает по policy.OnFailure: пропускает запрос, считает лимит
+// локально или возвращает ErrUnavailable.
+func (r *RedisLimiter) Check(ctx context.Context, policy Policy, rule Rule, key string) (Result, error) {
+	if r.breaker.Allow() {
+		callCtx, cancel := context.WithTimeout(ctx, callTimeout)
+		result, err := r.Limiter(rule.Algorithm).Allow(callCtx, key, rule.Limit, rule.Window)
+		cancel()
+		if err == nil {
+			r.breaker.Success()
+			return result, nil
+		}
+		r.breaker.Failure(err)
+	}
+
+	metrics.IncrementRateLimitFallback(policy.Name, string(policy.OnFailure))
+	switch policy.OnFailure {
+	case FailOpen:
+		return Result{Allowed: true, Limit: rule.Limit, Remaining: rule.Limit, Reset: rule.Window}, nil
+	case FailLocal:
+		return r.local.Limiter(rule.Algorithm).Allow(ctx, key, rule.Limit, rule.Window)
+	}
+	return Result{}, ErrUnavailable
+}
+
+// RetryAfter - когда снова пробовать после ErrUnavailable
+func (r *RedisLimiter) RetryAfter() time.Duration {
+	return r.breaker.RetryAfter()
 }
 
-// GetRemaining возвращает оставшиеся попытки
-func (r *RedisLimiter) GetRemaining(ctx context.Context, key string, limit int) (int, error) {
-	count, err := r.client.Get(ctx, key).Int()
-	if err == redis.Nil {
-		return limit, nil
+// loadScripts загружает Lua скрипты в Redis заранее, чтобы запросы шли через EVALSHA
+func (r *RedisLimiter) loadScripts(ctx context.Context) error {
+	for algorithm, script := range algorithmScripts {
+		if err := script.Load(ctx, r.client).Err(); err != nil {
+			return fmt.Errorf("load %s script: %w", algorithm, err)
+		}
 	}
+	return nil
+}
+
+// GetRemaining возвращает, сколько запросов осталось по правилу, не расходуя квоту
+func (r *RedisLimiter) GetRemaining(ctx context.Context, key string, rule Rule) (int, error) {
+	key = storageKey(key, rule.Algorithm)
+	serverTime, err := r.client.Time(ctx).Result()
 	if err != nil {
 		return 0, err
 	}
-	
-	remaining := limit - count
+	now := float64(serverTime.UnixMilli())
+	window := float64(rule.Window.Milliseconds())
+	limit := float64(rule.Limit)
+
+	var used float64
+	switch rule.Algorithm {
+	case FixedWindow:
+		count, err := r.client.Get(ctx, key).Int()
+		if err != nil && err != redis.Nil {
+			return 0, err
+		}
+		used = float64(count)
+	case SlidingLog:
+		count, err := r.client.ZCount(ctx, key, "("+strconv.FormatFloat(now-window, 'f', 0, 64), "+inf").Result()
+		if err != nil {
+			return 0, err
+		}
+		used = float64(count)
+	case GCRA:
+		tat, err := r.client.Get(ctx, key).Float64()
+		if err == redis.Nil {
+			return rule.Limit, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		// Сколько запросов уложится до текущего момента (как в gcraScript)
+		interval := window / limit
+		used = limit - math.Floor((now+window-math.Max(tat, now))/interval)
+	default:
+		data, err := r.client.HMGet(ctx, key, "start", "cur", "prev").Result()
+		if err != nil {
+			return 0, err
+		}
+		start, cur, prev := redisFloat(data[0]), redisFloat(data[1]), redisFloat(data[2])
+		curStart := now - math.Mod(now, window)
+		if start != curStart {
+			if start == curStart-window {
+				prev = cur
+			} else {
+				prev = 0
+			}
+			cur = 0
+		}
+		used = math.Ceil(prev*(window-(now-curStart))/window + cur)
+	}
+
+	remaining := rule.Limit - int(used)
 	if remaining < 0 {
 		remaining = 0
 	}
+	if remaining > rule.Limit {
+		remaining = rule.Limit
+	}
 	return remaining, nil
 }
 
-// GetTTL возвращает время до сброса лимита
-func (r *RedisLimiter) GetTTL(ctx context.Context, key string) (time.Duration, error) {
-	return r.client.TTL(ctx, key).Result()
+// redisFloat - число из ответа HMGET (nil для отсутствующего поля)
+func redisFloat(v interface{}) float64 {
+	s, ok := v.(string)
+	if !ok {
+		return 0
+	}
+	f, _ := strconv.ParseFloat(s, 64)
+	return f
 }
 
-// LoginKey генерирует ключ для rate limiting входа по IP
-func LoginKey(ip string) string {
-	return fmt.Sprintf("login:%s", ip)
+// GetTTL возвращает время до сброса счетчика алгоритма; 0 - счетчика нет
+func (r *RedisLimiter) GetTTL(ctx context.Context, key string, algorithm Algorithm) (time.Duration, error) {
+	ttl, err := r.client.PTTL(ctx, storageKey(key, algorithm)).Result()
+	if err != nil {
+		return 0, err
+	}
+	if ttl < 0 {
+		return 0, nil
+	}
+	return ttl, nil
+}
+
+// Reset удаляет счетчики ключа всех алгоритмов в Redis и локальном лимитере.
+// Возвращает количество удаленных ключей Redis.
+func (r *RedisLimiter) Reset(ctx context.Context, key string) (int64, error) {
+	r.local.Reset(key)
+
+	keys := make([]string, 0, len(algorithmScripts)+1)
+	for algorithm := range algorithmScripts {
+		keys = append(keys, storageKey(key, algorithm))
+	}
+	keys = append(keys, storageKey(key, SlidingLog)+":seq")
+	return r.client.Del(ctx, keys...).Result()
 }
 
 // Ping - проверка соединения с Redis
@@ -0,0 +1,191 @@
+package realtime
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+
+	"github.com/RESERPIX/hubigr/internal/domain"
+	"github.com/RESERPIX/hubigr/internal/logger"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// NotificationsChannel - Redis канал, через который инстансы обмениваются новыми уведомлениями
+	NotificationsChannel = "hubigr:notifications"
+	// MaxSubscriptionsPerUser - максимум одновременных стримов на пользователя (вкладки, устройства),
+	// новый стрим сверх него вытесняет самый старый
+	MaxSubscriptionsPerUser = 5
+	// subscriptionBuffer - буфер событий на одного подписчика
+	subscriptionBuffer = 32
+)
+
+// Subscription - локальная подписка одного SSE соединения
+type Subscription struct {
+	userID  int64
+	seq     uint64 // порядок создания, чтобы вытеснять самую старую подписку
+	ch      chan domain.Notification
+	done    chan struct{}
+	once    sync.Once
+	evicted atomic.Bool
+}
+
+// C возвращает канал новых уведомлений
+func (s *Subscription) C() <-chan domain.Notification {
+	return s.ch
+}
+
+// Done закрывается, когда подписка отменена (переполнение буфера или остановка хаба).
+// Клиент переподключится с Last-Event-ID и получит пропущенное из БД.
+func (s *Subscription) Done() <-chan struct{} {
+	return s.done
+}
+
+// Evicted - подписку вытеснила более новая сверх MaxSubscriptionsPerUser
+func (s *Subscription) Evicted() bool {
+	return s.evicted.Load()
+}
+
+func (s *Subscription) cancel() {
+	s.once.Do(func() { close(s.done) })
+}
+
+// Hub раздает уведомления локальным SSE подписчикам и рассылает их
+// другим инстансам через Redis pub/sub
+type Hub struct {
+	client *redis.Client
+	mu     sync.RWMutex
+	subs   map[int64]map[*Subscription]struct{}
+	seq    uint64
+	pubsub *redis.PubSub
+}
+
+// NewHub создает хаб поверх существующего Redis клиента
+func NewHub(client *redis.Client) *Hub {
+	return &Hub{
+		client: client,
+		subs:   make(map[int64]map[*Subscription]struct{}),
+	}
+}
+
+// Start подписывается на Redis канал и раздает сообщения до отмены контекста
+func (h *Hub) Start(ctx context.Context) error {
+	h.pubsub = h.client.Subscribe(ctx, NotificationsChannel)
+	if _, err := h.pubsub.Receive(ctx); err != nil {
+		h.pubsub.Close()
+		return err
+	}
+
+	go func() {
+		// Channel() сам переподключается к Redis при обрыве соединения
+		for msg := range h.pubsub.Channel() {
+			var n domain.Notification
+			if err := json.Unmarshal([]byte(msg.Payload), &n); err != nil {
+				logger.Error("Invalid realtime notification payload", "error", err)
+				continue
+			}
+			h.dispatch(n)
+		}
+	}()
+
+	return nil
+}
+
+// Publish рассылает уведомления всем инстансам (включая текущий)
+func (h *Hub) Publish(ctx context.Context, notifications []domain.Notification) error {
+	if len(notifications) == 0 {
+		return nil
+	}
+
+	pipe := h.client.Pipeline()
+	for _, n := range notifications {
+		payload, err := json.Marshal(n)
+		if err != nil {
+			return err
+		}
+		pipe.Publish(ctx, NotificationsChannel, payload)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// Subscribe регистрирует локального подписчика пользователя. Сверх
+// MaxSubscriptionsPerUser вытесняется самая старая подписка: обрыв соединения
+// замечается только при следующей записи, и мертвые подписки не должны
+// мешать переподключению.
+func (h *Hub) Subscribe(userID int64) *Subscription {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.subs[userID] == nil {
+		h.subs[userID] = make(map[*Subscription]struct{})
+	}
+	for len(h.subs[userID]) >= MaxSubscriptionsPerUser {
+		var oldest *Subscription
+		for sub := range h.subs[userID] {
+			if oldest == nil || sub.seq < oldest.seq {
+				oldest = sub
+			}
+		}
+		delete(h.subs[userID], oldest)
+		oldest.evicted.Store(true)
+		oldest.cancel()
+	}
+
+	h.seq++
+	sub := &Subscription{
+		userID: userID,
+		seq:    h.seq,
+		ch:     make(chan domain.Notification, subscriptionBuffer),
+		done:   make(chan struct{}),
+	}
+	h.subs[userID][sub] = struct{}{}
+	return sub
+}
+
+// Unsubscribe удаляет подписку
+func (h *Hub) Unsubscribe(sub *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if subs, ok := h.subs[sub.userID]; ok {
+		delete(subs, sub)
+		if len(subs) == 0 {
+			delete(h.subs, sub.userID)
+		}
+	}
+	sub.cancel()
+}
+
+// Close останавливает хаб и завершает все локальные стримы
+func (h *Hub) Close() error {
+	h.mu.Lock()
+	for _, subs := range h.subs {
+		for sub := range subs {
+			sub.cancel()
+		}
+	}
+	h.subs = make(map[int64]map[*Subscription]struct{})
+	h.mu.Unlock()
+
+	if h.pubsub != nil {
+		return h.pubsub.Close()
+	}
+	return nil
+}
+
+// dispatch отдает уведомление локальным подписчикам пользователя без блокировки
+func (h *Hub) dispatch(n domain.Notification) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for sub := range h.subs[n.UserID] {
+		select {
+		case sub.ch <- n:
+		default:
+			// Медленный клиент: обрываем стрим, пропущенное он дочитает по Last-Event-ID
+			sub.cancel()
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/RESERPIX/hubigr/internal/logger"
+	"github.com/RESERPIX/hubigr/internal/metrics"
+	"github.com/RESERPIX/hubigr/internal/monitoring"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Ключ advisory lock лидера: задачи выполняет только инстанс, который его держит
+const leaderLockKey int64 = 0x6875626967720002
+
+// Как часто проверять лидерство и сроки задач
+const tickInterval = 15 * time.Second
+
+// Removed - число удаленных задачей строк или файлов по видам ("refresh_tokens" и т.п.)
+type Removed map[string]int64
+
+// Job - периодическая задача
+type Job struct {
+	Name     string
+	Interval time.Duration
+	Timeout  time.Duration
+	Run      func(ctx context.Context) (Removed, error)
+}
+
+// Scheduler выполняет задачи на одном инстансе из нескольких. Лидер выбирается
+// через сессионный advisory lock PostgreSQL на выделенном соединении: если
+// инстанс упал или потерял соединение, lock снимается и задачи подхватывает
+// другой инстанс.
+type Scheduler struct {
+	db      *pgxpool.Pool
+	alerts  *monitoring.AlertManager
+	jobs    []Job
+	nextRun map[string]time.Time
+
+	conn *pgxpool.Conn // соединение с lock, nil - не лидер
+
+	stopCh chan struct{}
+	doneCh chan struct{}
+}
+
+// NewScheduler создает планировщик; о сбоях задач сообщается через alerts
+func NewScheduler(db *pgxpool.Pool, alerts *monitoring.AlertManager, jobs ...Job) *Scheduler {
+	return &Scheduler{
+		db:      db,
+		alerts:  alerts,
+		jobs:    jobs,
+		nextRun: make(map[string]time.Time),
+		stopCh:  make(chan struct{}),
+		doneCh:  make(chan struct{}),
+	}
+}
+
+// Start проверяет лидерство и выполняет задачи, у которых подошел срок, до Stop
+func (s *Scheduler) Start(ctx context.Context) {
+	defer close(s.doneCh)
+	defer s.resign()
+
+	// Stop прерывает текущую задачу, а не ждет ее таймаута
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-s.stopCh:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	ticker := time.NewTicker(tickInterval)
+	defer ticker.Stop()
+
+	s.tick(ctx)
+	for {
+		select {
+		case <-ticker.C:
+			s.tick(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Stop прерывает текущую задачу и отдает лидерство
+func (s *Scheduler) Stop() {
+	close(s.stopCh)
+	<-s.doneCh
+}
+
+func (s *Scheduler) tick(ctx context.Context) {
+	if !s.ensureLeader(ctx) {
+		return
+	}
+	now := time.Now()
+	for _, job := range s.jobs {
+		if now.Before(s.nextRun[job.Name]) {
+			continue
+		}
+		s.run(ctx, job)
+		s.nextRun[job.Name] = time.Now().Add(job.Interval)
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// ensureLeader проверяет, что lock еще наш, или пытается его взять
+func (s *Scheduler) ensureLeader(ctx context.Context) bool {
+	if s.conn != nil {
+		if err := s.conn.Ping(ctx); err == nil {
+			return true
+		}
+		// Соединение потеряно - вместе с ним и lock
+		logger.Warn("Scheduler lost leader connection")
+		s.conn.Conn().Close(context.Background())
+		s.conn.Release()
+		s.conn = nil
+		metrics.SetSchedulerLeader(false)
+	}
+
+	conn, err := s.db.Acquire(ctx)
+	if err != nil {
+		logger.Error("Scheduler failed to acquire connection", "error", err)
+		return false
+	}
+	var acquired bool
+	if err := conn.QueryRow(ctx, `SELECT pg_try_advisory_lock($1)`, leaderLockKey).Scan(&acquired); err != nil || !acquired {
+		if err != nil {
+			logger.Error("Scheduler failed to try leader lock", "error", err)
+		}
+		conn.Release()
+		return false
+	}
+
+	s.conn = conn
+	metrics.SetSchedulerLeader(true)
+	logger.Info("Scheduler leadership acquired")
+	return true
+}
+
+// resign снимает lock, чтобы другой инстанс сразу стал лидером
+func (s *Scheduler) resign() {
+	if s.conn == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := s.conn.Exec(ctx, `SELECT pg_advisory_unlock($1)`, leaderLockKey); err != nil {
+		// Соединение с lock не должно вернуться в пул
+		s.conn.Conn().Close(ctx)
+	}
+	s.conn.Release()
+	s.conn = nil
+	metrics.SetSchedulerLeader(false)
+	logger.Info("Scheduler leadership released")
+}
+
+// run выполняет задачу с таймаутом и пишет метрики
+func (s *Scheduler) run(ctx context.Context, job Job) {
+	jobCtx, cancel := context.WithTimeout(ctx, job.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	removed, err := job.Run(jobCtx)
+	duration := time.Since(start)
+	metrics.ObserveJobRun(job.Name, duration, err == nil)
+
+	args := []any{"job", job.Name, "duration_ms", duration.Milliseconds()}
+	for target, count := range removed {
+		metrics.AddJobRemoved(job.Name, target, count)
+		args = append(args, target, count)
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			// Остановка сервиса, а не сбой
+			logger.Warn("Scheduled job interrupted", args...)
+			return
+		}
+		logger.Error("Scheduled job failed", append(args, "error", err)...)
+		s.alerts.SendAlert(monitoring.AlertWarning, "scheduler", fmt.Sprintf("Job %s failed: %v", job.Name, err))
+		return
+	}
+	logger.Info("Scheduled job finished", args...)
+}
@@ -1,9 +1,13 @@
 package security
 
 import (
+	"crypto/hmac"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -89,4 +93,40 @@ func VerifyRefreshToken(hash, token string) bool {
 // VerifyCSRFToken проверяет CSRF токен (простое сравнение)
 func VerifyCSRFToken(expected, provided string) bool {
 	return expected == provided && expected != ""
-}
\ No newline at end of file
+}
+
+// SignUnsubscribeToken подписывает ссылку отписки: <user_id>.<kind>.<hmac>
+func SignUnsubscribeToken(userID int64, kind, secret string) string {
+	payload := strconv.FormatInt(userID, 10) + "." + kind
+	return payload + "." + unsubscribeMAC(payload, secret)
+}
+
+// VerifyUnsubscribeToken проверяет подпись ссылки отписки и возвращает пользователя и тип отписки
+func VerifyUnsubscribeToken(token, secret string) (int64, string, error) {
+	idx := strings.LastIndex(token, ".")
+	if idx <= 0 {
+		return 0, "", fmt.Errorf("invalid unsubscribe token")
+	}
+	payload, mac := token[:idx], token[idx+1:]
+
+	if !hmac.Equal([]byte(mac), []byte(unsubscribeMAC(payload, secret))) {
+		return 0, "", fmt.Errorf("invalid unsubscribe token")
+	}
+
+	parts := strings.SplitN(payload, ".", 2)
+	if len(parts) != 2 {
+		return 0, "", fmt.Errorf("invalid unsubscribe token")
+	}
+	userID, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return 0, "", fmt.Errorf("invalid unsubscribe token")
+	}
+	return userID, parts[1], nil
+}
+
+// unsubscribeMAC - HMAC с отдельным префиксом, чтобы подпись нельзя было переиспользовать в других местах
+func unsubscribeMAC(payload, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("unsubscribe:" + payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
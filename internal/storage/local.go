@@ -0,0 +1,172 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// LocalStorage хранит объекты файлами в каталоге: ключ "avatars/x.jpg" -
+// файл <root>/avatars/x.jpg. Подходит для одного инстанса: реплики не видят
+// файлы друг друга.
+type LocalStorage struct {
+	root string // абсолютный путь
+}
+
+func NewLocalStorage(dir string) (*LocalStorage, error) {
+	root, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("resolve storage dir %q: %w", dir, err)
+	}
+	// Каталог с безопасными правами (0700 - только владелец)
+	if err := os.MkdirAll(root, 0700); err != nil {
+		return nil, fmt.Errorf("create storage dir %q: %w", dir, err)
+	}
+	return &LocalStorage{root: root}, nil
+}
+
+// path - путь к файлу объекта с проверкой, что он строго внутри root
+func (s *LocalStorage) path(key string) (string, error) {
+	if !ValidKey(key) {
+		return "", ErrInvalidKey
+	}
+	path := filepath.Join(s.root, filepath.FromSlash(key))
+	// Критическая проверка - файл должен быть строго внутри каталога
+	if !strings.HasPrefix(path, s.root+string(filepath.Separator)) {
+		return "", ErrInvalidKey
+	}
+	return path, nil
+}
+
+func (s *LocalStorage) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	// Пишем во временный файл и переименовываем: читатель не увидит
+	// наполовину записанный объект. Имена с точкой List пропускает.
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
+
+func (s *LocalStorage) Open(ctx context.Context, key string) (io.ReadCloser, *Object, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	if !info.Mode().IsRegular() {
+		f.Close()
+		return nil, nil, ErrNotFound
+	}
+	return f, &Object{Key: key, Size: info.Size(), ModTime: info.ModTime()}, nil
+}
+
+func (s *LocalStorage) Delete(ctx context.Context, key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (s *LocalStorage) List(ctx context.Context, prefix string) ([]Object, error) {
+	// Обходим только каталог, в котором лежат ключи с этим префиксом
+	dir := s.root
+	if i := strings.LastIndex(prefix, "/"); i > 0 {
+		var err error
+		if dir, err = s.path(prefix[:i]); err != nil {
+			return nil, err
+		}
+	}
+
+	objects := []Object{}
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == dir {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if !entry.Type().IsRegular() || strings.HasPrefix(entry.Name(), ".") {
+			return nil
+		}
+		rel, err := filepath.Rel(s.root, path)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			// Файл удалили во время обхода
+			return nil
+		}
+		objects = append(objects, Object{Key: key, Size: info.Size(), ModTime: info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return objects, nil
+}
+
+// PresignGet: локальные файлы отдает SecureStaticHandler
+func (s *LocalStorage) PresignGet(ctx context.Context, key string) (string, error) {
+	return "", ErrPresignNotSupported
+}
+
+// Ping проверяет, что каталог существует
+func (s *LocalStorage) Ping(ctx context.Context) error {
+	info, err := os.Stat(s.root)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", s.root)
+	}
+	return nil
+}
@@ -0,0 +1,326 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// emptyPayloadHash - sha256 пустого тела для GET/HEAD/DELETE
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// S3Storage хранит объекты в бакете S3-совместимого хранилища (AWS S3, MinIO).
+// Запросы подписываются AWS Signature Version 4, адресация path-style
+// (<endpoint>/<bucket>/<key>), поэтому подходит и MinIO без настройки DNS.
+type S3Storage struct {
+	endpoint       *url.URL
+	publicEndpoint *url.URL // адрес для ссылок клиентам, если хранилище видно снаружи под другим именем
+	region         string
+	bucket         string
+	accessKey      string
+	secretKey      string
+	presignTTL     time.Duration
+	client         *http.Client
+}
+
+func NewS3Storage(endpoint, publicEndpoint, region, bucket, accessKey, secretKey string, presignTTL time.Duration) (*S3Storage, error) {
+	parse := func(name, raw string) (*url.URL, error) {
+		u, err := url.Parse(strings.TrimRight(raw, "/"))
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("invalid %s %q", name, raw)
+		}
+		return u, nil
+	}
+	endpointURL, err := parse("S3 endpoint", endpoint)
+	if err != nil {
+		return nil, err
+	}
+	publicURL := endpointURL
+	if publicEndpoint != "" {
+		if publicURL, err = parse("S3 public endpoint", publicEndpoint); err != nil {
+			return nil, err
+		}
+	}
+	return &S3Storage{
+		endpoint:       endpointURL,
+		publicEndpoint: publicURL,
+		region:         region,
+		bucket:         bucket,
+		accessKey:      accessKey,
+		secretKey:      secretKey,
+		presignTTL:     presignTTL,
+		client:         &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+func (s *S3Storage) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	if !ValidKey(key) {
+		return ErrInvalidKey
+	}
+	resp, err := s.do(ctx, http.MethodPut, key, nil, data, contentType)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return s3Error(resp)
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+func (s *S3Storage) Open(ctx context.Context, key string) (io.ReadCloser, *Object, error) {
+	if !ValidKey(key) {
+		return nil, nil, ErrInvalidKey
+	}
+	resp, err := s.do(ctx, http.MethodGet, key, nil, nil, "")
+	if err != nil {
+		return nil, nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, nil, ErrNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, nil, s3Error(resp)
+	}
+	modTime, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+	return resp.Body, &Object{Key: key, Size: resp.ContentLength, ModTime: modTime}, nil
+}
+
+func (s *S3Storage) Delete(ctx context.Context, key string) error {
+	if !ValidKey(key) {
+		return ErrInvalidKey
+	}
+	resp, err := s.do(ctx, http.MethodDelete, key, nil, nil, "")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// S3 отвечает 204 и для несуществующего ключа
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return s3Error(resp)
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+// listBucketResult - ответ ListObjectsV2
+type listBucketResult struct {
+	Contents []struct {
+		Key          string    `xml:"Key"`
+		Size         int64     `xml:"Size"`
+		LastModified time.Time `xml:"LastModified"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+func (s *S3Storage) List(ctx context.Context, prefix string) ([]Object, error) {
+	objects := []Object{}
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		resp, err := s.do(ctx, http.MethodGet, "", query, nil, "")
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			err := s3Error(resp)
+			resp.Body.Close()
+			return nil, err
+		}
+		var result listBucketResult
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("decode S3 list response: %w", err)
+		}
+
+		for _, item := range result.Contents {
+			objects = append(objects, Object{Key: item.Key, Size: item.Size, ModTime: item.LastModified})
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return objects, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// PresignGet - ссылка на GET объекта, подписанная в query string и
+// действующая presignTTL
+func (s *S3Storage) PresignGet(ctx context.Context, key string) (string, error) {
+	if !ValidKey(key) {
+		return "", ErrInvalidKey
+	}
+	now := time.Now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	scope := now.Format("20060102") + "/" + s.region + "/s3/aws4_request"
+
+	u := s.objectURL(s.publicEndpoint, key, nil)
+	query := url.Values{
+		"X-Amz-Algorithm":     {"AWS4-HMAC-SHA256"},
+		"X-Amz-Credential":    {s.accessKey + "/" + scope},
+		"X-Amz-Date":          {amzDate},
+		"X-Amz-Expires":       {strconv.Itoa(int(s.presignTTL.Seconds()))},
+		"X-Amz-SignedHeaders": {"host"},
+	}
+	canonicalRequest := strings.Join([]string{
+		http.MethodGet,
+		u.EscapedPath(),
+		canonicalQuery(query),
+		"host:" + u.Host + "\n",
+		"host",
+		"UNSIGNED-PAYLOAD",
+	}, "\n")
+	query.Set("X-Amz-Signature", s.signature(now, canonicalRequest))
+	u.RawQuery = canonicalQuery(query)
+	return u.String(), nil
+}
+
+// Ping проверяет, что бакет существует и ключи подходят
+func (s *S3Storage) Ping(ctx context.Context) error {
+	resp, err := s.do(ctx, http.MethodHead, "", nil, nil, "")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("S3 bucket %s returned %d", s.bucket, resp.StatusCode)
+	}
+	return nil
+}
+
+// do выполняет подписанный запрос к объекту key или к бакету, если key пустой
+func (s *S3Storage) do(ctx context.Context, method, key string, query url.Values, body []byte, contentType string) (*http.Response, error) {
+	u := s.objectURL(s.endpoint, key, query)
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if body == nil {
+		req.Body = http.NoBody
+		req.ContentLength = 0
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	s.sign(req, body, time.Now().UTC())
+	return s.client.Do(req)
+}
+
+func (s *S3Storage) objectURL(endpoint *url.URL, key string, query url.Values) *url.URL {
+	u := *endpoint
+	u.Path = endpoint.Path + "/" + s.bucket
+	if key != "" {
+		u.Path += "/" + key
+	}
+	u.RawQuery = canonicalQuery(query)
+	return &u
+}
+
+// sign подписывает запрос AWS Signature Version 4 для сервиса "s3"
+func (s *S3Storage) sign(req *http.Request, body []byte, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	payloadHash := emptyPayloadHash
+	if len(body) > 0 {
+		payloadHash = sha256Hex(body)
+	}
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonicalHeaders := "host:" + req.URL.Host + "\n" +
+		"x-amz-content-sha256:" + payloadHash + "\n" +
+		"x-amz-date:" + amzDate + "\n"
+	if contentType := req.Header.Get("Content-Type"); contentType != "" {
+		signedHeaders = "content-type;" + signedHeaders
+		canonicalHeaders = "content-type:" + contentType + "\n" + canonicalHeaders
+	}
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := now.Format("20060102") + "/" + s.region + "/s3/aws4_request"
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+s.accessKey+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+s.signature(now, canonicalRequest))
+}
+
+func (s *S3Storage) signature(now time.Time, canonicalRequest string) string {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	scope := date + "/" + s.region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+s.secretKey), date)
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+// canonicalQuery - query string в виде, который требует SigV4: параметры
+// отсортированы, пробел кодируется как %20
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		for _, v := range query[k] {
+			parts = append(parts, uriEncode(k)+"="+uriEncode(v))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+func uriEncode(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
+
+// s3Error - ошибка с кодом и сообщением из XML ответа S3
+func s3Error(resp *http.Response) error {
+	var body struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	detail, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if xml.Unmarshal(detail, &body) == nil && body.Code != "" {
+		return fmt.Errorf("S3 returned %d %s: %s", resp.StatusCode, body.Code, body.Message)
+	}
+	return fmt.Errorf("S3 returned %d", resp.StatusCode)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,62 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrNotFound - объекта с таким ключом нет
+	ErrNotFound = errors.New("object not found")
+	// ErrPresignNotSupported - бэкенд не выдает прямые ссылки, объект отдает сервис
+	ErrPresignNotSupported = errors.New("presigned URLs are not supported")
+	// ErrInvalidKey - ключ вне допустимого алфавита или с выходом из каталога
+	ErrInvalidKey = errors.New("invalid object key")
+)
+
+// Object - объект в хранилище
+type Object struct {
+	Key     string    `json:"key"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+// Storage хранит загруженные файлы: локальный каталог для одного инстанса
+// или S3-совместимое хранилище, общее для всех реплик. Ключи вида
+// "avatars/<имя>" из латиницы, цифр, '_', '-' и '.'.
+type Storage interface {
+	// Put записывает объект целиком, существующий перезаписывается
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	// Open открывает объект на чтение; ErrNotFound, если его нет
+	Open(ctx context.Context, key string) (io.ReadCloser, *Object, error)
+	// Delete удаляет объект; отсутствие объекта не ошибка
+	Delete(ctx context.Context, key string) error
+	// List возвращает объекты, ключи которых начинаются с prefix
+	List(ctx context.Context, prefix string) ([]Object, error)
+	// PresignGet - временная ссылка на скачивание объекта напрямую из хранилища;
+	// ErrPresignNotSupported, если объект нужно отдавать через Open
+	PresignGet(ctx context.Context, key string) (string, error)
+	// Ping проверяет доступность хранилища для readiness
+	Ping(ctx context.Context) error
+}
+
+// ValidKey проверяет ключ: непустые сегменты через '/', без "." и ".."
+func ValidKey(key string) bool {
+	if key == "" {
+		return false
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return false
+		}
+		for _, r := range segment {
+			if !((r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '_' || r == '-' || r == '.') {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,60 @@
+package store
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// cleanupBatchSize - строк за один DELETE, чтобы не держать долгие блокировки
+const cleanupBatchSize = 5000
+
+// CleanupRepo удаляет истекшие данные для фоновых задач
+type CleanupRepo struct {
+	db *pgxpool.Pool
+}
+
+func NewCleanupRepo(db *pgxpool.Pool) *CleanupRepo {
+	return &CleanupRepo{db: db}
+}
+
+// DeleteExpiredVerifyTokens - токены подтверждения email с истекшим TTL
+func (r *CleanupRepo) DeleteExpiredVerifyTokens(ctx context.Context) (int64, error) {
+	return r.deleteInBatches(ctx, "email_verify_tokens", `expires_at < NOW()`)
+}
+
+// DeleteExpiredResetTokens - токены сброса пароля с истекшим TTL
+func (r *CleanupRepo) DeleteExpiredResetTokens(ctx context.Context) (int64, error) {
+	return r.deleteInBatches(ctx, "password_reset_tokens", `expires_at < NOW()`)
+}
+
+// DeleteStaleRefreshTokens - истекшие refresh токены и отозванные раньше
+// retention (до этого они видны в hubigrctl session list -all)
+func (r *CleanupRepo) DeleteStaleRefreshTokens(ctx context.Context, retention time.Duration) (int64, error) {
+	return r.deleteInBatches(ctx, "refresh_tokens", `expires_at < NOW() OR revoked_at < $1`, time.Now().Add(-retention))
+}
+
+// DeleteExpiredACLEntries - истекшие записи allow/deny списка rate limiting
+func (r *CleanupRepo) DeleteExpiredACLEntries(ctx context.Context) (int64, error) {
+	return r.deleteInBatches(ctx, "rate_limit_acl", `expires_at < NOW()`)
+}
+
+// deleteInBatches удаляет строки table по условию where пачками по cleanupBatchSize
+func (r *CleanupRepo) deleteInBatches(ctx context.Context, table, where string, args ...any) (int64, error) {
+	var total int64
+	for {
+		tag, err := r.db.Exec(ctx, `
+			DELETE FROM `+table+` WHERE ctid IN (
+				SELECT ctid FROM `+table+` WHERE `+where+` LIMIT `+strconv.Itoa(cleanupBatchSize)+`
+			)`, args...)
+		if err != nil {
+			return total, err
+		}
+		total += tag.RowsAffected()
+		if tag.RowsAffected() < cleanupBatchSize {
+			return total, nil
+		}
+	}
+}
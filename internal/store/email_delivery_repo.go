@@ -0,0 +1,159 @@
+package store
+
+import (
+	"context"
+
+	"github.com/RESERPIX/hubigr/internal/domain"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// recentDeliveryEvents - сколько последних событий доставки показываем в админке
+const recentDeliveryEvents = 10
+
+type EmailDeliveryRepo struct {
+	db *pgxpool.Pool
+}
+
+func NewEmailDeliveryRepo(db *pgxpool.Pool) *EmailDeliveryRepo {
+	return &EmailDeliveryRepo{db: db}
+}
+
+// RecordEvent сохраняет bounce/complaint и обновляет статус пользователя с этим адресом.
+// Жалоба и hard bounce сразу подавляют адрес, soft bounce - после SoftBounceLimit
+// событий за SoftBounceWindowDays. Возвращает true, если адрес подавлен.
+func (r *EmailDeliveryRepo) RecordEvent(ctx context.Context, ev domain.DeliveryEvent) (bool, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO email_delivery_events (email, type, bounce_type, detail, source)
+		VALUES ($1, $2, $3, NULLIF($4, ''), $5)`,
+		ev.Email, ev.Type, ev.BounceType, ev.Detail, ev.Source)
+	if err != nil {
+		return false, err
+	}
+
+	var status domain.EmailDeliveryStatus
+	var reason domain.DeliveryEventType
+	switch {
+	case ev.Type == domain.DeliveryEventComplaint:
+		status, reason = domain.EmailDeliveryComplained, domain.DeliveryEventComplaint
+	case ev.BounceType != nil && *ev.BounceType == domain.BounceHard:
+		status, reason = domain.EmailDeliveryBounced, domain.DeliveryEventBounce
+	default:
+		var softBounces int
+		err = tx.QueryRow(ctx, `
+			SELECT COUNT(*) FROM email_delivery_events
+			WHERE email = $1 AND type = 'bounce' AND bounce_type = 'soft'
+			  AND created_at > NOW() - make_interval(days => $2)`,
+			ev.Email, domain.SoftBounceWindowDays).Scan(&softBounces)
+		if err != nil {
+			return false, err
+		}
+		status = domain.EmailDeliverySoftBounce
+		if softBounces >= domain.SoftBounceLimit {
+			status, reason = domain.EmailDeliveryBounced, domain.DeliveryEventBounce
+		}
+	}
+
+	if reason != "" {
+		_, err = tx.Exec(ctx, `
+			INSERT INTO email_suppressions (email, reason, detail) VALUES ($1, $2, NULLIF($3, ''))
+			ON CONFLICT (email) DO NOTHING`, ev.Email, reason, ev.Detail)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	// soft bounce не понижает уже более серьезный статус
+	_, err = tx.Exec(ctx, `
+		UPDATE users SET email_status = $2, email_status_at = NOW()
+		WHERE email = $1
+		  AND ($2 <> 'soft_bounce' OR email_status IN ('ok', 'soft_bounce'))`,
+		ev.Email, status)
+	if err != nil {
+		return false, err
+	}
+
+	return reason != "", tx.Commit(ctx)
+}
+
+// IsSuppressed проверяет, подавлен ли адрес
+func (r *EmailDeliveryRepo) IsSuppressed(ctx context.Context, email string) (bool, error) {
+	var suppressed bool
+	err := r.db.QueryRow(ctx, `
+		SELECT EXISTS (SELECT 1 FROM email_suppressions WHERE email = $1)`, email).Scan(&suppressed)
+	return suppressed, err
+}
+
+// RemoveSuppression снимает подавление адреса пользователя (например, после
+// исправления ящика) и сбрасывает статус доставки
+func (r *EmailDeliveryRepo) RemoveSuppression(ctx context.Context, userID int64) (bool, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+
+	var email string
+	err = tx.QueryRow(ctx, `
+		UPDATE users SET email_status = 'ok', email_status_at = NOW()
+		WHERE id = $1
+		RETURNING email`, userID).Scan(&email)
+	if err != nil {
+		return false, err
+	}
+
+	result, err := tx.Exec(ctx, `DELETE FROM email_suppressions WHERE email = $1`, email)
+	if err != nil {
+		return false, err
+	}
+	return result.RowsAffected() > 0, tx.Commit(ctx)
+}
+
+// GetDeliveryInfo - статус доставки, подавление и последние события для админки
+func (r *EmailDeliveryRepo) GetDeliveryInfo(ctx context.Context, userID int64) (*domain.EmailDeliveryInfo, error) {
+	info := domain.EmailDeliveryInfo{RecentEvents: []domain.DeliveryEvent{}}
+	var email string
+	err := r.db.QueryRow(ctx, `
+		SELECT email, email_status, email_status_at FROM users WHERE id = $1`, userID).
+		Scan(&email, &info.Status, &info.StatusAt)
+	if err != nil {
+		return nil, err
+	}
+
+	var s domain.EmailSuppression
+	err = r.db.QueryRow(ctx, `
+		SELECT reason, detail, created_at FROM email_suppressions WHERE email = $1`, email).
+		Scan(&s.Reason, &s.Detail, &s.CreatedAt)
+	switch {
+	case err == nil:
+		info.Suppression = &s
+	case err != pgx.ErrNoRows:
+		return nil, err
+	}
+
+	rows, err := r.db.Query(ctx, `
+		SELECT id, type, email, bounce_type, COALESCE(detail, ''), source, created_at
+		FROM email_delivery_events
+		WHERE email = $1
+		ORDER BY created_at DESC, id DESC
+		LIMIT $2`, email, recentDeliveryEvents)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var ev domain.DeliveryEvent
+		if err := rows.Scan(&ev.ID, &ev.Type, &ev.Email, &ev.BounceType, &ev.Detail, &ev.Source, &ev.CreatedAt); err != nil {
+			return nil, err
+		}
+		info.RecentEvents = append(info.RecentEvents, ev)
+	}
+	return &info, rows.Err()
+}
@@ -0,0 +1,295 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/RESERPIX/hubigr/internal/domain"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// outboxLease - сколько письмо считается взятым воркером; после истечения его заберет другой инстанс
+const outboxLease = 5 * time.Minute
+
+var (
+	// ErrOutboxTokenExpired - токен в письме заменен новым или истек, отправлять письмо бессмысленно
+	ErrOutboxTokenExpired = errors.New("email token superseded or expired")
+	// ErrOutboxClaimLost - письмо уже не за этим воркером: его отменили или после
+	// истечения аренды забрал другой воркер, результат отправки не записывается
+	ErrOutboxClaimLost = errors.New("outbox email claim lost")
+)
+
+// outboxClaimed - условие, что письмо $1 все еще взято воркером, получившим его
+// с attempts = $2: Claim увеличивает attempts при каждом захвате
+const outboxClaimed = `id = $1 AND status = 'sending' AND attempts = $2`
+
+// outboxTokenValid - условие на строку email_outbox: токен из письма подтверждения
+// или сброса пароля еще действует. У писем без токена всегда true.
+const outboxTokenValid = `CASE kind
+	WHEN 'verification' THEN EXISTS (
+		SELECT 1 FROM email_verify_tokens t WHERE t.token = payload->>'token' AND t.expires_at > NOW())
+	WHEN 'password_reset' THEN EXISTS (
+		SELECT 1 FROM password_reset_tokens t WHERE t.token = payload->>'token' AND t.expires_at > NOW())
+	ELSE true
+END`
+
+// execer - общее у pgxpool.Pool и pgx.Tx, чтобы писать в outbox в транзакции вызывающего
+type execer interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+}
+
+// enqueueEmail ставит письмо в outbox. Вызывается в той же транзакции, что и создание токена,
+// поэтому письмо не потеряется и не уйдет для откатившегося токена.
+func enqueueEmail(ctx context.Context, q execer, kind domain.EmailKind, recipient string, payload any) error {
+	payloadJSON, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	_, err = q.Exec(ctx, `
+		INSERT INTO email_outbox (kind, recipient, payload) VALUES ($1, $2, $3)`,
+		kind, recipient, payloadJSON)
+	return err
+}
+
+// cancelPendingEmails отменяет неотправленные письма этого типа получателю: новый
+// токен заменяет прежний, и старые письма со ссылкой на него уже не нужны.
+// Письмо, которое воркер отправляет прямо сейчас, не трогаем: перед повтором
+// его токен проверит воркер.
+func cancelPendingEmails(ctx context.Context, q execer, kind domain.EmailKind, recipient string) error {
+	_, err := q.Exec(ctx, `
+		UPDATE email_outbox SET
+			status = 'cancelled', locked_until = NULL, payload = '{}'::jsonb
+		WHERE kind = $1 AND recipient = $2
+		  AND (status IN ('pending', 'dead') OR (status = 'sending' AND locked_until < NOW()))`,
+		kind, recipient)
+	return err
+}
+
+type EmailOutboxRepo struct {
+	db *pgxpool.Pool
+}
+
+func NewEmailOutboxRepo(db *pgxpool.Pool) *EmailOutboxRepo {
+	return &EmailOutboxRepo{db: db}
+}
+
+// Claim забирает до limit писем, готовых к отправке, и продлевает их аренду.
+// SKIP LOCKED позволяет нескольким инстансам разбирать очередь параллельно.
+func (r *EmailOutboxRepo) Claim(ctx context.Context, limit int) ([]domain.OutboxEmail, error) {
+	rows, err := r.db.Query(ctx, `
+		UPDATE email_outbox SET
+			status = 'sending',
+			attempts = attempts + 1,
+			locked_until = NOW() + make_interval(secs => $2)
+		WHERE id IN (
+			SELECT id FROM email_outbox
+			WHERE (status = 'pending' AND next_attempt_at <= NOW())
+			   OR (status = 'sending' AND locked_until < NOW())
+			ORDER BY next_attempt_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+outboxColumns, limit, outboxLease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanOutboxEmails(rows)
+}
+
+// MarkSent фиксирует успешную отправку и очищает payload с токенами
+func (r *EmailOutboxRepo) MarkSent(ctx context.Context, id int64, attempt int) error {
+	return r.markClaimed(ctx, `
+		UPDATE email_outbox SET
+			status = 'sent', sent_at = NOW(), locked_until = NULL, last_error = NULL, payload = '{}'::jsonb
+		WHERE `+outboxClaimed, id, attempt)
+}
+
+// MarkSuppressed фиксирует, что письмо не отправлено из-за подавления адреса
+func (r *EmailOutboxRepo) MarkSuppressed(ctx context.Context, id int64, attempt int) error {
+	return r.markClaimed(ctx, `
+		UPDATE email_outbox SET
+			status = 'suppressed', locked_until = NULL, last_error = NULL, payload = '{}'::jsonb
+		WHERE `+outboxClaimed, id, attempt)
+}
+
+// MarkCancelled фиксирует, что письмо не отправлено: токен в нем больше не действует
+func (r *EmailOutboxRepo) MarkCancelled(ctx context.Context, id int64, attempt int) error {
+	return r.markClaimed(ctx, `
+		UPDATE email_outbox SET
+			status = 'cancelled', locked_until = NULL, payload = '{}'::jsonb
+		WHERE `+outboxClaimed, id, attempt)
+}
+
+// markClaimed выполняет обновление письма, взятого воркером; ErrOutboxClaimLost,
+// если письмо за ним уже не числится
+func (r *EmailOutboxRepo) markClaimed(ctx context.Context, sql string, id int64, attempt int) error {
+	result, err := r.db.Exec(ctx, sql, id, attempt)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return ErrOutboxClaimLost
+	}
+	return nil
+}
+
+// TokenValid проверяет, что токен из письма не заменен новым и не истек
+func (r *EmailOutboxRepo) TokenValid(ctx context.Context, id int64) (bool, error) {
+	var valid bool
+	err := r.db.QueryRow(ctx, `SELECT `+outboxTokenValid+` FROM email_outbox WHERE id = $1`, id).Scan(&valid)
+	return valid, err
+}
+
+// MarkFailed возвращает письмо в очередь на nextAttempt либо переводит в dead,
+// если попытки исчерпаны. Все Mark* меняют письмо, только пока оно за воркером.
+func (r *EmailOutboxRepo) MarkFailed(ctx context.Context, id int64, attempt int, lastError string, nextAttempt time.Time) (domain.EmailStatus, error) {
+	var status domain.EmailStatus
+	err := r.db.QueryRow(ctx, `
+		UPDATE email_outbox SET
+			status = CASE WHEN attempts >= max_attempts THEN 'dead' ELSE 'pending' END,
+			next_attempt_at = $4,
+			locked_until = NULL,
+			last_error = $3
+		WHERE `+outboxClaimed+`
+		RETURNING status`, id, attempt, lastError, nextAttempt).Scan(&status)
+	if err == pgx.ErrNoRows {
+		return "", ErrOutboxClaimLost
+	}
+	return status, err
+}
+
+// List - письма для админки, опционально по статусу
+func (r *EmailOutboxRepo) List(ctx context.Context, status domain.EmailStatus, limit, offset int) ([]domain.OutboxEmail, int, error) {
+	var total int
+	err := r.db.QueryRow(ctx, `
+		SELECT COUNT(*) FROM email_outbox WHERE ($1 = '' OR status = $1)`, status).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := r.db.Query(ctx, `
+		SELECT `+outboxColumns+`
+		FROM email_outbox
+		WHERE ($1 = '' OR status = $1)
+		ORDER BY created_at DESC, id DESC
+		LIMIT $2 OFFSET $3`, status, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	emails, err := scanOutboxEmails(rows)
+	if err != nil {
+		return nil, 0, err
+	}
+	return emails, total, nil
+}
+
+// GetByID - письмо для админки
+func (r *EmailOutboxRepo) GetByID(ctx context.Context, id int64) (*domain.OutboxEmail, error) {
+	rows, err := r.db.Query(ctx, `SELECT `+outboxColumns+` FROM email_outbox WHERE id = $1`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	emails, err := scanOutboxEmails(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(emails) == 0 {
+		return nil, pgx.ErrNoRows
+	}
+	return &emails[0], nil
+}
+
+// Retry возвращает неотправленное письмо в очередь с новым набором попыток.
+// Письмо с токеном, который заменен новым или истек, вместо этого отменяется:
+// ErrOutboxTokenExpired.
+func (r *EmailOutboxRepo) Retry(ctx context.Context, id int64) (bool, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+
+	var tokenValid bool
+	err = tx.QueryRow(ctx, `
+		SELECT `+outboxTokenValid+` FROM email_outbox
+		WHERE id = $1 AND status IN ('dead', 'pending')
+		FOR UPDATE`, id).Scan(&tokenValid)
+	if err == pgx.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if !tokenValid {
+		if _, err := tx.Exec(ctx, `
+			UPDATE email_outbox SET
+				status = 'cancelled', locked_until = NULL, payload = '{}'::jsonb
+			WHERE id = $1`, id); err != nil {
+			return false, err
+		}
+		if err := tx.Commit(ctx); err != nil {
+			return false, err
+		}
+		return false, ErrOutboxTokenExpired
+	}
+
+	if _, err := tx.Exec(ctx, `
+		UPDATE email_outbox SET
+			status = 'pending', attempts = 0, next_attempt_at = NOW(), locked_until = NULL
+		WHERE id = $1`, id); err != nil {
+		return false, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// CountByStatus - размер очереди по статусам для мониторинга
+func (r *EmailOutboxRepo) CountByStatus(ctx context.Context) (map[domain.EmailStatus]int64, error) {
+	rows, err := r.db.Query(ctx, `SELECT status, COUNT(*) FROM email_outbox GROUP BY status`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := map[domain.EmailStatus]int64{}
+	for rows.Next() {
+		var status domain.EmailStatus
+		var count int64
+		if err := rows.Scan(&status, &count); err != nil {
+			return nil, err
+		}
+		counts[status] = count
+	}
+	return counts, rows.Err()
+}
+
+const outboxColumns = `id, kind, recipient, status, attempts, max_attempts, next_attempt_at,
+	last_error, created_at, sent_at, payload`
+
+func scanOutboxEmails(rows pgx.Rows) ([]domain.OutboxEmail, error) {
+	emails := []domain.OutboxEmail{}
+	for rows.Next() {
+		var e domain.OutboxEmail
+		var payload []byte
+		if err := rows.Scan(&e.ID, &e.Kind, &e.Recipient, &e.Status, &e.Attempts, &e.MaxAttempts,
+			&e.NextAttemptAt, &e.LastError, &e.CreatedAt, &e.SentAt, &payload); err != nil {
+			return nil, err
+		}
+		e.Payload = payload
+		emails = append(emails, e)
+	}
+	return emails, rows.Err()
+}
@@ -0,0 +1,269 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/RESERPIX/hubigr/internal/domain"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// DigestBatchSize - максимум событий, попадающих в одно письмо-дайджест
+const DigestBatchSize = 50
+
+type NotificationRepo struct {
+	db *pgxpool.Pool
+}
+
+func NewNotificationRepo(db *pgxpool.Pool) *NotificationRepo {
+	return &NotificationRepo{db: db}
+}
+
+// DigestRecipient - пользователь, которому пора отправить дайджест
+type DigestRecipient struct {
+	UserID    int64
+	Email     string
+	Frequency domain.DigestFrequency
+	Locale    string
+}
+
+// Publish сохраняет событие тем пользователям, чьи настройки разрешают этот тип
+// и хотя бы один канал: in-app (входящие) или email (дайджест). Пользователи без
+// строки notification_settings получают дефолтные настройки (все типы, только in-app).
+// Типы из channels.email_opt_out не попадают в дайджест, но остаются во входящих.
+// Возвращает сохраненные уведомления.
+func (r *NotificationRepo) Publish(ctx context.Context, req domain.PublishNotificationRequest) ([]domain.Notification, error) {
+	payload := req.Payload
+	if len(payload) == 0 {
+		payload = json.RawMessage(`{}`)
+	}
+
+	rows, err := r.db.Query(ctx, `
+		WITH targets AS (
+			SELECT u.id,
+			       COALESCE((ns.channels->>'in_app')::boolean, true) AS in_app,
+			       COALESCE((ns.channels->>'email')::boolean, false) AND u.email_verified
+			         AND NOT COALESCE(ns.channels->'email_opt_out' ? $2, false) AS email
+			FROM users u
+			LEFT JOIN notification_settings ns ON ns.user_id = u.id
+			WHERE u.id = ANY($1)
+			  AND NOT u.is_banned
+			  AND CASE $2
+			        WHEN 'new_game' THEN COALESCE(ns.new_game, true)
+			        WHEN 'new_build' THEN COALESCE(ns.new_build, true)
+			        WHEN 'new_post' THEN COALESCE(ns.new_post, true)
+			        ELSE false
+			      END
+		)
+		INSERT INTO notifications (user_id, type, title, body, link, payload, in_app, digest_pending)
+		SELECT id, $2, $3, $4, $5, $6, in_app, email
+		FROM targets
+		WHERE in_app OR email
+		RETURNING id, user_id, type, title, body, link, payload, created_at, read_at, in_app`,
+		req.UserIDs, req.Type, req.Title, req.Body, req.Link, payload)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanNotifications(rows)
+}
+
+// List возвращает уведомления пользователя, новые первыми
+func (r *NotificationRepo) List(ctx context.Context, userID int64, unreadOnly bool, limit, offset int) ([]domain.Notification, int, error) {
+	var total int
+	err := r.db.QueryRow(ctx, `
+		SELECT COUNT(*) FROM notifications
+		WHERE user_id = $1 AND in_app AND ($2 = false OR read_at IS NULL)`, userID, unreadOnly).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := r.db.Query(ctx, `
+		SELECT id, user_id, type, title, body, link, payload, created_at, read_at, in_app
+		FROM notifications
+		WHERE user_id = $1 AND in_app AND ($2 = false OR read_at IS NULL)
+		ORDER BY created_at DESC, id DESC
+		LIMIT $3 OFFSET $4`, userID, unreadOnly, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	notifications, err := scanNotifications(rows)
+	if err != nil {
+		return nil, 0, err
+	}
+	return notifications, total, nil
+}
+
+// ListAfter возвращает уведомления с ID больше afterID в порядке создания (догрузка по Last-Event-ID)
+func (r *NotificationRepo) ListAfter(ctx context.Context, userID, afterID int64, limit int) ([]domain.Notification, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT id, user_id, type, title, body, link, payload, created_at, read_at, in_app
+		FROM notifications
+		WHERE user_id = $1 AND in_app AND id > $2
+		ORDER BY id ASC
+		LIMIT $3`, userID, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanNotifications(rows)
+}
+
+// LatestID - ID последнего уведомления во входящих пользователя, 0 если их нет
+func (r *NotificationRepo) LatestID(ctx context.Context, userID int64) (int64, error) {
+	var id int64
+	err := r.db.QueryRow(ctx, `
+		SELECT COALESCE(MAX(id), 0) FROM notifications WHERE user_id = $1 AND in_app`, userID).Scan(&id)
+	return id, err
+}
+
+// CountUnread возвращает количество непрочитанных уведомлений
+func (r *NotificationRepo) CountUnread(ctx context.Context, userID int64) (int, error) {
+	var count int
+	err := r.db.QueryRow(ctx, `
+		SELECT COUNT(*) FROM notifications WHERE user_id = $1 AND in_app AND read_at IS NULL`, userID).Scan(&count)
+	return count, err
+}
+
+// MarkRead отмечает уведомления прочитанными, чужие ID игнорируются
+func (r *NotificationRepo) MarkRead(ctx context.Context, userID int64, ids []int64) (int64, error) {
+	result, err := r.db.Exec(ctx, `
+		UPDATE notifications SET read_at = NOW()
+		WHERE user_id = $1 AND id = ANY($2) AND in_app AND read_at IS NULL`, userID, ids)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+// MarkAllRead отмечает прочитанными все уведомления пользователя
+func (r *NotificationRepo) MarkAllRead(ctx context.Context, userID int64) (int64, error) {
+	result, err := r.db.Exec(ctx, `
+		UPDATE notifications SET read_at = NOW()
+		WHERE user_id = $1 AND in_app AND read_at IS NULL`, userID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+// ProcessDueDigest берет одного пользователя, которому пора отправить дайджест,
+// собирает письмо через build и ставит его в outbox в той же транзакции, что и
+// снятие событий с очереди. Строка настроек блокируется (SKIP LOCKED), поэтому
+// несколько инстансов не соберут дайджест дважды. Возвращает false, если получателей больше нет.
+func (r *NotificationRepo) ProcessDueDigest(ctx context.Context, build func(DigestRecipient, []domain.Notification, int) any) (bool, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+
+	var rcpt DigestRecipient
+	err = tx.QueryRow(ctx, `
+		SELECT ns.user_id, u.email, ns.email_digest, u.locale
+		FROM notification_settings ns
+		JOIN users u ON u.id = ns.user_id
+		WHERE COALESCE((ns.channels->>'email')::boolean, false)
+		  AND u.email_verified AND NOT u.is_banned
+		  AND (ns.last_digest_at IS NULL OR ns.last_digest_at <= NOW() -
+		       CASE ns.email_digest WHEN 'weekly' THEN INTERVAL '7 days' ELSE INTERVAL '1 day' END)
+		  AND EXISTS (SELECT 1 FROM notifications n WHERE n.user_id = ns.user_id AND n.digest_pending)
+		ORDER BY ns.last_digest_at NULLS FIRST
+		LIMIT 1
+		FOR UPDATE OF ns SKIP LOCKED`).Scan(&rcpt.UserID, &rcpt.Email, &rcpt.Frequency, &rcpt.Locale)
+	if err == pgx.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	// Фиксируем границу очереди, чтобы не снять события, пришедшие во время отправки
+	var maxID int64
+	if err := tx.QueryRow(ctx, `
+		SELECT COALESCE(MAX(id), 0) FROM notifications WHERE user_id = $1 AND digest_pending`,
+		rcpt.UserID).Scan(&maxID); err != nil {
+		return false, err
+	}
+
+	// Учитываем текущие настройки: от типа могли отписаться после постановки в очередь
+	var total int
+	if err := tx.QueryRow(ctx, `
+		SELECT COUNT(*) FROM notifications n
+		JOIN notification_settings ns ON ns.user_id = n.user_id
+		WHERE n.user_id = $1 AND n.digest_pending AND n.id <= $2
+		  AND CASE n.type
+		        WHEN 'new_game' THEN ns.new_game
+		        WHEN 'new_build' THEN ns.new_build
+		        WHEN 'new_post' THEN ns.new_post
+		        ELSE false
+		      END
+		  AND NOT COALESCE(ns.channels->'email_opt_out' ? n.type, false)`, rcpt.UserID, maxID).Scan(&total); err != nil {
+		return false, err
+	}
+
+	if total > 0 {
+		rows, err := tx.Query(ctx, `
+			SELECT n.id, n.user_id, n.type, n.title, n.body, n.link, n.payload, n.created_at, n.read_at, n.in_app
+			FROM notifications n
+			JOIN notification_settings ns ON ns.user_id = n.user_id
+			WHERE n.user_id = $1 AND n.digest_pending AND n.id <= $2
+			  AND CASE n.type
+			        WHEN 'new_game' THEN ns.new_game
+			        WHEN 'new_build' THEN ns.new_build
+			        WHEN 'new_post' THEN ns.new_post
+			        ELSE false
+			      END
+			  AND NOT COALESCE(ns.channels->'email_opt_out' ? n.type, false)
+			ORDER BY n.id DESC
+			LIMIT $3`, rcpt.UserID, maxID, DigestBatchSize)
+		if err != nil {
+			return false, err
+		}
+		items, err := scanNotifications(rows)
+		rows.Close()
+		if err != nil {
+			return false, err
+		}
+
+		if err := enqueueEmail(ctx, tx, domain.EmailKindDigest, rcpt.Email, build(rcpt, items, total)); err != nil {
+			return false, err
+		}
+
+		if _, err := tx.Exec(ctx, `
+			UPDATE notification_settings SET last_digest_at = NOW() WHERE user_id = $1`, rcpt.UserID); err != nil {
+			return false, err
+		}
+	}
+
+	if _, err := tx.Exec(ctx, `
+		UPDATE notifications SET digest_pending = false
+		WHERE user_id = $1 AND digest_pending AND id <= $2`, rcpt.UserID, maxID); err != nil {
+		return false, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func scanNotifications(rows pgx.Rows) ([]domain.Notification, error) {
+	notifications := []domain.Notification{}
+	for rows.Next() {
+		var n domain.Notification
+		var payload []byte
+		if err := rows.Scan(&n.ID, &n.UserID, &n.Type, &n.Title, &n.Body, &n.Link,
+			&payload, &n.CreatedAt, &n.ReadAt, &n.InApp); err != nil {
+			return nil, err
+		}
+		n.Payload = payload
+		notifications = append(notifications, n)
+	}
+	return notifications, rows.Err()
+}
@@ -0,0 +1,78 @@
+package store
+
+import (
+	"context"
+
+	"github.com/RESERPIX/hubigr/internal/domain"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type RateLimitACLRepo struct {
+	db *pgxpool.Pool
+}
+
+func NewRateLimitACLRepo(db *pgxpool.Pool) *RateLimitACLRepo {
+	return &RateLimitACLRepo{db: db}
+}
+
+const aclColumns = `id, cidr::text, action, comment, created_by, created_at, expires_at`
+
+// List возвращает все записи, включая истекшие
+func (r *RateLimitACLRepo) List(ctx context.Context) ([]domain.RateLimitACLEntry, error) {
+	return r.query(ctx, `SELECT `+aclColumns+` FROM rate_limit_acl ORDER BY action, cidr`)
+}
+
+// ListActive возвращает неистекшие записи для middleware
+func (r *RateLimitACLRepo) ListActive(ctx context.Context) ([]domain.RateLimitACLEntry, error) {
+	return r.query(ctx, `
+		SELECT `+aclColumns+` FROM rate_limit_acl
+		WHERE expires_at IS NULL OR expires_at > NOW()`)
+}
+
+func (r *RateLimitACLRepo) query(ctx context.Context, sql string) ([]domain.RateLimitACLEntry, error) {
+	rows, err := r.db.Query(ctx, sql)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []domain.RateLimitACLEntry{}
+	for rows.Next() {
+		var e domain.RateLimitACLEntry
+		if err := rows.Scan(&e.ID, &e.CIDR, &e.Action, &e.Comment, &e.CreatedBy, &e.CreatedAt, &e.ExpiresAt); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// Upsert добавляет подсеть или заменяет действие и срок уже добавленной
+func (r *RateLimitACLRepo) Upsert(ctx context.Context, req domain.RateLimitACLRequest, adminID int64) (*domain.RateLimitACLEntry, error) {
+	var e domain.RateLimitACLEntry
+	err := r.db.QueryRow(ctx, `
+		INSERT INTO rate_limit_acl (cidr, action, comment, created_by, expires_at)
+		VALUES ($1::cidr, $2, NULLIF($3, ''), $4, $5)
+		ON CONFLICT (cidr) DO UPDATE SET
+			action = EXCLUDED.action,
+			comment = EXCLUDED.comment,
+			created_by = EXCLUDED.created_by,
+			created_at = NOW(),
+			expires_at = EXCLUDED.expires_at
+		RETURNING `+aclColumns,
+		req.CIDR, req.Action, req.Comment, adminID, req.ExpiresAt,
+	).Scan(&e.ID, &e.CIDR, &e.Action, &e.Comment, &e.CreatedBy, &e.CreatedAt, &e.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// Delete удаляет запись; false - записи не было
+func (r *RateLimitACLRepo) Delete(ctx context.Context, id int64) (bool, error) {
+	tag, err := r.db.Exec(ctx, `DELETE FROM rate_limit_acl WHERE id = $1`, id)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
@@ -5,7 +5,9 @@ import (
 	"time"
 
 	"github.com/RESERPIX/hubigr/internal/domain"
+	"github.com/RESERPIX/hubigr/internal/logger"
 	"github.com/RESERPIX/hubigr/internal/security"
+	"github.com/RESERPIX/hubigr/internal/tracing"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
@@ -24,7 +26,7 @@ func (r *RefreshTokenRepo) Create(ctx context.Context, userID int64, deviceInfo,
 		return "", err
 	}
 
-	hash, err := security.HashRefreshToken(token)
+	hash, err := hashRefreshToken(ctx, token)
 	if err != nil {
 		return "", err
 	}
@@ -48,11 +50,12 @@ func (r *RefreshTokenRepo) ValidateAndRotate(ctx context.Context, token string)
 	defer func() {
 		if rollbackErr := tx.Rollback(ctx); rollbackErr != nil && rollbackErr != pgx.ErrTxClosed {
 			// Логируем ошибку rollback, но не возвращаем её
+			logger.WarnContext(ctx, "Failed to rollback refresh token rotation", "error", rollbackErr)
 		}
 	}()
 
 	// Хешируем токен для поиска по индексу
-	tokenHash, err := security.HashRefreshToken(token)
+	tokenHash, err := hashRefreshToken(ctx, token)
 	if err != nil {
 		return nil, "", err
 	}
@@ -72,7 +75,7 @@ func (r *RefreshTokenRepo) ValidateAndRotate(ctx context.Context, token string)
 	}
 
 	// Проверяем токен
-	if !security.VerifyRefreshToken(rt.TokenHash, token) {
+	if !verifyRefreshToken(ctx, rt.TokenHash, token) {
 		return nil, "", pgx.ErrNoRows
 	}
 
@@ -103,7 +106,7 @@ func (r *RefreshTokenRepo) createInTx(ctx context.Context, tx pgx.Tx, userID int
 		return "", err
 	}
 
-	hash, err := security.HashRefreshToken(token)
+	hash, err := hashRefreshToken(ctx, token)
 	if err != nil {
 		return "", err
 	}
@@ -121,4 +124,51 @@ func (r *RefreshTokenRepo) createInTx(ctx context.Context, tx pgx.Tx, userID int
 func (r *RefreshTokenRepo) RevokeUserTokens(ctx context.Context, userID int64) error {
 	_, err := r.db.Exec(ctx, `UPDATE refresh_tokens SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`, userID)
 	return err
-}
\ No newline at end of file
+}
+
+// ListUserTokens - сессии пользователя, новые первыми; без all только действующие
+func (r *RefreshTokenRepo) ListUserTokens(ctx context.Context, userID int64, all bool) ([]domain.RefreshToken, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT id, user_id, expires_at, created_at, revoked_at, device_info, host(ip_address)
+		FROM refresh_tokens
+		WHERE user_id = $1 AND ($2 OR (revoked_at IS NULL AND expires_at > NOW()))
+		ORDER BY created_at DESC, id DESC`, userID, all)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []domain.RefreshToken{}
+	for rows.Next() {
+		var t domain.RefreshToken
+		if err := rows.Scan(&t.ID, &t.UserID, &t.ExpiresAt, &t.CreatedAt, &t.RevokedAt, &t.DeviceInfo, &t.IPAddress); err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, rows.Err()
+}
+
+// RevokeToken отзывает одну сессию пользователя; false - сессии нет или она уже отозвана
+func (r *RefreshTokenRepo) RevokeToken(ctx context.Context, userID, tokenID int64) (bool, error) {
+	tag, err := r.db.Exec(ctx, `
+		UPDATE refresh_tokens SET revoked_at = NOW()
+		WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL`, tokenID, userID)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// hashRefreshToken - bcrypt заметно дольше запросов к БД, поэтому отдельный спан
+func hashRefreshToken(ctx context.Context, token string) (string, error) {
+	_, span := tracing.Start(ctx, "bcrypt.hash")
+	defer span.End()
+	return security.HashRefreshToken(token)
+}
+
+func verifyRefreshToken(ctx context.Context, hash, token string) bool {
+	_, span := tracing.Start(ctx, "bcrypt.compare")
+	defer span.End()
+	return security.VerifyRefreshToken(hash, token)
+}
@@ -3,12 +3,45 @@ package store
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"strings"
 	"time"
 
 	"github.com/RESERPIX/hubigr/internal/domain"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+var (
+	// ErrHandleTaken - хэндл занят другим пользователем (текущий или из истории)
+	ErrHandleTaken = errors.New("handle already taken")
+	// ErrHandleCooldown - хэндл менялся слишком недавно
+	ErrHandleCooldown = errors.New("handle change cooldown")
+	// ErrEmailTaken - пользователь с таким email уже зарегистрирован
+	ErrEmailTaken = errors.New("email already registered")
+)
+
+// Уникальные ограничения таблицы users
+const (
+	usersEmailConstraint  = "users_email_key"
+	usersHandleConstraint = "idx_users_handle"
+)
+
+// queryRower - общее у pgxpool.Pool и pgx.Tx для запросов с одной строкой результата
+type queryRower interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// uniqueViolation - имя уникального ограничения, которое нарушил запрос
+func uniqueViolation(err error) (string, bool) {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return pgErr.ConstraintName, true
+	}
+	return "", false
+}
+
 type UserRepo struct {
 	db *pgxpool.Pool
 }
@@ -17,14 +50,52 @@ func NewUserRepo(db *pgxpool.Pool) *UserRepo {
 	return &UserRepo{db: db}
 }
 
-// CreateUser - UC-1.1.1
+// CreateUser - UC-1.1.1. Занятые email и хэндл - ErrEmailTaken и ErrHandleTaken.
 func (r *UserRepo) CreateUser(ctx context.Context, req domain.SignUpRequest, hash string) (int64, error) {
+	return insertUser(ctx, r.db, req, hash, domain.RoleParticipant, false)
+}
+
+// ProvisionUser создает пользователя оператором (hubigrctl) одной транзакцией:
+// с ролью и либо с уже подтвержденным email, либо с токеном подтверждения и
+// письмом в outbox. При ошибке не остается полусозданного пользователя.
+func (r *UserRepo) ProvisionUser(ctx context.Context, req domain.SignUpRequest, hash string, role domain.Role, verified bool, verifyToken string) (int64, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	userID, err := insertUser(ctx, tx, req, hash, role, verified)
+	if err != nil {
+		return 0, err
+	}
+	if !verified {
+		if err := createVerifyToken(ctx, tx, userID, req.Email, verifyToken); err != nil {
+			return 0, err
+		}
+	}
+
+	return userID, tx.Commit(ctx)
+}
+
+func insertUser(ctx context.Context, q queryRower, req domain.SignUpRequest, hash string, role domain.Role, verified bool) (int64, error) {
 	var id int64
-	err := r.db.QueryRow(ctx, `
-		INSERT INTO users (email, hash, nick, role) 
-		VALUES (LOWER($1), $2, $3, $4) 
+	// Без явного хэндла выдаем user<id>, поэтому id берем из последовательности заранее
+	err := q.QueryRow(ctx, `
+		WITH next AS (SELECT nextval(pg_get_serial_sequence('users', 'id')) AS id)
+		INSERT INTO users (id, email, hash, nick, role, handle, locale, email_verified)
+		SELECT next.id, LOWER($1), $2, $3, $4, COALESCE(NULLIF($5, ''), 'user' || next.id), $6, $7
+		FROM next
 		RETURNING id`,
-		req.Email, hash, req.Nick, domain.RoleParticipant).Scan(&id)
+		req.Email, hash, req.Nick, role, req.Handle, domain.NormalizeLocale(req.Locale), verified).Scan(&id)
+	if constraint, ok := uniqueViolation(err); ok {
+		switch constraint {
+		case usersEmailConstraint:
+			return 0, ErrEmailTaken
+		case usersHandleConstraint:
+			return 0, ErrHandleTaken
+		}
+	}
 	return id, err
 }
 
@@ -35,11 +106,11 @@ func (r *UserRepo) GetByEmail(ctx context.Context, email string) (*domain.User,
 	var privacyJSON []byte
 
 	err := r.db.QueryRow(ctx, `
-		SELECT id, email, hash, role, nick, avatar, bio, links, is_banned, 
-		       email_verified, created_at, privacy_settings
+		SELECT id, email, hash, role, nick, handle, avatar, bio, links, is_banned, 
+		       email_verified, created_at, privacy_settings, locale
 		FROM users WHERE email = LOWER($1)`, email).Scan(
-		&u.ID, &u.Email, &u.Hash, &u.Role, &u.Nick, &u.Avatar, &u.Bio,
-		&linksJSON, &u.IsBanned, &u.EmailVerified, &u.CreatedAt, &privacyJSON)
+		&u.ID, &u.Email, &u.Hash, &u.Role, &u.Nick, &u.Handle, &u.Avatar, &u.Bio,
+		&linksJSON, &u.IsBanned, &u.EmailVerified, &u.CreatedAt, &privacyJSON, &u.Locale)
 
 	if err != nil {
 		return nil, err
@@ -51,17 +122,46 @@ func (r *UserRepo) GetByEmail(ctx context.Context, email string) (*domain.User,
 	if err := json.Unmarshal(privacyJSON, &u.PrivacySettings); err != nil {
 		u.PrivacySettings = domain.PrivacySettings{}
 	}
+	u.Avatars = domain.AvatarVariants(u.Avatar)
 	return &u, nil
 }
 
-// CreateVerifyToken - UC-1.1.1 (TTL 1 час)
-func (r *UserRepo) CreateVerifyToken(ctx context.Context, userID int64, token string) error {
-	_, err := r.db.Exec(ctx, `
+// CreateVerifyToken - UC-1.1.1 (TTL 1 час), письмо ставится в outbox в той же транзакции
+func (r *UserRepo) CreateVerifyToken(ctx context.Context, userID int64, email, token string) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := createVerifyToken(ctx, tx, userID, email, token); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func createVerifyToken(ctx context.Context, tx pgx.Tx, userID int64, email, token string) error {
+	_, err := tx.Exec(ctx, `
 		INSERT INTO email_verify_tokens (token, user_id, expires_at)
 		VALUES ($1, $2, NOW() + INTERVAL '1 hour')
 		ON CONFLICT (user_id) DO UPDATE SET token = $1, expires_at = NOW() + INTERVAL '1 hour'`,
 		token, userID)
-	return err
+	if err != nil {
+		return err
+	}
+
+	// Письмо рендерится на языке пользователя на момент запроса
+	var locale string
+	if err := tx.QueryRow(ctx, `SELECT locale FROM users WHERE id = $1`, userID).Scan(&locale); err != nil {
+		return err
+	}
+
+	// Письма с прежним токеном больше не нужны: ссылка в них перестала работать
+	if err := cancelPendingEmails(ctx, tx, domain.EmailKindVerification, email); err != nil {
+		return err
+	}
+	return enqueueEmail(ctx, tx, domain.EmailKindVerification, email, domain.TokenEmailPayload{Token: token, Locale: locale})
 }
 
 // VerifyEmail - UC-1.1.1
@@ -97,11 +197,14 @@ func (r *UserRepo) UpdateProfile(ctx context.Context, userID int64, req domain.U
 		return err2
 	}
 
+	// Без avatar аватар не меняется, пустая строка удаляет его
 	_, err3 := r.db.Exec(ctx, `
 		UPDATE users 
-		SET nick = $2, avatar = $3, bio = $4, links = $5, privacy_settings = $6
+		SET nick = $2, avatar = CASE WHEN $3::text IS NULL THEN avatar ELSE NULLIF($3, '') END,
+		    bio = $4, links = $5, privacy_settings = $6,
+		    locale = COALESCE($7, locale)
 		WHERE id = $1`,
-		userID, req.Nick, req.Avatar, req.Bio, linksJSON, privacyJSON)
+		userID, req.Nick, req.Avatar, req.Bio, linksJSON, privacyJSON, req.Locale)
 	return err3
 }
 
@@ -112,11 +215,11 @@ func (r *UserRepo) GetByID(ctx context.Context, userID int64) (*domain.User, err
 	var privacyJSON []byte
 
 	err := r.db.QueryRow(ctx, `
-		SELECT id, email, hash, role, nick, avatar, bio, links, is_banned,
-		       email_verified, created_at, privacy_settings
+		SELECT id, email, hash, role, nick, handle, avatar, bio, links, is_banned,
+		       email_verified, created_at, privacy_settings, locale
 		FROM users WHERE id = $1`, userID).Scan(
-		&u.ID, &u.Email, &u.Hash, &u.Role, &u.Nick, &u.Avatar, &u.Bio,
-		&linksJSON, &u.IsBanned, &u.EmailVerified, &u.CreatedAt, &privacyJSON)
+		&u.ID, &u.Email, &u.Hash, &u.Role, &u.Nick, &u.Handle, &u.Avatar, &u.Bio,
+		&linksJSON, &u.IsBanned, &u.EmailVerified, &u.CreatedAt, &privacyJSON, &u.Locale)
 
 	if err != nil {
 		return nil, err
@@ -128,22 +231,156 @@ func (r *UserRepo) GetByID(ctx context.Context, userID int64) (*domain.User, err
 	if err := json.Unmarshal(privacyJSON, &u.PrivacySettings); err != nil {
 		u.PrivacySettings = domain.PrivacySettings{}
 	}
+	u.Avatars = domain.AvatarVariants(u.Avatar)
 	return &u, nil
 }
 
+// IsHandleAvailable проверяет, что хэндл не занят другим пользователем сейчас и не числится в его истории
+func (r *UserRepo) IsHandleAvailable(ctx context.Context, handle string, userID int64) (bool, error) {
+	var taken bool
+	err := r.db.QueryRow(ctx, `
+		SELECT EXISTS (SELECT 1 FROM users WHERE handle = $1 AND id != $2)
+		    OR EXISTS (SELECT 1 FROM user_handle_history WHERE old_handle = $1 AND user_id != $2)`,
+		handle, userID).Scan(&taken)
+	if err != nil {
+		return false, err
+	}
+	return !taken, nil
+}
+
+// ChangeHandle меняет хэндл с учетом кулдауна и сохраняет старый в историю для редиректов
+func (r *UserRepo) ChangeHandle(ctx context.Context, userID int64, handle string) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var current string
+	var changedAt *time.Time
+	err = tx.QueryRow(ctx, `
+		SELECT handle, handle_changed_at FROM users WHERE id = $1 FOR UPDATE`, userID).Scan(&current, &changedAt)
+	if err != nil {
+		return err
+	}
+
+	if current == handle {
+		return nil
+	}
+
+	// Смена только регистра не меняет адрес профиля - кулдаун и история не нужны,
+	// и время последней смены не сдвигается
+	update := `UPDATE users SET handle = $2 WHERE id = $1`
+	if !strings.EqualFold(current, handle) {
+		cooldown := time.Duration(domain.HandleChangeCooldownDays) * 24 * time.Hour
+		if changedAt != nil && time.Since(*changedAt) < cooldown {
+			return ErrHandleCooldown
+		}
+
+		var ownerID int64
+		err = tx.QueryRow(ctx, `SELECT user_id FROM user_handle_history WHERE old_handle = $1`, handle).Scan(&ownerID)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return err
+		}
+		if err == nil && ownerID != userID {
+			return ErrHandleTaken
+		}
+
+		// Возврат к собственному старому хэндлу - убираем его из истории
+		if _, err := tx.Exec(ctx, `DELETE FROM user_handle_history WHERE old_handle = $1`, handle); err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(ctx, `
+			INSERT INTO user_handle_history (old_handle, user_id) VALUES ($1, $2)
+			ON CONFLICT (old_handle) DO UPDATE SET user_id = $2, changed_at = NOW()`,
+			current, userID); err != nil {
+			return err
+		}
+
+		update = `UPDATE users SET handle = $2, handle_changed_at = NOW() WHERE id = $1`
+	}
+
+	_, err = tx.Exec(ctx, update, userID, handle)
+	if err != nil {
+		if _, ok := uniqueViolation(err); ok {
+			return ErrHandleTaken
+		}
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// GetPublicProfileByHandle - публичный профиль по текущему хэндлу
+func (r *UserRepo) GetPublicProfileByHandle(ctx context.Context, handle string) (*domain.PublicProfile, error) {
+	var p domain.PublicProfile
+	var linksJSON []byte
+
+	err := r.db.QueryRow(ctx, `
+		SELECT id, handle, nick, avatar, bio, links, created_at
+		FROM users WHERE handle = $1 AND NOT is_banned`, handle).Scan(
+		&p.ID, &p.Handle, &p.Nick, &p.Avatar, &p.Bio, &linksJSON, &p.CreatedAt)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(linksJSON, &p.Links); err != nil {
+		p.Links = []domain.Link{}
+	}
+	p.Avatars = domain.AvatarVariants(p.Avatar)
+	return &p, nil
+}
+
+// ResolveOldHandle возвращает текущий хэндл пользователя, которому раньше принадлежал handle
+func (r *UserRepo) ResolveOldHandle(ctx context.Context, handle string) (string, error) {
+	var current string
+	err := r.db.QueryRow(ctx, `
+		SELECT u.handle FROM user_handle_history h
+		JOIN users u ON u.id = h.user_id
+		WHERE h.old_handle = $1`, handle).Scan(&current)
+	return current, err
+}
+
 // UpdateNotificationSettings - UC-1.2.3
 func (r *UserRepo) UpdateNotificationSettings(ctx context.Context, userID int64, settings domain.NotificationSettings) error {
 	channelsJSON, err := json.Marshal(settings.Channels)
 	if err != nil {
 		return err
 	}
-	_, err2 := r.db.Exec(ctx, `
-		INSERT INTO notification_settings (user_id, new_game, new_build, new_post, channels)
-		VALUES ($1, $2, $3, $4, $5)
+	if !settings.EmailDigest.IsValid() {
+		settings.EmailDigest = domain.DigestDaily
+	}
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `
+		INSERT INTO notification_settings (user_id, new_game, new_build, new_post, channels, email_digest)
+		VALUES ($1, $2, $3, $4, $5, $6)
 		ON CONFLICT (user_id) DO UPDATE SET
-			new_game = $2, new_build = $3, new_post = $4, channels = $5`,
-		userID, settings.NewGame, settings.NewBuild, settings.NewPost, channelsJSON)
-	return err2
+			new_game = $2, new_build = $3, new_post = $4, channels = $5, email_digest = $6`,
+		userID, settings.NewGame, settings.NewBuild, settings.NewPost, channelsJSON, settings.EmailDigest); err != nil {
+		return err
+	}
+
+	// Канал email выключен - очередь дайджеста сбрасываем, иначе после повторного
+	// включения придет письмо со старыми событиями. События только для письма удаляем.
+	if settings.Channels.Email == nil || !*settings.Channels.Email {
+		if _, err := tx.Exec(ctx, `
+			DELETE FROM notifications WHERE user_id = $1 AND digest_pending AND NOT in_app`, userID); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, `
+			UPDATE notifications SET digest_pending = false WHERE user_id = $1 AND digest_pending`, userID); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
 }
 
 // GetNotificationSettings - UC-1.2.3
@@ -152,9 +389,9 @@ func (r *UserRepo) GetNotificationSettings(ctx context.Context, userID int64) (*
 	var channelsJSON []byte
 
 	err := r.db.QueryRow(ctx, `
-		SELECT user_id, new_game, new_build, new_post, channels
+		SELECT user_id, new_game, new_build, new_post, channels, email_digest
 		FROM notification_settings WHERE user_id = $1`, userID).Scan(
-		&settings.UserID, &settings.NewGame, &settings.NewBuild, &settings.NewPost, &channelsJSON)
+		&settings.UserID, &settings.NewGame, &settings.NewBuild, &settings.NewPost, &channelsJSON, &settings.EmailDigest)
 
 	if err != nil {
 		// Возвращаем дефолтные настройки
@@ -168,14 +405,38 @@ func (r *UserRepo) GetNotificationSettings(ctx context.Context, userID int64) (*
 	return &settings, nil
 }
 
-// CreateResetToken - UC-1.1.3 (TTL 1 час)
-func (r *UserRepo) CreateResetToken(ctx context.Context, userID int64, token string) error {
-	_, err := r.db.Exec(ctx, `
+// CreateResetToken - UC-1.1.3 (TTL 1 час), письмо ставится в outbox в той же транзакции
+func (r *UserRepo) CreateResetToken(ctx context.Context, userID int64, email, token string) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `
 		INSERT INTO password_reset_tokens (token, user_id, expires_at)
 		VALUES ($1, $2, NOW() + INTERVAL '1 hour')
 		ON CONFLICT (user_id) DO UPDATE SET token = $1, expires_at = NOW() + INTERVAL '1 hour'`,
 		token, userID)
-	return err
+	if err != nil {
+		return err
+	}
+
+	// Письмо рендерится на языке пользователя на момент запроса
+	var locale string
+	if err := tx.QueryRow(ctx, `SELECT locale FROM users WHERE id = $1`, userID).Scan(&locale); err != nil {
+		return err
+	}
+
+	// Письма с прежним токеном больше не нужны: ссылка в них перестала работать
+	if err := cancelPendingEmails(ctx, tx, domain.EmailKindPasswordReset, email); err != nil {
+		return err
+	}
+	if err := enqueueEmail(ctx, tx, domain.EmailKindPasswordReset, email, domain.TokenEmailPayload{Token: token, Locale: locale}); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
 }
 
 // ResetPassword - UC-1.1.3 сброс пароля и всех сессий
@@ -298,8 +559,8 @@ func (r *UserRepo) GetUsers(ctx context.Context, limit, offset int) ([]domain.Us
 
 	// Получаем пользователей с пагинацией
 	rows, err := r.db.Query(ctx, `
-		SELECT id, email, hash, role, nick, avatar, bio, links, is_banned,
-		       email_verified, created_at, privacy_settings
+		SELECT id, email, hash, role, nick, handle, avatar, bio, links, is_banned,
+		       email_verified, created_at, privacy_settings, locale
 		FROM users
 		ORDER BY created_at DESC
 		LIMIT $1 OFFSET $2
@@ -316,8 +577,8 @@ func (r *UserRepo) GetUsers(ctx context.Context, limit, offset int) ([]domain.Us
 		var linksJSON []byte
 		var privacyJSON []byte
 
-		err := rows.Scan(&u.ID, &u.Email, &u.Hash, &u.Role, &u.Nick, &u.Avatar, &u.Bio,
-			&linksJSON, &u.IsBanned, &u.EmailVerified, &u.CreatedAt, &privacyJSON)
+		err := rows.Scan(&u.ID, &u.Email, &u.Hash, &u.Role, &u.Nick, &u.Handle, &u.Avatar, &u.Bio,
+			&linksJSON, &u.IsBanned, &u.EmailVerified, &u.CreatedAt, &privacyJSON, &u.Locale)
 		if err != nil {
 			return nil, 0, err
 		}
@@ -328,6 +589,7 @@ func (r *UserRepo) GetUsers(ctx context.Context, limit, offset int) ([]domain.Us
 		if err := json.Unmarshal(privacyJSON, &u.PrivacySettings); err != nil {
 			u.PrivacySettings = domain.PrivacySettings{}
 		}
+		u.Avatars = domain.AvatarVariants(u.Avatar)
 
 		// Очищаем хеш пароля для безопасности
 		u.Hash = ""
@@ -346,6 +608,35 @@ func (r *UserRepo) UpdateUserRole(ctx context.Context, userID int64, role string
 	return err
 }
 
+// MarkEmailVerified - подтверждение email без письма (hubigrctl)
+func (r *UserRepo) MarkEmailVerified(ctx context.Context, userID int64) error {
+	_, err := r.db.Exec(ctx, `
+		WITH verified AS (
+			UPDATE users SET email_verified = true WHERE id = $1
+		)
+		DELETE FROM email_verify_tokens WHERE user_id = $1`, userID)
+	return err
+}
+
+// AvatarRefs - ссылки пользователей на аватары
+func (r *UserRepo) AvatarRefs(ctx context.Context) ([]domain.AvatarRef, error) {
+	rows, err := r.db.Query(ctx, `SELECT id, avatar FROM users WHERE avatar IS NOT NULL AND avatar <> ''`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	refs := []domain.AvatarRef{}
+	for rows.Next() {
+		var ref domain.AvatarRef
+		if err := rows.Scan(&ref.UserID, &ref.URL); err != nil {
+			return nil, err
+		}
+		refs = append(refs, ref)
+	}
+	return refs, rows.Err()
+}
+
 // UpdateUserBanStatus - изменение статуса бана пользователя
 func (r *UserRepo) UpdateUserBanStatus(ctx context.Context, userID int64, banned bool) error {
 	_, err := r.db.Exec(ctx, `
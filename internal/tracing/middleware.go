@@ -0,0 +1,75 @@
+package tracing
+
+import (
+	"github.com/RESERPIX/hubigr/internal/utils"
+	"github.com/gofiber/fiber/v2"
+	"github.com/valyala/fasthttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Middleware начинает серверный спан запроса, продолжая трейс из traceparent.
+// Контекст со спаном кладется в c.UserContext(): обработчики передают его в
+// репозитории и Redis, и их спаны становятся дочерними.
+func Middleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		ctx := otel.GetTextMapPropagator().Extract(c.UserContext(), headerCarrier{&c.Request().Header})
+		ctx, span := tracer.Start(ctx, c.Method(),
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.request.method", c.Method()),
+				attribute.String("url.path", c.Path()),
+				attribute.String("client.address", utils.ClientIP(c)),
+				attribute.String("user_agent.original", c.Get(fiber.HeaderUserAgent)),
+			),
+		)
+		defer span.End()
+		c.SetUserContext(ctx)
+
+		err := c.Next()
+
+		// Как и в метриках, после c.Next() в c.Route() - шаблон маршрута обработчика
+		route := c.Route().Path
+		span.SetName(c.Method() + " " + route)
+		span.SetAttributes(attribute.String("http.route", route))
+
+		status := c.Response().StatusCode()
+		if err != nil {
+			// Ошибку еще обработает ErrorHandler
+			status = fiber.StatusInternalServerError
+			if e, ok := err.(*fiber.Error); ok {
+				status = e.Code
+			}
+			span.RecordError(err)
+		}
+		span.SetAttributes(attribute.Int("http.response.status_code", status))
+		if status >= fiber.StatusInternalServerError {
+			span.SetStatus(codes.Error, "")
+		}
+
+		return err
+	}
+}
+
+// headerCarrier - заголовки fasthttp для propagation.TextMapCarrier
+type headerCarrier struct {
+	header *fasthttp.RequestHeader
+}
+
+func (h headerCarrier) Get(key string) string {
+	return string(h.header.Peek(key))
+}
+
+func (h headerCarrier) Set(key, value string) {
+	h.header.Set(key, value)
+}
+
+func (h headerCarrier) Keys() []string {
+	keys := make([]string, 0, h.header.Len())
+	h.header.VisitAll(func(key, _ []byte) {
+		keys = append(keys, string(key))
+	})
+	return keys
+}
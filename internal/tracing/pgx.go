@@ -0,0 +1,47 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// PgxTracer - спаны запросов pgx (pgx.QueryTracer). Подключается через
+// pgxpool.Config.ConnConfig.Tracer. Текст запроса пишется без аргументов.
+type PgxTracer struct{}
+
+// TraceQueryStart начинает спан запроса
+func (PgxTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	ctx, _ = tracer.Start(ctx, "db "+sqlOperation(data.SQL),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", "postgresql"),
+			attribute.String("db.statement", data.SQL),
+		),
+	)
+	return ctx
+}
+
+// TraceQueryEnd завершает спан запроса. Пустой результат QueryRow ошибкой не считается.
+func (PgxTracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(attribute.Int64("db.rows_affected", data.CommandTag.RowsAffected()))
+	err := data.Err
+	if errors.Is(err, pgx.ErrNoRows) {
+		err = nil
+	}
+	End(span, err)
+}
+
+// sqlOperation - первое слово запроса (SELECT, INSERT, ...) для имени спана
+func sqlOperation(sql string) string {
+	fields := strings.Fields(sql)
+	if len(fields) == 0 {
+		return "query"
+	}
+	return strings.ToUpper(fields[0])
+}
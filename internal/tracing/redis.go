@@ -0,0 +1,59 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"net"
+
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RedisHook - спаны команд go-redis (redis.Hook). Аргументы команд не пишутся:
+// в ключах rate limiting есть IP и email.
+type RedisHook struct{}
+
+// DialHook не трейсит подключения
+func (RedisHook) DialHook(next redis.DialHook) redis.DialHook {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return next(ctx, network, addr)
+	}
+}
+
+// ProcessHook - спан на каждую команду
+func (RedisHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		ctx, span := tracer.Start(ctx, "redis "+cmd.FullName(),
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(attribute.String("db.system", "redis")),
+		)
+		err := next(ctx, cmd)
+		End(span, redisError(err))
+		return err
+	}
+}
+
+// ProcessPipelineHook - один спан на pipeline/транзакцию
+func (RedisHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		ctx, span := tracer.Start(ctx, "redis pipeline",
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(
+				attribute.String("db.system", "redis"),
+				attribute.Int("db.redis.pipeline_length", len(cmds)),
+			),
+		)
+		err := next(ctx, cmds)
+		End(span, redisError(err))
+		return err
+	}
+}
+
+// redisError - redis.Nil (ключа нет) ошибкой не считается
+func redisError(err error) error {
+	if errors.Is(err, redis.Nil) {
+		return nil
+	}
+	return err
+}
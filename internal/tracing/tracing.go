@@ -0,0 +1,74 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName - имя, под которым сервис создает свои спаны
+const instrumentationName = "github.com/RESERPIX/hubigr"
+
+// tracer берет провайдер из otel глобально, поэтому спаны пакетов, созданные
+// до Setup, тоже уходят в настроенный экспорт
+var tracer = otel.Tracer(instrumentationName)
+
+// Setup настраивает экспорт трейсов по OTLP/HTTP. Пустой endpoint - экспорт выключен:
+// спаны не записываются, но traceparent от KrakenD все равно разбирается, и trace_id
+// попадает в логи. Возвращает функцию, которая отправляет оставшиеся спаны при остановке.
+func Setup(ctx context.Context, endpoint, serviceName string, sampleRatio float64) (func(context.Context) error, error) {
+	// W3C traceparent/tracestate и baggage, как у KrakenD
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	if endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(endpoint))
+	if err != nil {
+		return nil, fmt.Errorf("create OTLP exporter: %w", err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(serviceName),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("create resource: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		// Решение о записи принимает KrakenD; без входящего трейса - доля sampleRatio
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(sampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
+
+// Start начинает дочерний спан ctx
+func Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return tracer.Start(ctx, name, opts...)
+}
+
+// End завершает спан, отмечая ошибку, если она есть
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
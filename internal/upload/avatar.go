@@ -2,33 +2,46 @@ package upload
 
 import (
 	"bytes"
-	"crypto/rand"
+	"context"
+	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
 	"io"
 	"mime/multipart"
-	"os"
-	"path/filepath"
 	"strings"
+	"time"
+
+	"github.com/RESERPIX/hubigr/internal/domain"
+	"github.com/RESERPIX/hubigr/internal/storage"
 )
 
 const (
-	MaxAvatarSize = 2 << 20 // 2 МБ согласно ТЗ
-	UploadDir     = "./uploads/avatars"
+	MaxAvatarSize = 2 << 20    // 2 МБ согласно ТЗ
+	AvatarPrefix  = "avatars/" // префикс ключей аватаров в хранилище
 )
 
+var avatarContentTypes = map[string]string{
+	"jpg":  "image/jpeg",
+	"png":  "image/png",
+	"webp": "image/webp",
+}
+
 type AvatarUploader struct {
+	files   storage.Storage
 	baseURL string
+	webp    bool // сохранять варианты в WebP вместо исходного формата
 }
 
-func NewAvatarUploader(baseURL string) *AvatarUploader {
-	// Создаем директорию с безопасными правами (0700 - только владелец)
-	os.MkdirAll(UploadDir, 0700)
-	return &AvatarUploader{baseURL: baseURL}
+func NewAvatarUploader(files storage.Storage, baseURL string, webp bool) *AvatarUploader {
+	return &AvatarUploader{files: files, baseURL: baseURL, webp: webp}
 }
 
-// UploadAvatar загружает аватар согласно UC-1.2.1 (jpeg/png, до 2 МБ)
-func (u *AvatarUploader) UploadAvatar(userID int64, file *multipart.FileHeader) (string, error) {
+// UploadAvatar загружает аватар согласно UC-1.2.1 (jpeg/png, до 2 МБ).
+// Сохраняются перекодированные квадратные варианты domain.AvatarSizes
+// (<id>_<хеш>_<size>.<ext>), возвращается URL самого большого. Имя зависит
+// только от пользователя и содержимого: объекты не перезаписываются другим
+// содержимым, а повторная загрузка той же картинки дает тот же URL.
+func (u *AvatarUploader) UploadAvatar(ctx context.Context, userID int64, file *multipart.FileHeader) (string, error) {
 	if file.Size > MaxAvatarSize {
 		return "", fmt.Errorf("file too large")
 	}
@@ -50,10 +63,6 @@ func (u *AvatarUploader) UploadAvatar(userID int64, file *multipart.FileHeader)
 		return "", fmt.Errorf("invalid image format")
 	}
 
-	if containsMaliciousContent(buffer) {
-		return "", fmt.Errorf("invalid file content")
-	}
-
 	// Определяем расширение файла на основе магических байт
 	extension := getImageExtension(buffer)
 	if extension == "" {
@@ -66,43 +75,34 @@ func (u *AvatarUploader) UploadAvatar(userID int64, file *multipart.FileHeader)
 	}
 
 	src.Seek(0, 0)
-
-	randomID, err := generateSecureFilename()
+	data, err := io.ReadAll(io.LimitReader(src, MaxAvatarSize))
 	if err != nil {
-		return "", fmt.Errorf("filename generation failed")
+		return "", fmt.Errorf("file read failed")
 	}
 
-	filename := fmt.Sprintf("%d_%s.%s", userID, randomID, extension)
-	
-	// Безопасное построение пути - используем только базовое имя файла
-	safeFilename := filepath.Base(filename)
-	absUploadDir, err := filepath.Abs(UploadDir)
-	if err != nil {
-		return "", fmt.Errorf("path resolution failed")
+	// Исходные байты не сохраняем: только заново закодированные пиксели
+	format := extension
+	if u.webp {
+		format = "webp"
 	}
-	
-	// Строим путь только из безопасных компонентов
-	filePath := filepath.Join(absUploadDir, safeFilename)
-	absFilePath, err := filepath.Abs(filePath)
+	variants, err := processAvatar(data, format, domain.AvatarSizes)
 	if err != nil {
-		return "", fmt.Errorf("path resolution failed")
-	}
-	
-	// Критическая проверка - файл должен быть строго внутри директории
-	if !strings.HasPrefix(absFilePath, absUploadDir+string(filepath.Separator)) {
-		return "", fmt.Errorf("path traversal detected")
+		return "", err
 	}
 
-	dst, err := os.OpenFile(absFilePath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
-	if err != nil {
-		return "", fmt.Errorf("file creation failed")
-	}
-	defer dst.Close()
+	// Хеш самого большого варианта: остальные получены из тех же пикселей
+	sum := sha256.Sum256(variants[len(variants)-1].data)
+	contentID := hex.EncodeToString(sum[:16])
 
-	_, err = io.Copy(dst, src)
-	if err != nil {
-		os.Remove(absFilePath)
-		return "", fmt.Errorf("file write failed")
+	var written []string
+	var filename string
+	for _, variant := range variants {
+		filename = fmt.Sprintf("%d_%s_%d.%s", userID, contentID, variant.size, format)
+		if err := u.files.Put(ctx, AvatarPrefix+filename, variant.data, avatarContentTypes[format]); err != nil {
+			u.deleteKeys(written)
+			return "", fmt.Errorf("file write failed")
+		}
+		written = append(written, AvatarPrefix+filename)
 	}
 
 	// URL должен указывать на бэкенд, а не фронтенд
@@ -110,43 +110,26 @@ func (u *AvatarUploader) UploadAvatar(userID int64, file *multipart.FileHeader)
 	return avatarURL, nil
 }
 
-// DeleteAvatar удаляет старый аватар
-func (u *AvatarUploader) DeleteAvatar(avatarURL string) error {
-	if avatarURL == "" {
-		return nil
+// deleteKeys убирает варианты, записанные до ошибки
+func (u *AvatarUploader) deleteKeys(keys []string) {
+	// Запрос клиента мог уже отмениться, а мусор все равно нужно убрать
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	for _, key := range keys {
+		u.files.Delete(ctx, key)
 	}
+}
 
-	parts := strings.Split(avatarURL, "/")
-	if len(parts) == 0 {
+// DeleteAvatar удаляет старый аватар со всеми размерами
+func (u *AvatarUploader) DeleteAvatar(ctx context.Context, avatarURL string) error {
+	if avatarURL == "" {
 		return nil
 	}
-	// Используем только базовое имя файла для безопасности
-	safeFilename := filepath.Base(parts[len(parts)-1])
-	
-	// Проверяем что имя файла соответствует нашему формату
-	for _, r := range safeFilename {
-		if !((r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '_' || r == '.') {
-			return fmt.Errorf("invalid filename")
-		}
-	}
-	
-	absUploadDir, err := filepath.Abs(UploadDir)
-	if err != nil {
-		return fmt.Errorf("path resolution failed")
-	}
-	
-	filePath := filepath.Join(absUploadDir, safeFilename)
-	absFilePath, err := filepath.Abs(filePath)
-	if err != nil {
-		return fmt.Errorf("path resolution failed")
-	}
-	
-	if !strings.HasPrefix(absFilePath, absUploadDir+string(filepath.Separator)) {
-		return fmt.Errorf("path traversal detected")
-	}
 
-	if _, err := os.Stat(absFilePath); err == nil {
-		return os.Remove(absFilePath)
+	for _, filename := range AvatarFilenames(avatarURL) {
+		if err := u.files.Delete(ctx, AvatarPrefix+filename); err != nil {
+			return err
+		}
 	}
 	return nil
 }
@@ -180,42 +163,6 @@ func isValidImageByMagicBytes(data []byte) bool {
 	return false
 }
 
-// Прекомпилированные паттерны для эффективности
-var maliciousPatterns = [][]byte{
-	[]byte("<?php"),
-	[]byte("<script"),
-	[]byte("javascript:"),
-	[]byte("eval("),
-	[]byte("exec("),
-	[]byte("system("),
-	[]byte("shell_exec("),
-	[]byte("passthru("),
-	[]byte("base64_decode("),
-}
-
-// containsMaliciousContent проверяет на подозрительное содержимое
-func containsMaliciousContent(data []byte) bool {
-	// Преобразуем в lowercase только однажды
-	lowerData := bytes.ToLower(data)
-	
-	// Используем bytes.Contains вместо string conversion
-	for _, pattern := range maliciousPatterns {
-		if bytes.Contains(lowerData, pattern) {
-			return true
-		}
-	}
-	return false
-}
-
-// generateSecureFilename - генерация безопасного имени файла
-func generateSecureFilename() (string, error) {
-	bytes := make([]byte, 16)
-	if _, err := rand.Read(bytes); err != nil {
-		return "", err
-	}
-	return hex.EncodeToString(bytes), nil
-}
-
 // getImageExtension определяет расширение файла на основе магических байт
 func getImageExtension(data []byte) string {
 	if len(data) < 8 {
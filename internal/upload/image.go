@@ -0,0 +1,179 @@
+package upload
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+
+	"github.com/HugoSmits86/nativewebp"
+	"golang.org/x/image/draw"
+)
+
+// Ограничения декодирования: маленький файл может объявить огромное
+// разрешение и занять гигабайты памяти при декодировании
+const (
+	maxAvatarSide   = 8000
+	maxAvatarPixels = 25_000_000
+)
+
+const avatarJPEGQuality = 85
+
+// avatarVariant - закодированный вариант аватара одного размера
+type avatarVariant struct {
+	size int
+	data []byte
+}
+
+// processAvatar декодирует изображение, обрезает до квадрата по центру,
+// уменьшает до каждого из sizes и кодирует заново в format (jpg, png, webp).
+// Перекодирование отбрасывает EXIF/GPS и все, что дописано к картинке.
+func processAvatar(data []byte, format string, sizes []int) ([]avatarVariant, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid image")
+	}
+	if cfg.Width > maxAvatarSide || cfg.Height > maxAvatarSide || cfg.Width*cfg.Height > maxAvatarPixels {
+		return nil, fmt.Errorf("image resolution too large")
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid image")
+	}
+
+	// Квадрат по центру
+	bounds := src.Bounds()
+	side := min(bounds.Dx(), bounds.Dy())
+	crop := image.Rect(0, 0, side, side).Add(bounds.Min).Add(image.Pt((bounds.Dx()-side)/2, (bounds.Dy()-side)/2))
+
+	// Ориентация из EXIF применяется к уже уменьшенному квадрату: центральный
+	// квадрат при повороте и отражении остается тем же
+	orientation := jpegOrientation(data)
+
+	variants := make([]avatarVariant, 0, len(sizes))
+	for _, size := range sizes {
+		dst := image.NewRGBA(image.Rect(0, 0, size, size))
+		draw.CatmullRom.Scale(dst, dst.Bounds(), src, crop, draw.Src, nil)
+
+		encoded, err := encodeAvatar(orient(dst, orientation), format)
+		if err != nil {
+			return nil, err
+		}
+		variants = append(variants, avatarVariant{size: size, data: encoded})
+	}
+	return variants, nil
+}
+
+func encodeAvatar(img image.Image, format string) ([]byte, error) {
+	var buf bytes.Buffer
+	var err error
+	switch format {
+	case "webp":
+		err = nativewebp.Encode(&buf, img, nil)
+	case "png":
+		err = (&png.Encoder{CompressionLevel: png.BestCompression}).Encode(&buf, img)
+	default:
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: avatarJPEGQuality})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("image encoding failed")
+	}
+	return buf.Bytes(), nil
+}
+
+// jpegOrientation - значение тега Orientation (1-8) из EXIF JPEG, 1 если его нет
+func jpegOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+	for pos := 2; pos+4 <= len(data); {
+		if data[pos] != 0xFF {
+			return 1
+		}
+		marker := data[pos+1]
+		// До начала сжатых данных (SOS) EXIF не встретился
+		if marker == 0xDA || marker == 0xD9 {
+			return 1
+		}
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		if length < 2 || pos+2+length > len(data) {
+			return 1
+		}
+		segment := data[pos+4 : pos+2+length]
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return exifOrientation(segment[6:])
+		}
+		pos += 2 + length
+	}
+	return 1
+}
+
+// exifOrientation читает Orientation (0x0112) из IFD0 блока TIFF
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 1
+	}
+	count := int(order.Uint16(tiff[ifd:]))
+	for i := 0; i < count; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			value := int(order.Uint16(tiff[entry+8:]))
+			if value >= 1 && value <= 8 {
+				return value
+			}
+			return 1
+		}
+	}
+	return 1
+}
+
+// orient поворачивает и отражает квадрат img так, как требует EXIF orientation
+func orient(img *image.RGBA, orientation int) *image.RGBA {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+	n := img.Bounds().Dx()
+	dst := image.NewRGBA(img.Bounds())
+	for y := 0; y < n; y++ {
+		for x := 0; x < n; x++ {
+			var sx, sy int
+			switch orientation {
+			case 2: // отражение по горизонтали
+				sx, sy = n-1-x, y
+			case 3: // поворот на 180
+				sx, sy = n-1-x, n-1-y
+			case 4: // отражение по вертикали
+				sx, sy = x, n-1-y
+			case 5: // транспонирование
+				sx, sy = y, x
+			case 6: // поворот на 90 по часовой
+				sx, sy = y, n-1-x
+			case 7: // транспонирование относительно побочной диагонали
+				sx, sy = n-1-y, n-1-x
+			case 8: // поворот на 90 против часовой
+				sx, sy = n-1-y, x
+			}
+			dst.SetRGBA(x, y, img.RGBAAt(sx, sy))
+		}
+	}
+	return dst
+}
@@ -0,0 +1,167 @@
+package upload
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/RESERPIX/hubigr/internal/domain"
+	"github.com/RESERPIX/hubigr/internal/storage"
+)
+
+// Причины висячих ссылок
+const (
+	DanglingMissingFile = "missing_file" // файла нет в хранилище
+	DanglingForeignURL  = "foreign_url"  // ссылка не на загруженный через сервис файл
+)
+
+// AvatarFile - файл аватара в хранилище без ссылки из БД
+type AvatarFile struct {
+	Name    string    `json:"name"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+// DanglingRef - ссылка пользователя на аватар, которого нет
+type DanglingRef struct {
+	UserID int64  `json:"user_id"`
+	URL    string `json:"url"`
+	Reason string `json:"reason"`
+}
+
+// ReconcileReport - результат сверки хранилища аватаров с БД
+type ReconcileReport struct {
+	DryRun     bool          `json:"dry_run"`
+	Files      int           `json:"files"`
+	Referenced int           `json:"referenced"`
+	Recent     int           `json:"recent"` // без ссылки, но моложе grace - не трогаем
+	Orphaned   []AvatarFile  `json:"orphaned"`
+	Removed    int64         `json:"removed"`
+	Dangling   []DanglingRef `json:"dangling"`
+}
+
+// Reconciler сверяет файлы аватаров в хранилище со ссылками users.avatar: удаляет
+// файлы без ссылок старше grace и находит ссылки на несуществующие файлы.
+// Висячие ссылки только попадают в отчет: решение о них принимает админ.
+type Reconciler struct {
+	files storage.Storage
+	refs  func(ctx context.Context) ([]domain.AvatarRef, error)
+	grace time.Duration
+}
+
+// NewReconciler создает сверку; refs возвращает ссылки на аватары из БД
+func NewReconciler(files storage.Storage, refs func(ctx context.Context) ([]domain.AvatarRef, error), grace time.Duration) *Reconciler {
+	return &Reconciler{files: files, refs: refs, grace: grace}
+}
+
+// Reconcile выполняет сверку; в режиме dryRun ничего не удаляет
+func (r *Reconciler) Reconcile(ctx context.Context, dryRun bool) (*ReconcileReport, error) {
+	// Ссылки читаем до списка файлов: файл, загруженный между этими шагами,
+	// моложе grace и не будет удален
+	refs, err := r.refs(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	objects, err := r.files.List(ctx, AvatarPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ReconcileReport{DryRun: dryRun, Orphaned: []AvatarFile{}, Dangling: []DanglingRef{}}
+	referenced := make(map[string]bool, len(refs))
+	for _, ref := range refs {
+		for _, name := range AvatarFilenames(ref.URL) {
+			referenced[name] = true
+		}
+	}
+
+	stored := make(map[string]bool, len(objects))
+	cutoff := time.Now().Add(-r.grace)
+	for _, object := range objects {
+		name := strings.TrimPrefix(object.Key, AvatarPrefix)
+		if strings.Contains(name, "/") {
+			continue
+		}
+		stored[name] = true
+		report.Files++
+		if referenced[name] {
+			report.Referenced++
+			continue
+		}
+		if object.ModTime.After(cutoff) {
+			report.Recent++
+			continue
+		}
+		report.Orphaned = append(report.Orphaned, AvatarFile{Name: name, Size: object.Size, ModTime: object.ModTime})
+	}
+
+	for _, ref := range refs {
+		names := AvatarFilenames(ref.URL)
+		if len(names) == 0 {
+			report.Dangling = append(report.Dangling, DanglingRef{UserID: ref.UserID, URL: ref.URL, Reason: DanglingForeignURL})
+			continue
+		}
+		for _, name := range names {
+			if !stored[name] {
+				report.Dangling = append(report.Dangling, DanglingRef{UserID: ref.UserID, URL: ref.URL, Reason: DanglingMissingFile})
+				break
+			}
+		}
+	}
+
+	if dryRun {
+		return report, nil
+	}
+	for _, file := range report.Orphaned {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		if err := r.files.Delete(ctx, AvatarPrefix+file.Name); err != nil {
+			return report, err
+		}
+		report.Removed++
+	}
+	return report, nil
+}
+
+// AvatarFilenames - имена файлов всех размеров аватара по URL из users.avatar;
+// для аватаров без размеров - один файл, для чужих ссылок - nil
+func AvatarFilenames(avatarURL string) []string {
+	urls := []string{avatarURL}
+	if variants := domain.AvatarVariants(&avatarURL); variants != nil {
+		urls = urls[:0]
+		for _, size := range domain.AvatarSizes {
+			urls = append(urls, variants[strconv.Itoa(size)])
+		}
+	}
+
+	names := make([]string, 0, len(urls))
+	for _, u := range urls {
+		name, ok := AvatarFilename(u)
+		if !ok {
+			return nil
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+// AvatarFilename - имя файла из URL аватара, выданного UploadAvatar
+// (<base>/uploads/avatars/<имя>); false - ссылка не на наш файл
+func AvatarFilename(avatarURL string) (string, bool) {
+	_, name, found := strings.Cut(avatarURL, "/uploads/avatars/")
+	if !found || name == "" {
+		return "", false
+	}
+	for _, r := range name {
+		if !((r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '_' || r == '.') {
+			return "", false
+		}
+	}
+	if name == "." || name == ".." {
+		return "", false
+	}
+	return name, true
+}
@@ -0,0 +1,167 @@
+package utils
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Заголовки, из которых берется адрес клиента за прокси
+const (
+	ClientIPHeaderXForwardedFor = "x-forwarded-for"
+	ClientIPHeaderForwarded     = "forwarded"
+)
+
+// clientIPLocal - ключ c.Locals с адресом клиента
+const clientIPLocal = "client_ip"
+
+// TrustedProxies - прокси (KrakenD, балансировщик), которым доверяем заголовок с адресом
+// клиента. Заголовок выбирается один: если прокси пропускает второй заголовок от клиента
+// как есть, доверять ему нельзя.
+type TrustedProxies struct {
+	prefixes []netip.Prefix
+	header   string
+}
+
+// ParseTrustedProxies разбирает список подсетей и IP через запятую
+func ParseTrustedProxies(spec, header string) (*TrustedProxies, error) {
+	header = strings.ToLower(strings.TrimSpace(header))
+	if header != ClientIPHeaderXForwardedFor && header != ClientIPHeaderForwarded {
+		return nil, fmt.Errorf("header must be %s or %s", ClientIPHeaderXForwardedFor, ClientIPHeaderForwarded)
+	}
+
+	t := &TrustedProxies{header: header}
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		var prefix netip.Prefix
+		if strings.Contains(entry, "/") {
+			p, err := netip.ParsePrefix(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid CIDR %q", entry)
+			}
+			prefix = p.Masked()
+		} else {
+			addr, err := netip.ParseAddr(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid IP %q", entry)
+			}
+			addr = addr.Unmap()
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		t.prefixes = append(t.prefixes, prefix)
+	}
+	return t, nil
+}
+
+// Header - заголовок с адресом клиента
+func (t *TrustedProxies) Header() string {
+	return t.header
+}
+
+// String - список подсетей для логов при старте
+func (t *TrustedProxies) String() string {
+	parts := make([]string, 0, len(t.prefixes))
+	for _, p := range t.prefixes {
+		parts = append(parts, p.String())
+	}
+	return strings.Join(parts, ",")
+}
+
+func (t *TrustedProxies) trusted(addr netip.Addr) bool {
+	for _, p := range t.prefixes {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// Resolve возвращает адрес клиента по адресу соединения и значениям заголовка.
+// Заголовок учитывается, только если соединение пришло от доверенного прокси.
+// Цепочка адресов просматривается справа налево: каждый доверенный прокси добавляет
+// адрес, от которого получил запрос, поэтому клиентом считается первый недоверенный
+// адрес. Все, что левее, мог подставить сам клиент.
+func (t *TrustedProxies) Resolve(remote string, headerValues []string) string {
+	addr, err := netip.ParseAddr(remote)
+	if err != nil {
+		return remote
+	}
+	addr = addr.Unmap()
+	if !t.trusted(addr) {
+		return addr.String()
+	}
+
+	var hops []string
+	for _, value := range headerValues {
+		if t.header == ClientIPHeaderForwarded {
+			hops = append(hops, forwardedFor(value)...)
+		} else {
+			for _, hop := range strings.Split(value, ",") {
+				hops = append(hops, strings.TrimSpace(hop))
+			}
+		}
+	}
+
+	client := addr
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, ok := parseHop(hops[i])
+		if !ok {
+			// Мусор или скрытый адрес (for=unknown) - дальше цепочке верить нельзя,
+			// клиентом считаем последний доверенный узел
+			break
+		}
+		client = hop
+		if !t.trusted(hop) {
+			break
+		}
+	}
+	return client.String()
+}
+
+// forwardedFor извлекает параметры for= из заголовка Forwarded (RFC 7239)
+func forwardedFor(value string) []string {
+	var hops []string
+	for _, element := range strings.Split(value, ",") {
+		for _, pair := range strings.Split(element, ";") {
+			key, val, ok := strings.Cut(strings.TrimSpace(pair), "=")
+			if ok && strings.EqualFold(key, "for") {
+				hops = append(hops, val)
+			}
+		}
+	}
+	return hops
+}
+
+// parseHop разбирает адрес из заголовка: "203.0.113.7", "203.0.113.7:4711",
+// "[2001:db8::1]:4711", "\"[2001:db8::1]\""
+func parseHop(hop string) (netip.Addr, bool) {
+	hop = strings.Trim(strings.TrimSpace(hop), `"`)
+	if addrPort, err := netip.ParseAddrPort(hop); err == nil {
+		return addrPort.Addr().Unmap(), true
+	}
+	hop = strings.TrimSuffix(strings.TrimPrefix(hop, "["), "]")
+	addr, err := netip.ParseAddr(hop)
+	if err != nil || addr.Zone() != "" {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap(), true
+}
+
+// SetClientIP сохраняет адрес клиента для ClientIP
+func SetClientIP(c *fiber.Ctx, ip string) {
+	c.Locals(clientIPLocal, ip)
+}
+
+// ClientIP - адрес клиента с учетом доверенных прокси; вне ClientIPMiddleware -
+// адрес соединения
+func ClientIP(c *fiber.Ctx) string {
+	if ip, ok := c.Locals(clientIPLocal).(string); ok && ip != "" {
+		return ip
+	}
+	return c.IP()
+}
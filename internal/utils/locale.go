@@ -0,0 +1,32 @@
+package utils
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/RESERPIX/hubigr/internal/domain"
+)
+
+// PreferredLocale выбирает поддерживаемый язык из заголовка Accept-Language
+// с учетом q-весов; если подходящего нет, возвращает язык по умолчанию
+func PreferredLocale(acceptLanguage string) string {
+	best := domain.DefaultLocale
+	bestQ := 0.0
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		// "en-US" -> "en"
+		lang, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(tag)), "-")
+		if domain.IsSupportedLocale(lang) && q > bestQ {
+			best, bestQ = lang, q
+		}
+	}
+	return best
+}
@@ -13,8 +13,23 @@ var (
 	passwordRegex = regexp.MustCompile(`^[0-9A-Za-z!"#$%&'()*+,\-./:;<=>?@\[\\\]^_{|}~]+$`)
 	nickRegex     = regexp.MustCompile(`^[A-Za-zА-Яа-я]+$`)
 	urlRegex      = regexp.MustCompile(`^https?://[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}(?:/[^\s]*)?$`)
+	handleRegex   = regexp.MustCompile(`^[A-Za-z0-9](?:[A-Za-z0-9_-]*[A-Za-z0-9])?$`)
+	// Формат автоматически выдаваемых хэндлов (user<id>) нельзя занять вручную
+	generatedHandleRegex = regexp.MustCompile(`(?i)^user[0-9]+$`)
 )
 
+// reservedHandles - хэндлы, которые пересекаются с маршрутами фронтенда и служебными именами
+var reservedHandles = map[string]bool{
+	"about": true, "admin": true, "administrator": true, "api": true, "auth": true,
+	"avatar": true, "avatars": true, "builds": true, "csrf-token": true, "dashboard": true,
+	"edit": true, "games": true, "health": true, "help": true, "hubigr": true,
+	"inbox": true, "jams": true, "login": true, "logout": true, "me": true,
+	"metrics": true, "moderator": true, "new": true, "notifications": true, "null": true,
+	"posts": true, "profile": true, "register": true, "reset-password": true, "root": true,
+	"settings": true, "signup": true, "static": true, "support": true, "system": true,
+	"undefined": true, "uploads": true, "user": true, "users": true, "verify": true,
+}
+
 func ValidateSignUp(req domain.SignUpRequest) []string {
 	var errors []string
 
@@ -41,6 +56,14 @@ func ValidateSignUp(req domain.SignUpRequest) []string {
 		errors = append(errors, "Ник может содержать только буквы")
 	}
 
+	if req.Handle != "" {
+		errors = append(errors, ValidateHandle(req.Handle)...)
+	}
+
+	if req.Locale != "" && !domain.IsSupportedLocale(req.Locale) {
+		errors = append(errors, "Поддерживаются языки: ru, en")
+	}
+
 	if !req.AgreeTerms {
 		errors = append(errors, "Необходимо согласиться с Условиями и Политикой конфиденциальности")
 	}
@@ -73,5 +96,30 @@ func ValidateProfile(req domain.UpdateProfileRequest) []string {
 		}
 	}
 
+	if req.Locale != nil && !domain.IsSupportedLocale(*req.Locale) {
+		errors = append(errors, "Поддерживаются языки: ru, en")
+	}
+
 	return errors
-}
\ No newline at end of file
+}
+// ValidateHandle проверяет хэндл: 3-30 символов, латиница, цифры, "_" и "-", не из списка зарезервированных
+func ValidateHandle(handle string) []string {
+	var errors []string
+
+	if l := len(handle); l < 3 || l > 30 {
+		errors = append(errors, "Хэндл должен содержать от 3 до 30 символов")
+	}
+	if !handleRegex.MatchString(handle) {
+		errors = append(errors, "Хэндл может содержать только латинские буквы, цифры, \"_\" и \"-\" и должен начинаться и заканчиваться буквой или цифрой")
+	}
+	if IsReservedHandle(handle) {
+		errors = append(errors, "Этот хэндл зарезервирован")
+	}
+
+	return errors
+}
+
+// IsReservedHandle проверяет хэндл по списку зарезервированных без учета регистра
+func IsReservedHandle(handle string) bool {
+	return reservedHandles[strings.ToLower(handle)] || generatedHandleRegex.MatchString(handle)
+}
@@ -0,0 +1,45 @@
+package validation
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/RESERPIX/hubigr/internal/domain"
+)
+
+// MaxNotificationRecipients - максимум получателей в одном событии
+const MaxNotificationRecipients = 1000
+
+// ValidatePublishNotification проверяет событие от внутренних сервисов
+func ValidatePublishNotification(req domain.PublishNotificationRequest) []string {
+	var errors []string
+
+	if len(req.UserIDs) == 0 {
+		errors = append(errors, "Список получателей пуст")
+	}
+	if len(req.UserIDs) > MaxNotificationRecipients {
+		errors = append(errors, "Слишком много получателей в одном событии")
+	}
+
+	if !req.Type.IsValid() {
+		errors = append(errors, "Неизвестный тип уведомления")
+	}
+
+	if l := utf8.RuneCountInString(strings.TrimSpace(req.Title)); l < 1 || l > 200 {
+		errors = append(errors, "Заголовок должен содержать от 1 до 200 символов")
+	}
+	if req.Body != nil && utf8.RuneCountInString(*req.Body) > 1000 {
+		errors = append(errors, "Текст не должен превышать 1000 символов")
+	}
+
+	// Ссылка либо относительная (путь фронтенда), либо абсолютный http(s) URL
+	if req.Link != nil && *req.Link != "" {
+		link := *req.Link
+		relative := strings.HasPrefix(link, "/") && !strings.HasPrefix(link, "//")
+		if !relative && !urlRegex.MatchString(link) {
+			errors = append(errors, "Неверный формат ссылки")
+		}
+	}
+
+	return errors
+}
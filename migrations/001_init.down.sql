@@ -0,0 +1,8 @@
+DROP FUNCTION IF EXISTS cleanup_expired_tokens();
+
+DROP TABLE IF EXISTS user_submissions;
+DROP TABLE IF EXISTS follows;
+DROP TABLE IF EXISTS notification_settings;
+DROP TABLE IF EXISTS password_reset_tokens;
+DROP TABLE IF EXISTS email_verify_tokens;
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,19 @@
+-- Уникальные хэндлы пользователей (отдельно от отображаемого ника)
+ALTER TABLE users ADD COLUMN IF NOT EXISTS handle CITEXT;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS handle_changed_at TIMESTAMPTZ;
+
+-- Существующим пользователям выдаем хэндл по ID
+UPDATE users SET handle = 'user' || id WHERE handle IS NULL;
+
+ALTER TABLE users ALTER COLUMN handle SET NOT NULL;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_handle ON users (handle);
+
+-- История хэндлов для редиректов со старых ссылок
+CREATE TABLE IF NOT EXISTS user_handle_history (
+    old_handle CITEXT PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    changed_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_handle_history_user ON user_handle_history (user_id);
@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS idx_notifications_digest;
+DROP INDEX IF EXISTS idx_notifications_unread;
+CREATE INDEX IF NOT EXISTS idx_notifications_unread ON notifications (user_id) WHERE read_at IS NULL;
+
+ALTER TABLE notifications DROP COLUMN IF EXISTS digest_pending;
+ALTER TABLE notifications DROP COLUMN IF EXISTS in_app;
+
+ALTER TABLE notification_settings DROP COLUMN IF EXISTS last_digest_at;
+ALTER TABLE notification_settings DROP COLUMN IF EXISTS email_digest;
@@ -0,0 +1,12 @@
+-- Email-дайджесты уведомлений
+ALTER TABLE notification_settings ADD COLUMN IF NOT EXISTS email_digest TEXT NOT NULL DEFAULT 'daily'
+    CHECK (email_digest IN ('daily', 'weekly'));
+ALTER TABLE notification_settings ADD COLUMN IF NOT EXISTS last_digest_at TIMESTAMPTZ;
+
+-- Событие может быть нужно только для дайджеста (in-app канал выключен)
+ALTER TABLE notifications ADD COLUMN IF NOT EXISTS in_app BOOLEAN NOT NULL DEFAULT true;
+ALTER TABLE notifications ADD COLUMN IF NOT EXISTS digest_pending BOOLEAN NOT NULL DEFAULT false;
+
+DROP INDEX IF EXISTS idx_notifications_unread;
+CREATE INDEX IF NOT EXISTS idx_notifications_unread ON notifications (user_id) WHERE read_at IS NULL AND in_app;
+CREATE INDEX IF NOT EXISTS idx_notifications_digest ON notifications (user_id, id) WHERE digest_pending;
@@ -0,0 +1,2 @@
+-- Язык писем и интерфейса пользователя
+ALTER TABLE users ADD COLUMN IF NOT EXISTS locale VARCHAR(8) NOT NULL DEFAULT 'ru';
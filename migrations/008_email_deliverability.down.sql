@@ -0,0 +1,11 @@
+-- Письма со статусом suppressed не проходят старое ограничение, возвращаем их в dead
+UPDATE email_outbox SET status = 'dead' WHERE status = 'suppressed';
+ALTER TABLE email_outbox DROP CONSTRAINT IF EXISTS email_outbox_status_check;
+ALTER TABLE email_outbox ADD CONSTRAINT email_outbox_status_check
+    CHECK (status IN ('pending', 'sending', 'sent', 'dead'));
+
+DROP TABLE IF EXISTS email_delivery_events;
+DROP TABLE IF EXISTS email_suppressions;
+
+ALTER TABLE users DROP COLUMN IF EXISTS email_status_at;
+ALTER TABLE users DROP COLUMN IF EXISTS email_status;
@@ -0,0 +1,30 @@
+-- Статус доставки писем пользователю по уведомлениям о bounce/complaint
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email_status TEXT NOT NULL DEFAULT 'ok'
+    CHECK (email_status IN ('ok', 'soft_bounce', 'bounced', 'complained'));
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email_status_at TIMESTAMPTZ;
+
+-- Адреса, на которые письма больше не отправляются
+CREATE TABLE IF NOT EXISTS email_suppressions (
+    email CITEXT PRIMARY KEY,
+    reason TEXT NOT NULL CHECK (reason IN ('bounce', 'complaint')),
+    detail TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- История уведомлений от почтового провайдера
+CREATE TABLE IF NOT EXISTS email_delivery_events (
+    id BIGSERIAL PRIMARY KEY,
+    email CITEXT NOT NULL,
+    type TEXT NOT NULL CHECK (type IN ('bounce', 'complaint')),
+    bounce_type TEXT CHECK (bounce_type IN ('hard', 'soft')),
+    detail TEXT,
+    source TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_email_delivery_events_email ON email_delivery_events (email, created_at DESC);
+
+-- Письма на подавленные адреса не отправляются и остаются в outbox со статусом suppressed
+ALTER TABLE email_outbox DROP CONSTRAINT IF EXISTS email_outbox_status_check;
+ALTER TABLE email_outbox ADD CONSTRAINT email_outbox_status_check
+    CHECK (status IN ('pending', 'sending', 'sent', 'dead', 'suppressed'));
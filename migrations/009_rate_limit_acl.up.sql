@@ -0,0 +1,10 @@
+-- IP и подсети, для которых rate limiting не применяется (allow) или запросы отклоняются (deny)
+CREATE TABLE IF NOT EXISTS rate_limit_acl (
+    id BIGSERIAL PRIMARY KEY,
+    cidr CIDR NOT NULL UNIQUE,
+    action TEXT NOT NULL CHECK (action IN ('allow', 'deny')),
+    comment TEXT,
+    created_by BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMPTZ
+);
@@ -0,0 +1,6 @@
+CREATE OR REPLACE FUNCTION cleanup_expired_tokens() RETURNS void AS $$
+BEGIN
+    DELETE FROM email_verify_tokens WHERE expires_at < NOW();
+    DELETE FROM password_reset_tokens WHERE expires_at < NOW();
+END;
+$$ LANGUAGE plpgsql;
@@ -0,0 +1,2 @@
+-- Истекшие токены удаляет задача expired_tokens планировщика сервиса
+DROP FUNCTION IF EXISTS cleanup_expired_tokens();
@@ -0,0 +1,5 @@
+-- Письма со статусом cancelled не проходят старое ограничение, возвращаем их в dead
+UPDATE email_outbox SET status = 'dead' WHERE status = 'cancelled';
+ALTER TABLE email_outbox DROP CONSTRAINT IF EXISTS email_outbox_status_check;
+ALTER TABLE email_outbox ADD CONSTRAINT email_outbox_status_check
+    CHECK (status IN ('pending', 'sending', 'sent', 'dead', 'suppressed'));
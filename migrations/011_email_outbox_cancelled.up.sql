@@ -0,0 +1,4 @@
+-- Письма с токеном, замененным новым или истекшим, отменяются и не отправляются
+ALTER TABLE email_outbox DROP CONSTRAINT IF EXISTS email_outbox_status_check;
+ALTER TABLE email_outbox ADD CONSTRAINT email_outbox_status_check
+    CHECK (status IN ('pending', 'sending', 'sent', 'dead', 'suppressed', 'cancelled'));
@@ -0,0 +1,10 @@
+// Package migrations содержит SQL миграции схемы, встроенные в бинарник.
+//
+// Файлы называются NNN_name.up.sql и NNN_name.down.sql. Примененную миграцию
+// не редактируют: изменение схемы - новая миграция со следующим номером.
+package migrations
+
+import "embed"
+
+//go:embed *.sql
+var FS embed.FS
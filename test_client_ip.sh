@@ -0,0 +1,55 @@
+#!/bin/bash
+
+# Тест определения IP клиента за прокси и подделки X-Forwarded-For / Forwarded.
+# Адрес, под которым сервис видит клиента, проверяется по счетчику лимита
+# публичного профиля (60/мин на IP): у разных IP счетчики разные.
+#
+# TRUSTED=0 ./test_client_ip.sh - сервис запущен без TRUSTED_PROXIES:
+#     заголовки от клиента должны игнорироваться
+# TRUSTED=1 ./test_client_ip.sh - адрес, с которого идет curl, есть в TRUSTED_PROXIES
+#     (CLIENT_IP_HEADER=x-forwarded-for): учитывается правый недоверенный адрес
+
+BASE=${BASE:-http://localhost:8080/api/v1}
+TRUSTED=${TRUSTED:-0}
+
+# Случайные адреса из документационной сети, чтобы не зависеть от прошлых запусков
+IP1="198.51.100.$((RANDOM % 250 + 1))"
+IP2="203.0.113.$((RANDOM % 250 + 1))"
+
+remaining() {
+    curl -s -o /dev/null -D - "$BASE/users/client-ip-test" "$@" \
+        | grep -i "^ratelimit-remaining" | tr -d '\r' | awk '{print $2}'
+}
+
+check() {
+    if [ "$2" = "$3" ]; then
+        echo "OK:   $1"
+    else
+        echo "FAIL: $1 (получено $2, ожидалось $3)"
+    fi
+}
+
+echo "Тестирование определения IP клиента (TRUSTED=$TRUSTED)..."
+
+A=$(remaining -H "X-Forwarded-For: $IP1")
+B=$(remaining -H "X-Forwarded-For: $IP2")
+C=$(remaining -H "Forwarded: for=$IP2")
+D=$(remaining -H "X-Forwarded-For: $IP1, $IP2")
+E=$(remaining)
+echo "RateLimit-Remaining: $A $B $C $D $E"
+
+if [ "$TRUSTED" = "0" ]; then
+    # Все запросы считаются по адресу соединения, один счетчик
+    check "X-Forwarded-For от недоверенного адреса игнорируется" "$B" "$((A - 1))"
+    check "Forwarded от недоверенного адреса игнорируется" "$C" "$((B - 1))"
+    check "Цепочка X-Forwarded-For от недоверенного адреса игнорируется" "$D" "$((C - 1))"
+    check "Запрос без заголовков - тот же счетчик" "$E" "$((D - 1))"
+else
+    # Каждый адрес из заголовка - свой счетчик
+    check "Первый запрос с $IP1 - новый счетчик" "$A" "59"
+    check "Первый запрос с $IP2 - новый счетчик" "$B" "59"
+    # Подставленный клиентом левый адрес не учитывается, клиент - $IP2
+    check "Подделанный левый адрес X-Forwarded-For не учитывается" "$D" "$((B - 1))"
+    # Без X-Forwarded-For клиент - сам прокси, Forwarded не читается
+    check "Forwarded игнорируется при CLIENT_IP_HEADER=x-forwarded-for" "$E" "$((C - 1))"
+fi
@@ -4,9 +4,16 @@
 
 echo "=== Testing Connection Pool Health ==="
 
+# Подробный /health доступен только админам
+if [ -z "$ADMIN_TOKEN" ]; then
+    echo "Set ADMIN_TOKEN to an admin access token"
+    exit 1
+fi
+HEALTH=(curl -s -H "Authorization: Bearer $ADMIN_TOKEN" http://localhost:8080/api/v1/health)
+
 # Проверяем health endpoint для статистики pools
 echo "1. Checking pool statistics..."
-curl -s http://localhost:8000/api/v1/health | jq '.database.pool_stats, .redis.pool_stats'
+"${HEALTH[@]}" | jq '.database.pool_stats, .redis.pool_stats'
 
 echo -e "\n2. Load testing to check for memory leaks..."
 
@@ -20,8 +27,8 @@ for i in {1..50}; do
     # Проверяем health каждые 10 запросов
     if [ $((i % 10)) -eq 0 ]; then
         echo "After $i requests:"
-        curl -s http://localhost:8000/api/v1/health | jq -r '.database.pool_stats | "DB: acquired=\(.acquired_conns)/\(.max_conns), idle=\(.idle_conns)"'
-        curl -s http://localhost:8000/api/v1/health | jq -r '.redis.pool_stats | "Redis: total=\(.total_conns), idle=\(.idle_conns), timeouts=\(.timeouts)"'
+        "${HEALTH[@]}" | jq -r '.database.pool_stats | "DB: acquired=\(.acquired_conns)/\(.max_conns), idle=\(.idle_conns)"'
+        "${HEALTH[@]}" | jq -r '.redis.pool_stats | "Redis: total=\(.total_conns), idle=\(.idle_conns), timeouts=\(.timeouts)"'
         echo "---"
     fi
 done
@@ -30,9 +37,9 @@ done
 wait
 
 echo -e "\n3. Final pool statistics after load test:"
-curl -s http://localhost:8000/api/v1/health | jq '.database.pool_stats, .redis.pool_stats'
+"${HEALTH[@]}" | jq '.database.pool_stats, .redis.pool_stats'
 
 echo -e "\n4. Checking for alerts..."
-curl -s http://localhost:8000/api/v1/health | jq '.alerts'
+"${HEALTH[@]}" | jq '.alerts'
 
 echo -e "\n=== Connection Pool Test Complete ==="
\ No newline at end of file
@@ -38,6 +38,6 @@ curl -X POST http://localhost:8000/api/v1/auth/resend-verification \
 echo "---"
 
 echo "Ожидается:"
-echo "1. Регистрация успешна, письмо отправлено (mock)"
+echo "1. Регистрация успешна, письмо отправлено (mock или maildir)"
 echo "2. Вход заблокирован - email_not_verified"
 echo "3. Новое письмо отправлено"
\ No newline at end of file
@@ -10,9 +10,21 @@ for i in {1..6}; do
     curl -X POST http://localhost:8000/api/v1/auth/login \
         -H "Content-Type: application/json" \
         -d '{"email":"test@example.com","password":"wrongpass"}' \
-        -w "\nHTTP Status: %{http_code}\n" \
-        -s | jq .
+        -D - -o /tmp/ratelimit_body.json \
+        -s | grep -iE "^HTTP/|^ratelimit-|^retry-after"
+    jq . /tmp/ratelimit_body.json
     echo "---"
 done
 
-echo "Ожидается: первые 5 попыток - 401, 6-я попытка - 429 (rate limit exceeded)"
\ No newline at end of file
+echo "Ожидается: первые 5 попыток - 401, 6-я попытка - 429 (rate limit exceeded)"
+echo "В ответах заголовки RateLimit-Limit/Remaining/Reset/Policy, в 429 - Retry-After"
+
+# Лимит считается по email, другой аккаунт с того же IP не заблокирован
+echo "Вход в другой аккаунт с того же IP:"
+curl -X POST http://localhost:8000/api/v1/auth/login \
+    -H "Content-Type: application/json" \
+    -d '{"email":"other@example.com","password":"wrongpass"}' \
+    -w "\nHTTP Status: %{http_code}\n" \
+    -s | jq .
+
+echo "Ожидается: 401 (лимит другого email не исчерпан)"
\ No newline at end of file